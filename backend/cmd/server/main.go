@@ -10,11 +10,13 @@ import (
 	"strings"
 	"syscall"
 	"time"
+	_ "time/tzdata" // settings accept any IANA timezone, even without system tzdata
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
+	"github.com/piggybank/backend/internal/account"
 	"github.com/piggybank/backend/internal/actions"
 	"github.com/piggybank/backend/internal/auth"
 	"github.com/piggybank/backend/internal/common/email"
@@ -22,30 +24,13 @@ import (
 	"github.com/piggybank/backend/internal/config"
 	"github.com/piggybank/backend/internal/couples"
 	"github.com/piggybank/backend/internal/database"
+	"github.com/piggybank/backend/internal/households"
 	"github.com/piggybank/backend/internal/piggybanks"
+	"github.com/piggybank/backend/internal/settings"
 	"github.com/piggybank/backend/internal/users"
 	"github.com/piggybank/backend/internal/vouchers"
 )
 
-type authResponse struct {
-	Token string       `json:"token"`
-	User  userResponse `json:"user"`
-}
-
-type userResponse struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
-}
-
-func mapUser(user users.User) userResponse {
-	return userResponse{
-		ID:    user.ID.String(),
-		Email: user.Email,
-		Name:  user.Name,
-	}
-}
-
 func main() {
 	if err := godotenv.Load(); err != nil {
 		if !os.IsNotExist(err) {
@@ -73,6 +58,12 @@ func main() {
 
 	router := gin.Default()
 	router.RedirectTrailingSlash = false
+	// Forwarding headers are only believed when the connection comes from one
+	// of these proxies; with none configured the peer address is used.
+	if err := router.SetTrustedProxies(cfg.App.TrustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %v", err)
+	}
+	router.Use(auth.ResolveClientIP)
 	router.Use(cors.New(cors.Config{
 		AllowOriginFunc: func(origin string) bool {
         // Acceptar localhost amb qualsevol port		
@@ -91,7 +82,7 @@ func main() {
         }
         return false
     },
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Accept", "Authorization", "Content-Type"},
 		ExposeHeaders:    []string{"Link"},
 		AllowCredentials: true,
@@ -100,12 +91,6 @@ func main() {
 
 	router.GET("/health", gin.WrapF(server.HealthHandler))
 
-	userRepo := users.NewPGRepository(dbPool)
-	jwtManager := auth.NewManager(cfg.Auth.AccessTokenSecret, cfg.Auth.AccessTokenTTL)
-	authService := auth.NewService(userRepo, jwtManager)
-	authHandler := auth.NewHandler(authService)
-	authMiddleware := auth.NewMiddleware(jwtManager, userRepo)
-
 	// Initialize email service if configured
 	var emailService *email.Service
 	if cfg.Email.SMTPHost != "" && cfg.Email.Username != "" {
@@ -120,27 +105,99 @@ func main() {
 		emailService = &service
 	}
 
+	userRepo := users.NewPGRepository(dbPool)
 	coupleStore := couples.NewStore(dbPool)
+	attemptStore := auth.NewMemoryAttemptStore()
+	if cfg.Auth.AttemptStore == "postgres" {
+		attemptStore = auth.NewPGAttemptStore(dbPool)
+	}
 	// Use frontend URL for invitation links
-	coupleService := couples.NewService(coupleStore, userRepo, emailService, "https://api.piggybank.zenith.ovh")
+	coupleService := couples.NewService(coupleStore, userRepo, emailService, "https://api.piggybank.zenith.ovh", cfg.Couples.RequireVerifiedEmail, attemptStore)
+	go coupleService.RunExpirySweeper(ctx, time.Hour)
+	settingsService := settings.NewService(settings.NewStore(dbPool))
+	householdStore := households.NewStore(dbPool)
+	householdService := households.NewService(householdStore, userRepo, emailService, settingsService)
+	go householdService.RunExpirySweeper(ctx, time.Hour)
+	authStore := auth.NewStore(dbPool)
+	keyring, err := auth.LoadKeyring(cfg.Auth.SigningKeysDir, cfg.Auth.ActiveSigningKeyID, cfg.Auth.AccessTokenSecret, cfg.Auth.AccessTokenSecretKeyID)
+	if err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+	jwtManager := auth.NewManager(keyring, cfg.Auth.AccessTokenTTL)
+	var oidcProviders []*auth.OIDCProvider
+	for _, provider := range cfg.OIDC.Providers {
+		oidcProviders = append(oidcProviders, auth.NewOIDCProvider(auth.OIDCConfig{
+			Name:         provider.Name,
+			DisplayName:  provider.DisplayName,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		}))
+	}
+	authService := auth.NewService(userRepo, authStore, attemptStore, jwtManager, emailService, coupleService, oidcProviders, cfg.Auth.RefreshTokenTTL)
+	authHandler := auth.NewHandler(authService)
+	authMiddleware := auth.NewMiddleware(jwtManager, userRepo, authStore)
+
+	accountService := account.NewService(account.NewStore(dbPool))
+	accountHandler := account.NewHandler(accountService)
+
 	coupleHandler := couples.NewHandler(coupleService)
+	householdHandler := households.NewHandler(householdService)
+	settingsHandler := settings.NewHandler(settingsService)
 	piggybankStore := piggybanks.NewStore(dbPool)
-	piggybankService := piggybanks.NewService(piggybankStore, coupleStore)
+	piggybankService := piggybanks.NewService(piggybankStore, householdStore, userRepo, emailService, settingsService)
+	go piggybankService.RunPurger(ctx, time.Hour)
+	go piggybankService.RunRollover(ctx, 15*time.Minute)
+	go piggybankService.RunFinaliser(ctx, 15*time.Minute)
 	piggybankHandler := piggybanks.NewHandler(piggybankService)
 	voucherStore := vouchers.NewStore(dbPool)
 	voucherService := vouchers.NewService(voucherStore, piggybankStore)
 	voucherHandler := vouchers.NewHandler(voucherService)
 	actionStore := actions.NewStore(dbPool)
-	actionService := actions.NewService(actionStore, piggybankStore, voucherStore)
+	actionService := actions.NewService(actionStore, piggybankStore, voucherStore, settingsService)
 	actionHandler := actions.NewHandler(actionService)
 
+	router.GET("/.well-known/jwks.json", gin.WrapF(authHandler.JWKS))
+
 	authGroup := router.Group("/auth")
 	authGroup.POST("/register", gin.WrapF(authHandler.Register))
 	authGroup.POST("/login", gin.WrapF(authHandler.Login))
+	authGroup.POST("/login/2fa", gin.WrapF(authHandler.LoginTwoFactor))
+	authGroup.POST("/magic-link", gin.WrapF(authHandler.MagicLink))
+	authGroup.POST("/magic-link/consume", gin.WrapF(authHandler.ConsumeMagicLink))
+	authGroup.GET("/oidc/providers", gin.WrapF(authHandler.OIDCProviders))
+	authGroup.POST("/oidc/:provider/authorize", wrapWithPathParams(authHandler.OIDCAuthorize))
+	authGroup.POST("/oidc/:provider/callback", wrapWithPathParams(authHandler.OIDCCallback))
+	authGroup.POST("/refresh", gin.WrapF(authHandler.Refresh))
+	authGroup.POST("/password/forgot", gin.WrapF(authHandler.ForgotPassword))
+	authGroup.POST("/password/reset", gin.WrapF(authHandler.ResetPassword))
+	authGroup.POST("/verify-email", gin.WrapF(authHandler.VerifyEmail))
+	authGroup.POST("/me/email/confirm", gin.WrapF(authHandler.ConfirmEmailChange))
 
 	authMe := authGroup.Group("")
-	authMe.Use(authMiddleware.GinAuthenticate)
+	authMe.Use(authMiddleware.GinAuthenticate, auth.GinRequireSession)
 	authMe.GET("/me", gin.WrapF(authHandler.Me))
+	authMe.PATCH("/me", gin.WrapF(authHandler.UpdateMe))
+	authMe.POST("/me/password", gin.WrapF(authHandler.ChangePassword))
+	authMe.POST("/me/email", gin.WrapF(authHandler.ChangeEmail))
+	authMe.POST("/2fa/enroll", gin.WrapF(authHandler.EnrollTOTP))
+	authMe.POST("/2fa/confirm", gin.WrapF(authHandler.ConfirmTOTP))
+	authMe.POST("/2fa/disable", gin.WrapF(authHandler.DisableTOTP))
+	authMe.DELETE("/me", accountHandler.Delete)
+	authMe.GET("/me/export", accountHandler.Export)
+	authMe.POST("/logout", gin.WrapF(authHandler.Logout))
+	authMe.GET("/sessions", gin.WrapF(authHandler.ListSessions))
+	authMe.DELETE("/sessions/:id", wrapWithPathParams(authHandler.RevokeSession))
+	authMe.POST("/verify-email/resend", gin.WrapF(authHandler.ResendVerification))
+	authMe.POST("/tokens", gin.WrapF(authHandler.CreateToken))
+	authMe.GET("/tokens", gin.WrapF(authHandler.ListTokens))
+	authMe.DELETE("/tokens/:id", wrapWithPathParams(authHandler.RevokeToken))
+	authMe.POST("/oidc/:provider/link", wrapWithPathParams(authHandler.OIDCLink))
+	authMe.POST("/oidc/:provider/link/callback", wrapWithPathParams(authHandler.OIDCLinkCallback))
+	authMe.GET("/identities", gin.WrapF(authHandler.ListIdentities))
+	authMe.DELETE("/identities/:id", wrapWithPathParams(authHandler.UnlinkIdentity))
 
 	// Invitation-based registration endpoint
 	router.POST("/auth/register-with-invitation", func(c *gin.Context) {
@@ -157,6 +214,10 @@ func main() {
 
 		// Check if invitation token is valid
 		invitationReq, err := coupleService.GetRequestByInvitationToken(c.Request.Context(), req.InvitationToken)
+		if errors.Is(err, couples.ErrRequestExpired) {
+			c.JSON(http.StatusGone, gin.H{"error": "invitation has expired"})
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invitation token"})
 			return
@@ -169,7 +230,7 @@ func main() {
 		}
 
 		// Register the user
-		user, token, err := authService.Register(c.Request.Context(), req.Email, req.Password, req.Name)
+		user, tokens, err := authService.Register(c.Request.Context(), req.Email, req.Password, req.Name, auth.ClientInfoFromRequest(c.Request))
 		if err != nil {
 			if errors.Is(err, auth.ErrEmailAlreadyRegistered) {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "email already registered"})
@@ -180,6 +241,13 @@ func main() {
 			return
 		}
 
+		// The invitation was delivered to this address, which proves ownership
+		if verified, err := authService.MarkEmailVerified(c.Request.Context(), user); err != nil {
+			log.Printf("failed to mark invited email as verified: %v", err)
+		} else {
+			user = verified
+		}
+
 		// Update the couple request to set target_user_id
 		err = coupleService.UpdateRequestTargetUser(c.Request.Context(), invitationReq.ID, user.ID)
 		if err != nil {
@@ -188,44 +256,86 @@ func main() {
 			return
 		}
 
-		c.JSON(http.StatusCreated, authResponse{
-			Token: token,
-			User:  mapUser(user),
-		})
+		c.JSON(http.StatusCreated, auth.NewAuthResponse(user, tokens))
 	})
 
+	router.GET("/couples/invitations/:token", wrapWithPathParams(coupleHandler.PreviewInvitation))
+
 	couples := router.Group("/couples")
-	couples.Use(authMiddleware.GinAuthenticate)
+	couples.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("couples"))
 	couples.POST("/request", gin.WrapF(coupleHandler.Request))
 	couples.POST("/accept", gin.WrapF(coupleHandler.Accept))
 	couples.POST("/resend", gin.WrapF(coupleHandler.Resend))
+	couples.POST("/reject", gin.WrapF(coupleHandler.Reject))
+	couples.POST("/cancel", gin.WrapF(coupleHandler.Cancel))
+	couples.POST("/invitations/:token/accept", wrapWithPathParams(coupleHandler.AcceptInvitation))
+	couples.POST("/pairing-codes", gin.WrapF(coupleHandler.CreatePairingCode))
+	couples.GET("/pairing-codes/:code/qr", wrapWithPathParams(coupleHandler.PairingQRCode))
+	couples.POST("/pairing-codes/redeem", gin.WrapF(coupleHandler.RedeemPairingCode))
+	couples.POST("/leave", gin.WrapF(coupleHandler.Leave))
 	couples.GET("/me", gin.WrapF(coupleHandler.Status))
+	couples.GET("/history", gin.WrapF(coupleHandler.History))
+
+	router.GET("/households/join/:token", wrapWithPathParams(householdHandler.PreviewInvitation))
+
+	households := router.Group("/households")
+	households.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("households"))
+	households.POST("", gin.WrapF(householdHandler.Create))
+	households.GET("/me", gin.WrapF(householdHandler.Me))
+	households.POST("/invitations", gin.WrapF(householdHandler.Invite))
+	households.GET("/invitations", gin.WrapF(householdHandler.ListInvitations))
+	households.POST("/invitations/:id/accept", wrapWithPathParams(householdHandler.AcceptInvitation))
+	households.POST("/invitations/:id/reject", wrapWithPathParams(householdHandler.RejectInvitation))
+	households.DELETE("/invitations/:id", wrapWithPathParams(householdHandler.CancelInvitation))
+	households.POST("/join/:token", wrapWithPathParams(householdHandler.Join))
+	households.PATCH("/members/:userId", wrapWithPathParams(householdHandler.UpdateMember))
+	households.DELETE("/members/:userId", wrapWithPathParams(householdHandler.RemoveMember))
+	households.POST("/leave", gin.WrapF(householdHandler.Leave))
+
+	settings := router.Group("/settings")
+	settings.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("settings"))
+	settings.GET("", gin.WrapF(settingsHandler.Get))
+	settings.PATCH("", gin.WrapF(settingsHandler.Update))
 
 	piggybanks := router.Group("/piggybanks")
-	piggybanks.Use(authMiddleware.GinAuthenticate)
+	piggybanks.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("piggybanks"))
 	piggybanks.POST("", piggybankHandler.Create)
 	piggybanks.GET("", piggybankHandler.List)
+	piggybanks.GET("/solo", piggybankHandler.ListSolo)
+	piggybanks.GET("/deleted", piggybankHandler.ListDeleted)
+	piggybanks.POST("/promote", piggybankHandler.Promote)
 	piggybanks.GET("/:id", piggybankHandler.GetByID)
+	piggybanks.PATCH("/:id", piggybankHandler.Update)
+	piggybanks.DELETE("/:id", piggybankHandler.Delete)
 	piggybanks.POST("/:id/close", piggybankHandler.Close)
+	piggybanks.POST("/:id/reopen", piggybankHandler.Reopen)
+	piggybanks.DELETE("/:id/deletion", piggybankHandler.CancelDeletion)
+	piggybanks.POST("/:id/restore", piggybankHandler.Restore)
+	piggybanks.GET("/:id/events", piggybankHandler.ListEvents)
+	piggybanks.GET("/:id/series", piggybankHandler.ListSeries)
+	piggybanks.GET("/:id/milestones", piggybankHandler.ListMilestones)
+	piggybanks.POST("/:id/milestones", piggybankHandler.CreateMilestone)
+	piggybanks.PATCH("/:id/milestones/:milestoneId", piggybankHandler.UpdateMilestone)
+	piggybanks.DELETE("/:id/milestones/:milestoneId", piggybankHandler.DeleteMilestone)
 
 	voucherTemplates := router.Group("/voucher-templates")
-	voucherTemplates.Use(authMiddleware.GinAuthenticate)
+	voucherTemplates.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("vouchers"))
 	voucherTemplates.POST("", voucherHandler.Create)
 
 	piggybankVoucherTemplates := router.Group("/piggybanks/:id/voucher-templates")
-	piggybankVoucherTemplates.Use(authMiddleware.GinAuthenticate)
+	piggybankVoucherTemplates.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("vouchers"))
 	piggybankVoucherTemplates.GET("", voucherHandler.ListByPiggyBank)
 
 	actionEntries := router.Group("/action-entries")
-	actionEntries.Use(authMiddleware.GinAuthenticate)
+	actionEntries.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("actions"))
 	actionEntries.POST("", actionHandler.Create)
 
 	piggybankActionEntries := router.Group("/piggybanks/:id/action-entries")
-	piggybankActionEntries.Use(authMiddleware.GinAuthenticate)
+	piggybankActionEntries.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("actions"))
 	piggybankActionEntries.GET("", actionHandler.ListByPiggyBank)
 
 	piggybankStats := router.Group("/piggybanks/:id/stats")
-	piggybankStats.Use(authMiddleware.GinAuthenticate)
+	piggybankStats.Use(authMiddleware.GinAuthenticate, auth.GinRequireScope("actions"))
 	piggybankStats.GET("", actionHandler.GetStats)
 
 	srv := &http.Server{
@@ -258,3 +368,14 @@ func main() {
 
 	log.Println("server stopped")
 }
+
+// wrapWithPathParams adapts a net/http handler to Gin and exposes the route
+// parameters through Request.PathValue.
+func wrapWithPathParams(h http.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, param := range c.Params {
+			c.Request.SetPathValue(param.Key, param.Value)
+		}
+		h(c.Writer, c.Request)
+	}
+}
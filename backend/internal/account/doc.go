@@ -0,0 +1,2 @@
+// Package account handles account-wide operations such as deletion and data export.
+package account
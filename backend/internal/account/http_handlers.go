@@ -0,0 +1,116 @@
+package account
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/piggybank/backend/internal/auth"
+)
+
+type Handler struct {
+	service Service
+}
+
+func NewHandler(service Service) Handler {
+	return Handler{service: service}
+}
+
+type deleteAccountPayload struct {
+	Password string `json:"password"`
+}
+
+// Delete handles DELETE /auth/me.
+func (h Handler) Delete(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	var payload deleteAccountPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), user, payload.Password); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPassword):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			log.Printf("internal error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Export handles GET /auth/me/export. It returns a JSON document, or a ZIP
+// archive with one JSON file per section when called with ?format=zip.
+func (h Handler) Export(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	export, err := h.service.Export(c.Request.Context(), user.ID)
+	if err != nil {
+		log.Printf("internal error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="piggybank-export.json"`)
+		c.JSON(http.StatusOK, export)
+	case "zip":
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", `attachment; filename="piggybank-export.zip"`)
+		c.Status(http.StatusOK)
+		if err := writeZip(c.Writer, export); err != nil {
+			log.Printf("failed to write export archive: %v", err)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or zip"})
+	}
+}
+
+func writeZip(w http.ResponseWriter, export Export) error {
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", export.Profile},
+		{"couple.json", export.Couple},
+		{"households.json", export.Households},
+		{"couple_requests.json", export.CoupleRequests},
+		{"piggybanks.json", export.PiggyBanks},
+		{"voucher_templates.json", export.VoucherTemplates},
+		{"action_entries.json", export.ActionEntries},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		fw, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(fw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,90 @@
+package account
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Export bundles every record linked to a user account.
+type Export struct {
+	GeneratedAt      time.Time                   `json:"generatedAt"`
+	Profile          ProfileExport               `json:"profile"`
+	Couple           *CoupleExport               `json:"couple"`
+	PastCouples      []CoupleExport              `json:"pastCouples"`
+	Households       []HouseholdMembershipExport `json:"households"`
+	CoupleRequests   []CoupleRequestExport       `json:"coupleRequests"`
+	PiggyBanks       []PiggyBankExport           `json:"piggyBanks"`
+	VoucherTemplates []VoucherTemplateExport     `json:"voucherTemplates"`
+	ActionEntries    []ActionEntryExport         `json:"actionEntries"`
+}
+
+type ProfileExport struct {
+	ID              uuid.UUID  `json:"id"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+type CoupleExport struct {
+	ID             uuid.UUID  `json:"id"`
+	Partner1UserID uuid.UUID  `json:"partner1UserId"`
+	Partner2UserID uuid.UUID  `json:"partner2UserId"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	EndedAt        *time.Time `json:"endedAt,omitempty"`
+}
+
+type HouseholdMembershipExport struct {
+	HouseholdID uuid.UUID  `json:"householdId"`
+	Name        *string    `json:"name"`
+	Role        string     `json:"role"`
+	JoinedAt    time.Time  `json:"joinedAt"`
+	LeftAt      *time.Time `json:"leftAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	EndedAt     *time.Time `json:"endedAt"`
+}
+
+type CoupleRequestExport struct {
+	ID              uuid.UUID  `json:"id"`
+	RequesterUserID uuid.UUID  `json:"requesterUserId"`
+	TargetUserID    *uuid.UUID `json:"targetUserId"`
+	TargetEmail     *string    `json:"targetEmail"`
+	Status          string     `json:"status"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	ExpiresAt       time.Time  `json:"expiresAt"`
+	RespondedAt     *time.Time `json:"respondedAt"`
+}
+
+type PiggyBankExport struct {
+	ID          uuid.UUID  `json:"id"`
+	CoupleID    *uuid.UUID `json:"coupleId"`
+	OwnerUserID *uuid.UUID `json:"ownerUserId"`
+	Title       string     `json:"title"`
+	Description *string    `json:"description"`
+	StartDate   time.Time  `json:"startDate"`
+	EndDate     *time.Time `json:"endDate"`
+	ArchivedAt  *time.Time `json:"archivedAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+type VoucherTemplateExport struct {
+	ID          uuid.UUID `json:"id"`
+	PiggyBankID uuid.UUID `json:"piggyBankId"`
+	Title       string    `json:"title"`
+	Description *string   `json:"description"`
+	AmountCents int       `json:"amountCents"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type ActionEntryExport struct {
+	ID                uuid.UUID  `json:"id"`
+	VoucherTemplateID uuid.UUID  `json:"voucherTemplateId"`
+	GiverUserID       *uuid.UUID `json:"giverUserId"`
+	OccurredAt        time.Time  `json:"occurredAt"`
+	Notes             *string    `json:"notes"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
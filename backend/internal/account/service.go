@@ -0,0 +1,101 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/piggybank/backend/internal/auth"
+	"github.com/piggybank/backend/internal/users"
+)
+
+var (
+	ErrInvalidPassword = errors.New("password is incorrect")
+)
+
+// Service coordinates account deletion and data export.
+type Service struct {
+	store Store
+}
+
+// NewService constructs a Service.
+func NewService(store Store) Service {
+	return Service{store: store}
+}
+
+// Delete permanently removes the account after checking its password. The
+// password may be left empty when the session signed in recently, so accounts
+// created through a magic link or an identity provider can be deleted too. See
+// Store.DeleteUser for what happens to shared data.
+func (s Service) Delete(ctx context.Context, user users.User, password string) error {
+	if password != "" || !auth.RecentlyAuthenticated(ctx) {
+		if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+			return ErrInvalidPassword
+		}
+	}
+
+	return s.store.DeleteUser(ctx, user.ID)
+}
+
+// Export gathers every record linked to the user.
+func (s Service) Export(ctx context.Context, userID uuid.UUID) (Export, error) {
+	profile, err := s.store.GetProfile(ctx, userID)
+	if err != nil {
+		return Export{}, err
+	}
+
+	couple, err := s.store.GetCouple(ctx, userID)
+	if err != nil {
+		return Export{}, err
+	}
+
+	pastCouples, err := s.store.ListPastCouples(ctx, userID)
+	if err != nil {
+		return Export{}, err
+	}
+
+	households, err := s.store.ListHouseholdMemberships(ctx, userID)
+	if err != nil {
+		return Export{}, err
+	}
+
+	requests, err := s.store.ListCoupleRequests(ctx, userID)
+	if err != nil {
+		return Export{}, err
+	}
+
+	piggyBanks, err := s.store.ListPiggyBanks(ctx, userID)
+	if err != nil {
+		return Export{}, err
+	}
+
+	piggyBankIDs := make([]uuid.UUID, 0, len(piggyBanks))
+	for _, pb := range piggyBanks {
+		piggyBankIDs = append(piggyBankIDs, pb.ID)
+	}
+
+	templates, err := s.store.ListVoucherTemplates(ctx, piggyBankIDs)
+	if err != nil {
+		return Export{}, err
+	}
+
+	entries, err := s.store.ListActionEntries(ctx, userID, piggyBankIDs)
+	if err != nil {
+		return Export{}, err
+	}
+
+	return Export{
+		GeneratedAt:      time.Now().UTC(),
+		Profile:          profile,
+		Couple:           couple,
+		PastCouples:      pastCouples,
+		Households:       households,
+		CoupleRequests:   requests,
+		PiggyBanks:       piggyBanks,
+		VoucherTemplates: templates,
+		ActionEntries:    entries,
+	}, nil
+}
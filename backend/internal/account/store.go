@@ -0,0 +1,343 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Store reads and removes account data across every domain table.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a new account store.
+func NewStore(pool *pgxpool.Pool) Store {
+	return Store{pool: pool}
+}
+
+// DeleteUser removes the user and applies the deletion policy in a single
+// transaction:
+//   - a household the user was alone in ends and its piggybanks are deleted,
+//   - a household of two, a couple included, is dissolved and its piggybanks
+//     are handed over to the other member as solo piggybanks,
+//   - a larger household loses the user; an owner is succeeded by the adult,
+//     or failing that the member, who joined first,
+//   - the user's own solo piggybanks are deleted with their templates and entries,
+//   - action entries the user gave in piggybanks that survive are anonymised.
+//
+// Sessions, tokens, memberships, invitations and couple requests are removed
+// by cascading foreign keys.
+func (s Store) DeleteUser(ctx context.Context, userID uuid.UUID) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	membershipQuery := `
+        SELECT household_id, role
+        FROM household_members
+        WHERE user_id = $1 AND left_at IS NULL
+        LIMIT 1
+        FOR UPDATE
+    `
+	var householdID uuid.UUID
+	var role string
+	err = tx.QueryRow(ctx, membershipQuery, userID).Scan(&householdID, &role)
+	switch {
+	case err == nil:
+		if err := leaveHousehold(ctx, tx, householdID, userID, role == "owner"); err != nil {
+			return err
+		}
+	case errors.Is(err, pgx.ErrNoRows):
+	default:
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM piggybanks WHERE owner_user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	anonymiseQuery := `
+        UPDATE action_entries
+        SET giver_user_id = NULL
+        WHERE giver_user_id = $1
+    `
+	if _, err := tx.Exec(ctx, anonymiseQuery, userID); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// leaveHousehold applies the deletion policy to the active household of a
+// user about to be deleted.
+func leaveHousehold(ctx context.Context, tx pgx.Tx, householdID, userID uuid.UUID, isOwner bool) error {
+	othersQuery := `
+        SELECT user_id
+        FROM household_members
+        WHERE household_id = $1 AND user_id <> $2 AND left_at IS NULL
+        FOR UPDATE
+    `
+	rows, err := tx.Query(ctx, othersQuery, householdID, userID)
+	if err != nil {
+		return err
+	}
+	var others []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		others = append(others, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	switch len(others) {
+	case 0:
+		_, err := tx.Exec(ctx, `DELETE FROM households WHERE id = $1`, householdID)
+		return err
+	case 1:
+		handoverQuery := `
+            UPDATE piggybanks
+            SET couple_id = NULL, owner_user_id = $2, updated_at = $3
+            WHERE couple_id = $1
+        `
+		if _, err := tx.Exec(ctx, handoverQuery, householdID, others[0], time.Now().UTC()); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `DELETE FROM households WHERE id = $1`, householdID)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM household_members WHERE household_id = $1 AND user_id = $2`, householdID, userID); err != nil {
+		return err
+	}
+	if !isOwner {
+		return nil
+	}
+
+	successorQuery := `
+        UPDATE household_members
+        SET role = 'owner'
+        WHERE id = (
+            SELECT id
+            FROM household_members
+            WHERE household_id = $1 AND left_at IS NULL
+            ORDER BY role = 'adult' DESC, joined_at ASC
+            LIMIT 1
+        )
+    `
+	_, err = tx.Exec(ctx, successorQuery, householdID)
+	return err
+}
+
+func (s Store) GetProfile(ctx context.Context, userID uuid.UUID) (ProfileExport, error) {
+	query := `
+        SELECT id, email, name, email_verified_at, created_at, updated_at
+        FROM users
+        WHERE id = $1
+    `
+	var p ProfileExport
+	if err := s.pool.QueryRow(ctx, query, userID).Scan(&p.ID, &p.Email, &p.Name, &p.EmailVerifiedAt, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ProfileExport{}, ErrNotFound
+		}
+		return ProfileExport{}, err
+	}
+	return p, nil
+}
+
+// coupleQuery selects couples from households: a couple is a household whose
+// only members ever were an owner and an adult.
+const coupleQuery = `
+        SELECT h.id, p1.user_id, p2.user_id, h.created_at, h.ended_at
+        FROM households h
+        INNER JOIN household_members p1 ON p1.household_id = h.id AND p1.role = 'owner'
+        INNER JOIN household_members p2 ON p2.household_id = h.id AND p2.role = 'adult'
+        WHERE (SELECT COUNT(*) FROM household_members m WHERE m.household_id = h.id) = 2
+          AND (p1.user_id = $1 OR p2.user_id = $1)
+    `
+
+func (s Store) GetCouple(ctx context.Context, userID uuid.UUID) (*CoupleExport, error) {
+	query := coupleQuery + `
+          AND h.ended_at IS NULL
+        LIMIT 1
+    `
+	var c CoupleExport
+	if err := s.pool.QueryRow(ctx, query, userID).Scan(&c.ID, &c.Partner1UserID, &c.Partner2UserID, &c.CreatedAt, &c.EndedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (s Store) ListPastCouples(ctx context.Context, userID uuid.UUID) ([]CoupleExport, error) {
+	query := coupleQuery + `
+          AND h.ended_at IS NOT NULL
+        ORDER BY h.created_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	couples := []CoupleExport{}
+	for rows.Next() {
+		var c CoupleExport
+		if err := rows.Scan(&c.ID, &c.Partner1UserID, &c.Partner2UserID, &c.CreatedAt, &c.EndedAt); err != nil {
+			return nil, err
+		}
+		couples = append(couples, c)
+	}
+	return couples, rows.Err()
+}
+
+func (s Store) ListHouseholdMemberships(ctx context.Context, userID uuid.UUID) ([]HouseholdMembershipExport, error) {
+	query := `
+        SELECT h.id, h.name, hm.role, hm.joined_at, hm.left_at, h.created_at, h.ended_at
+        FROM household_members hm
+        INNER JOIN households h ON h.id = hm.household_id
+        WHERE hm.user_id = $1
+        ORDER BY hm.joined_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	memberships := []HouseholdMembershipExport{}
+	for rows.Next() {
+		var m HouseholdMembershipExport
+		if err := rows.Scan(&m.HouseholdID, &m.Name, &m.Role, &m.JoinedAt, &m.LeftAt, &m.CreatedAt, &m.EndedAt); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+func (s Store) ListCoupleRequests(ctx context.Context, userID uuid.UUID) ([]CoupleRequestExport, error) {
+	query := `
+        SELECT id, requester_user_id, target_user_id, target_email, status, created_at, expires_at, responded_at
+        FROM couple_requests
+        WHERE requester_user_id = $1 OR target_user_id = $1
+        ORDER BY created_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []CoupleRequestExport{}
+	for rows.Next() {
+		var r CoupleRequestExport
+		if err := rows.Scan(&r.ID, &r.RequesterUserID, &r.TargetUserID, &r.TargetEmail, &r.Status, &r.CreatedAt, &r.ExpiresAt, &r.RespondedAt); err != nil {
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+	return requests, rows.Err()
+}
+
+func (s Store) ListPiggyBanks(ctx context.Context, userID uuid.UUID) ([]PiggyBankExport, error) {
+	query := `
+        SELECT pb.id, pb.couple_id, pb.owner_user_id, pb.title, pb.description, pb.start_date, pb.end_date, pb.archived_at, pb.created_at, pb.updated_at
+        FROM piggybanks pb
+        WHERE pb.owner_user_id = $1 OR EXISTS (
+            SELECT 1 FROM household_members hm
+            WHERE hm.household_id = pb.couple_id AND hm.user_id = $1
+        )
+        ORDER BY pb.created_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	piggyBanks := []PiggyBankExport{}
+	for rows.Next() {
+		var pb PiggyBankExport
+		if err := rows.Scan(&pb.ID, &pb.CoupleID, &pb.OwnerUserID, &pb.Title, &pb.Description, &pb.StartDate, &pb.EndDate, &pb.ArchivedAt, &pb.CreatedAt, &pb.UpdatedAt); err != nil {
+			return nil, err
+		}
+		piggyBanks = append(piggyBanks, pb)
+	}
+	return piggyBanks, rows.Err()
+}
+
+func (s Store) ListVoucherTemplates(ctx context.Context, piggyBankIDs []uuid.UUID) ([]VoucherTemplateExport, error) {
+	query := `
+        SELECT id, piggybank_id, title, description, amount_cents, created_at, updated_at
+        FROM voucher_templates
+        WHERE piggybank_id = ANY($1)
+        ORDER BY created_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, piggyBankIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []VoucherTemplateExport{}
+	for rows.Next() {
+		var vt VoucherTemplateExport
+		if err := rows.Scan(&vt.ID, &vt.PiggyBankID, &vt.Title, &vt.Description, &vt.AmountCents, &vt.CreatedAt, &vt.UpdatedAt); err != nil {
+			return nil, err
+		}
+		templates = append(templates, vt)
+	}
+	return templates, rows.Err()
+}
+
+// ListActionEntries returns entries recorded in the given piggybanks together
+// with any entry the user gave elsewhere.
+func (s Store) ListActionEntries(ctx context.Context, userID uuid.UUID, piggyBankIDs []uuid.UUID) ([]ActionEntryExport, error) {
+	query := `
+        SELECT ae.id, ae.voucher_template_id, ae.giver_user_id, ae.occurred_at, ae.notes, ae.created_at
+        FROM action_entries ae
+        INNER JOIN voucher_templates vt ON ae.voucher_template_id = vt.id
+        WHERE vt.piggybank_id = ANY($2) OR ae.giver_user_id = $1
+        ORDER BY ae.occurred_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, userID, piggyBankIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ActionEntryExport{}
+	for rows.Next() {
+		var ae ActionEntryExport
+		if err := rows.Scan(&ae.ID, &ae.VoucherTemplateID, &ae.GiverUserID, &ae.OccurredAt, &ae.Notes, &ae.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, ae)
+	}
+	return entries, rows.Err()
+}
@@ -28,15 +28,25 @@ type createActionEntryPayload struct {
 type actionEntryResponse struct {
 	ID               string  `json:"id"`
 	VoucherTemplateID string  `json:"voucherTemplateId"`
-	GiverUserID      string  `json:"giverUserId"`
+	GiverUserID      *string `json:"giverUserId"`
 	OccurredAt       string  `json:"occurredAt"`
 	Notes            *string `json:"notes"`
 	CreatedAt        string  `json:"createdAt"`
 }
 
 type piggyBankStatsResponse struct {
-	TotalActions int `json:"totalActions"`
-	TotalValue   int `json:"totalValue"`
+	TotalActions  int                   `json:"totalActions"`
+	TotalValue    int                   `json:"totalValue"`
+	Currency      string                `json:"currency"`
+	Period        string                `json:"period,omitempty"`
+	Periods       []periodTotalResponse `json:"periods,omitempty"`
+	CurrentPeriod *periodTotalResponse  `json:"currentPeriod,omitempty"`
+}
+
+type periodTotalResponse struct {
+	Start        string `json:"start"` // local date, YYYY-MM-DD
+	TotalActions int    `json:"totalActions"`
+	TotalValue   int    `json:"totalValue"`
 }
 
 func (h Handler) Create(c *gin.Context) {
@@ -71,6 +81,8 @@ func (h Handler) Create(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		case errors.Is(err, ErrPiggyBankEnded):
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrPiggyBankArchived):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		default:
 			// Check if it's a "not found" error by checking the error message
 			if err.Error() == "record not found" {
@@ -85,7 +97,7 @@ func (h Handler) Create(c *gin.Context) {
 	resp := actionEntryResponse{
 		ID:               ae.ID.String(),
 		VoucherTemplateID: ae.VoucherTemplateID.String(),
-		GiverUserID:      ae.GiverUserID.String(),
+		GiverUserID:      formatUUIDPtr(ae.GiverUserID),
 		OccurredAt:       ae.OccurredAt.Format(time.RFC3339),
 		Notes:            ae.Notes,
 		CreatedAt:        ae.CreatedAt.Format(time.RFC3339),
@@ -136,9 +148,11 @@ func (h Handler) GetStats(c *gin.Context) {
 		return
 	}
 
-	stats, err := h.service.GetStatsByPiggyBank(c.Request.Context(), piggyBankID, user.ID)
+	stats, err := h.service.GetStatsByPiggyBank(c.Request.Context(), piggyBankID, user.ID, c.Query("period"))
 	if err != nil {
 		switch {
+		case errors.Is(err, ErrInvalidPeriod):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		case errors.Is(err, ErrNotAuthorized):
 			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		default:
@@ -150,7 +164,32 @@ func (h Handler) GetStats(c *gin.Context) {
 	resp := piggyBankStatsResponse{
 		TotalActions: stats.TotalActions,
 		TotalValue:   stats.TotalValue,
+		Currency:     stats.Currency,
+		Period:       stats.Period,
+	}
+	for _, total := range stats.Periods {
+		resp.Periods = append(resp.Periods, mapPeriodTotal(total))
+	}
+	if stats.CurrentPeriod != nil {
+		current := mapPeriodTotal(*stats.CurrentPeriod)
+		resp.CurrentPeriod = &current
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
+
+func mapPeriodTotal(total PeriodTotal) periodTotalResponse {
+	return periodTotalResponse{
+		Start:        total.Start.Format("2006-01-02"),
+		TotalActions: total.TotalActions,
+		TotalValue:   total.TotalValue,
+	}
+}
+
+func formatUUIDPtr(u *uuid.UUID) *string {
+	if u == nil {
+		return nil
+	}
+	s := u.String()
+	return &s
+}
@@ -9,7 +9,7 @@ import (
 type ActionEntry struct {
 	ID               uuid.UUID
 	VoucherTemplateID uuid.UUID
-	GiverUserID      uuid.UUID
+	GiverUserID      *uuid.UUID // nil once the giver deleted their account
 	OccurredAt       time.Time
 	Notes            *string
 	CreatedAt        time.Time
@@ -35,6 +35,18 @@ type ActionEntrySummary struct {
 }
 
 type PiggyBankStats struct {
-	TotalActions int `json:"totalActions"`
-	TotalValue   int `json:"totalValue"` // in cents
+	TotalActions  int           `json:"totalActions"`
+	TotalValue    int           `json:"totalValue"` // in cents
+	Currency      string        `json:"currency"`
+	Period        string        `json:"period,omitempty"`
+	Periods       []PeriodTotal `json:"periods,omitempty"`
+	CurrentPeriod *PeriodTotal  `json:"currentPeriod,omitempty"`
+}
+
+// PeriodTotal sums the entries of one day, week or month beginning on the
+// local date Start.
+type PeriodTotal struct {
+	Start        time.Time `json:"start"`
+	TotalActions int       `json:"totalActions"`
+	TotalValue   int       `json:"totalValue"`
 }
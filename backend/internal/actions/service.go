@@ -3,30 +3,36 @@ package actions
 import (
 	"context"
 	"errors"
+	"log"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/piggybank/backend/internal/piggybanks"
+	"github.com/piggybank/backend/internal/settings"
 	"github.com/piggybank/backend/internal/vouchers"
 )
 
 var (
 	ErrNotAuthorized = errors.New("not authorized to create action entries")
 	ErrPiggyBankEnded = errors.New("cannot create action entries for ended piggybank")
+	ErrPiggyBankArchived = errors.New("cannot create action entries for archived piggybank")
+	ErrInvalidPeriod = errors.New("period must be day, week or month")
 )
 
 type Service struct {
 	store      Store
 	piggybanks piggybanks.Store
 	vouchers   vouchers.Store
+	settings   settings.Service
 }
 
-func NewService(store Store, piggybanksStore piggybanks.Store, vouchersStore vouchers.Store) Service {
+func NewService(store Store, piggybanksStore piggybanks.Store, vouchersStore vouchers.Store, settingsService settings.Service) Service {
 	return Service{
 		store:      store,
 		piggybanks: piggybanksStore,
 		vouchers:   vouchersStore,
+		settings:   settingsService,
 	}
 }
 
@@ -57,12 +63,15 @@ func (s Service) Create(ctx context.Context, userID uuid.UUID, voucherTemplateID
 	if pb.EndDate != nil && time.Now().After(*pb.EndDate) {
 		return ActionEntry{}, ErrPiggyBankEnded
 	}
+	if pb.ArchivedAt != nil {
+		return ActionEntry{}, ErrPiggyBankArchived
+	}
 
 	now := time.Now().UTC()
 	ae := ActionEntry{
 		ID:               uuid.New(),
 		VoucherTemplateID: voucherTemplateID,
-		GiverUserID:      userID,
+		GiverUserID:      &userID,
 		OccurredAt:       occurredAt,
 		Notes:            notes,
 		CreatedAt:        now,
@@ -73,6 +82,15 @@ func (s Service) Create(ctx context.Context, userID uuid.UUID, voucherTemplateID
 		return ActionEntry{}, err
 	}
 
+	// The entry is saved either way; a failed check is caught up by the
+	// next entry.
+	if _, err := s.piggybanks.MarkGoalReached(ctx, pb.ID, userID, now); err != nil {
+		log.Printf("failed to check the target of piggybank %s: %v", pb.ID, err)
+	}
+	if _, err := s.piggybanks.MarkMilestonesReached(ctx, pb.ID, userID, now); err != nil {
+		log.Printf("failed to check the milestones of piggybank %s: %v", pb.ID, err)
+	}
+
 	return ae, nil
 }
 
@@ -89,9 +107,16 @@ func (s Service) ListByPiggyBank(ctx context.Context, piggyBankID uuid.UUID, use
 	return s.store.ListByPiggyBankGrouped(ctx, piggyBankID)
 }
 
-func (s Service) GetStatsByPiggyBank(ctx context.Context, piggyBankID uuid.UUID, userID uuid.UUID) (PiggyBankStats, error) {
+// GetStatsByPiggyBank returns the totals of a piggybank. Given a period unit,
+// entries are also summed per day, week or month in the timezone and week
+// start of the piggybank's settings.
+func (s Service) GetStatsByPiggyBank(ctx context.Context, piggyBankID uuid.UUID, userID uuid.UUID, period string) (PiggyBankStats, error) {
+	if period != "" && period != settings.PeriodDay && period != settings.PeriodWeek && period != settings.PeriodMonth {
+		return PiggyBankStats{}, ErrInvalidPeriod
+	}
+
 	// Check if user has access to the piggybank
-	_, err := s.piggybanks.GetByIDForUser(ctx, piggyBankID, userID)
+	pb, err := s.piggybanks.GetByIDForUser(ctx, piggyBankID, userID)
 	if err != nil {
 		if errors.Is(err, piggybanks.ErrNotFound) {
 			return PiggyBankStats{}, ErrNotAuthorized
@@ -99,5 +124,42 @@ func (s Service) GetStatsByPiggyBank(ctx context.Context, piggyBankID uuid.UUID,
 		return PiggyBankStats{}, err
 	}
 
-	return s.store.GetStatsByPiggyBank(ctx, piggyBankID)
+	stats, err := s.store.GetStatsByPiggyBank(ctx, piggyBankID)
+	if err != nil {
+		return PiggyBankStats{}, err
+	}
+
+	st, err := s.settings.ForPiggyBank(ctx, pb.CoupleID, pb.OwnerUserID)
+	if err != nil {
+		return PiggyBankStats{}, err
+	}
+	stats.Currency = st.Currency
+
+	if period == "" {
+		return stats, nil
+	}
+
+	periods, err := s.store.ListPeriodTotals(ctx, piggyBankID, period, st.Location().String(), st.WeekStart)
+	if err != nil {
+		return PiggyBankStats{}, err
+	}
+	stats.Period = period
+	stats.Periods = periods
+
+	current := PeriodTotal{Start: st.PeriodStart(time.Now(), period)}
+	for _, total := range periods {
+		if sameDate(total.Start, current.Start) {
+			current = total
+			break
+		}
+	}
+	stats.CurrentPeriod = &current
+
+	return stats, nil
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
 }
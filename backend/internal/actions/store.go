@@ -3,6 +3,7 @@ package actions
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -95,3 +96,40 @@ func (s Store) GetStatsByPiggyBank(ctx context.Context, piggyBankID uuid.UUID) (
 	}
 	return stats, nil
 }
+
+// ListPeriodTotals sums the entries of a piggybank per day, week or month of
+// the given timezone, oldest first. Weeks begin on weekStart.
+func (s Store) ListPeriodTotals(ctx context.Context, piggyBankID uuid.UUID, unit string, timezone string, weekStart time.Weekday) ([]PeriodTotal, error) {
+	// date_trunc weeks begin on Monday: shift by the distance from the week
+	// start to Monday, truncate, and shift back.
+	query := `
+        SELECT
+            (CASE $2::text
+                WHEN 'week' THEN date_trunc('week', (ae.occurred_at AT TIME ZONE $3) - make_interval(days => $4)) + make_interval(days => $4)
+                ELSE date_trunc($2::text, ae.occurred_at AT TIME ZONE $3)
+            END)::date AS period_start,
+            COUNT(ae.id),
+            COALESCE(SUM(vt.amount_cents), 0)
+        FROM action_entries ae
+        INNER JOIN voucher_templates vt ON ae.voucher_template_id = vt.id
+        WHERE vt.piggybank_id = $1
+        GROUP BY period_start
+        ORDER BY period_start ASC
+    `
+	offset := (int(weekStart) + 6) % 7
+	rows, err := s.pool.Query(ctx, query, piggyBankID, unit, timezone, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []PeriodTotal
+	for rows.Next() {
+		var total PeriodTotal
+		if err := rows.Scan(&total.Start, &total.TotalActions, &total.TotalValue); err != nil {
+			return nil, err
+		}
+		totals = append(totals, total)
+	}
+	return totals, rows.Err()
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrTooManyAttempts = errors.New("too many failed attempts, try again later")
+
+// RateLimitError is returned while a login key is blocked. It matches
+// ErrTooManyAttempts with errors.Is.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("%s (retry after %s)", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// AttemptRecord tracks consecutive failures for a key such as an email
+// address or a client IP.
+type AttemptRecord struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  *time.Time
+}
+
+// AttemptStore persists failed attempts. Use the in-memory implementation for
+// single-node deployments and the Postgres one when running several replicas.
+type AttemptStore interface {
+	// Get returns the record for key, or a zero record when there is none.
+	Get(ctx context.Context, key string) (AttemptRecord, error)
+	// RegisterFailure atomically increments the failure counter, restarting
+	// it when the previous failure is older than window.
+	RegisterFailure(ctx context.Context, key string, now time.Time, window time.Duration) (AttemptRecord, error)
+	// Block prevents attempts for key until the given time.
+	Block(ctx context.Context, key string, until time.Time) error
+	// Reset forgets every failure recorded for key.
+	Reset(ctx context.Context, key string) error
+}
+
+// attemptPolicy describes how failures for a kind of key are throttled. After
+// FreeFailures, every failure blocks the key for an exponentially growing
+// delay. Reaching LockoutFailures locks the key for LockoutDuration.
+type attemptPolicy struct {
+	FreeFailures    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutFailures int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+var (
+	emailAttemptPolicy = attemptPolicy{
+		FreeFailures:    5,
+		BaseDelay:       time.Second,
+		MaxDelay:        15 * time.Minute,
+		LockoutFailures: 10,
+		LockoutDuration: 30 * time.Minute,
+		Window:          time.Hour,
+	}
+	ipAttemptPolicy = attemptPolicy{
+		FreeFailures: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     15 * time.Minute,
+		Window:       time.Hour,
+	}
+	twoFactorAttemptPolicy = attemptPolicy{
+		FreeFailures:    3,
+		BaseDelay:       2 * time.Second,
+		MaxDelay:        15 * time.Minute,
+		LockoutFailures: 10,
+		LockoutDuration: 30 * time.Minute,
+		Window:          time.Hour,
+	}
+)
+
+// delayAfter returns how long the key is blocked after the given number of
+// consecutive failures, and whether that block is a lockout.
+func (p attemptPolicy) delayAfter(failures int) (time.Duration, bool) {
+	if p.LockoutFailures > 0 && failures >= p.LockoutFailures {
+		return p.LockoutDuration, true
+	}
+	if failures <= p.FreeFailures {
+		return 0, false
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeFailures + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay, false
+}
+
+func emailAttemptKey(email string) string {
+	return "email:" + email
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+func twoFactorAttemptKey(userID string) string {
+	return "2fa:" + userID
+}
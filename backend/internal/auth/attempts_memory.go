@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryAttemptStore struct {
+	mu      sync.Mutex
+	records map[string]AttemptRecord
+}
+
+// NewMemoryAttemptStore creates an AttemptStore kept in process memory.
+func NewMemoryAttemptStore() AttemptStore {
+	return &memoryAttemptStore{records: map[string]AttemptRecord{}}
+}
+
+func (m *memoryAttemptStore) Get(ctx context.Context, key string) (AttemptRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[key]
+	if !ok {
+		return AttemptRecord{Key: key}, nil
+	}
+	return record, nil
+}
+
+func (m *memoryAttemptStore) RegisterFailure(ctx context.Context, key string, now time.Time, window time.Duration) (AttemptRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[key]
+	if !ok || now.Sub(record.LastFailureAt) > window {
+		record = AttemptRecord{Key: key}
+	}
+	record.Failures++
+	record.LastFailureAt = now
+	m.records[key] = record
+
+	m.evictExpired(now, window)
+	return record, nil
+}
+
+func (m *memoryAttemptStore) Block(ctx context.Context, key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.records[key]
+	if !ok {
+		record = AttemptRecord{Key: key, LastFailureAt: time.Now().UTC()}
+	}
+	record.BlockedUntil = &until
+	m.records[key] = record
+	return nil
+}
+
+func (m *memoryAttemptStore) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+	return nil
+}
+
+// evictExpired drops records that no longer affect any decision so the map
+// does not grow without bound. The caller must hold the lock.
+func (m *memoryAttemptStore) evictExpired(now time.Time, window time.Duration) {
+	for key, record := range m.records {
+		if now.Sub(record.LastFailureAt) <= window {
+			continue
+		}
+		if record.BlockedUntil != nil && record.BlockedUntil.After(now) {
+			continue
+		}
+		delete(m.records, key)
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type pgAttemptStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPGAttemptStore creates an AttemptStore shared by every instance through
+// PostgreSQL.
+func NewPGAttemptStore(pool *pgxpool.Pool) AttemptStore {
+	return &pgAttemptStore{pool: pool}
+}
+
+func (r *pgAttemptStore) Get(ctx context.Context, key string) (AttemptRecord, error) {
+	query := `
+        SELECT key, failures, last_failure_at, blocked_until
+        FROM login_attempts
+        WHERE key = $1
+    `
+	var record AttemptRecord
+	err := r.pool.QueryRow(ctx, query, key).Scan(&record.Key, &record.Failures, &record.LastFailureAt, &record.BlockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return AttemptRecord{Key: key}, nil
+		}
+		return AttemptRecord{}, err
+	}
+	return record, nil
+}
+
+func (r *pgAttemptStore) RegisterFailure(ctx context.Context, key string, now time.Time, window time.Duration) (AttemptRecord, error) {
+	query := `
+        INSERT INTO login_attempts (key, failures, last_failure_at)
+        VALUES ($1, 1, $2)
+        ON CONFLICT (key) DO UPDATE
+        SET failures = CASE
+                WHEN login_attempts.last_failure_at < $3 THEN 1
+                ELSE login_attempts.failures + 1
+            END,
+            blocked_until = CASE
+                WHEN login_attempts.last_failure_at < $3 THEN NULL
+                ELSE login_attempts.blocked_until
+            END,
+            last_failure_at = EXCLUDED.last_failure_at
+        RETURNING key, failures, last_failure_at, blocked_until
+    `
+	var record AttemptRecord
+	err := r.pool.QueryRow(ctx, query, key, now, now.Add(-window)).Scan(&record.Key, &record.Failures, &record.LastFailureAt, &record.BlockedUntil)
+	if err != nil {
+		return AttemptRecord{}, err
+	}
+	return record, nil
+}
+
+func (r *pgAttemptStore) Block(ctx context.Context, key string, until time.Time) error {
+	query := `
+        INSERT INTO login_attempts (key, failures, last_failure_at, blocked_until)
+        VALUES ($1, 0, NOW(), $2)
+        ON CONFLICT (key) DO UPDATE
+        SET blocked_until = EXCLUDED.blocked_until
+    `
+	_, err := r.pool.Exec(ctx, query, key, until)
+	return err
+}
+
+func (r *pgAttemptStore) Reset(ctx context.Context, key string) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM login_attempts WHERE key = $1`, key)
+	return err
+}
@@ -3,8 +3,12 @@ package auth
 import (
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/piggybank/backend/internal/common/response"
 	"github.com/piggybank/backend/internal/users"
 )
@@ -31,27 +35,616 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+type refreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type updateProfileRequest struct {
+	Name string `json:"name"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+type changeEmailRequest struct {
+	NewEmail string `json:"newEmail"`
+	Password string `json:"password"`
+}
+
+type confirmEmailChangeRequest struct {
+	Token string `json:"token"`
+}
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+	Code           string `json:"code"`
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type disableTwoFactorRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+type twoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	ChallengeToken    string `json:"challengeToken"`
+}
+
+type totpEnrollmentResponse struct {
+	Secret        string   `json:"secret"`
+	OTPAuthURI    string   `json:"otpauthUri"`
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type magicLinkRequest struct {
+	Email           string `json:"email"`
+	Name            string `json:"name"`
+	InvitationToken string `json:"invitationToken"`
+}
+
+type consumeMagicLinkRequest struct {
+	Token string `json:"token"`
+}
+
+type oidcCallbackRequest struct {
+	Code  string `json:"code"`
+	State string `json:"state"`
+}
+
+type oidcProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type identityResponse struct {
+	ID          string  `json:"id"`
+	Provider    string  `json:"provider"`
+	Email       *string `json:"email"`
+	CreatedAt   string  `json:"createdAt"`
+	LastLoginAt *string `json:"lastLoginAt"`
+}
+
+type createTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt *string  `json:"expiresAt"`
+}
+
+type tokenResponse struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	ExpiresAt  *string  `json:"expiresAt"`
+	LastUsedAt *string  `json:"lastUsedAt"`
+	CreatedAt  string   `json:"createdAt"`
+	Token      string   `json:"token,omitempty"`
+}
+
+type sessionResponse struct {
+	ID          string `json:"id"`
+	DeviceLabel string `json:"deviceLabel"`
+	UserAgent   string `json:"userAgent"`
+	IPAddress   string `json:"ipAddress"`
+	CreatedAt   string `json:"createdAt"`
+	LastSeenAt  string `json:"lastSeenAt"`
+	Current     bool   `json:"current"`
+}
+
 type authResponse struct {
-	Token string       `json:"token"`
-	User  userResponse `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refreshToken"`
+	ExpiresAt    string       `json:"expiresAt"`
+	User         userResponse `json:"user"`
+}
+
+type userResponse struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	Name          string `json:"name"`
+	EmailVerified bool   `json:"emailVerified"`
+}
+
+// Register handles POST /auth/register requests.
+func (h Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var req registerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	user, tokens, err := h.service.Register(r.Context(), req.Email, req.Password, req.Name, ClientInfoFromRequest(r))
+	if err != nil {
+		if isValidationError(err) {
+			response.BadRequest(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, NewAuthResponse(user, tokens))
+}
+
+// Login handles POST /auth/login requests.
+func (h Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	result, err := h.service.Login(r.Context(), req.Email, req.Password, ClientInfoFromRequest(r))
+	if err != nil {
+		var limited *RateLimitError
+		if errors.As(err, &limited) {
+			response.TooManyRequests(w, ErrTooManyAttempts.Error(), limited.RetryAfter)
+			return
+		}
+		if isValidationError(err) || errors.Is(err, ErrInvalidCredentials) {
+			response.Unauthorized(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	if result.ChallengeToken != "" {
+		response.JSON(w, http.StatusOK, twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    result.ChallengeToken,
+		})
+		return
+	}
+
+	response.JSON(w, http.StatusOK, NewAuthResponse(result.User, result.Tokens))
+}
+
+// MagicLink handles POST /auth/magic-link requests. The response is identical
+// whether or not a link was sent.
+func (h Handler) MagicLink(w http.ResponseWriter, r *http.Request) {
+	var req magicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	if err := h.service.RequestMagicLink(r.Context(), req.Email, req.Name, req.InvitationToken); err != nil {
+		if isValidationError(err) {
+			response.BadRequest(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusAccepted, map[string]string{
+		"message": "if the address can sign in, a link has been sent",
+	})
+}
+
+// ConsumeMagicLink handles POST /auth/magic-link/consume requests.
+func (h Handler) ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	var req consumeMagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	result, err := h.service.ConsumeMagicLink(r.Context(), req.Token, ClientInfoFromRequest(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidMagicLink):
+			response.Unauthorized(w, err.Error())
+		case errors.Is(err, ErrEmailAlreadyRegistered):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	if result.ChallengeToken != "" {
+		response.JSON(w, http.StatusOK, twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    result.ChallengeToken,
+		})
+		return
+	}
+
+	response.JSON(w, http.StatusOK, NewAuthResponse(result.User, result.Tokens))
+}
+
+// OIDCProviders handles GET /auth/oidc/providers.
+func (h Handler) OIDCProviders(w http.ResponseWriter, r *http.Request) {
+	providers := h.service.OIDCProviders()
+	result := make([]oidcProviderResponse, 0, len(providers))
+	for _, provider := range providers {
+		result = append(result, oidcProviderResponse{Name: provider.Name(), DisplayName: provider.DisplayName()})
+	}
+	response.JSON(w, http.StatusOK, result)
+}
+
+// OIDCAuthorize handles POST /auth/oidc/{provider}/authorize and returns the
+// provider URL to send the user to.
+func (h Handler) OIDCAuthorize(w http.ResponseWriter, r *http.Request) {
+	authURL, err := h.service.StartOIDCLogin(r.Context(), r.PathValue("provider"))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, map[string]string{"authorizationUrl": authURL})
+}
+
+// OIDCCallback handles POST /auth/oidc/{provider}/callback with the code and
+// state the provider redirected back with.
+func (h Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	var req oidcCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	result, err := h.service.CompleteOIDCLogin(r.Context(), r.PathValue("provider"), req.Code, req.State, ClientInfoFromRequest(r))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+
+	if result.ChallengeToken != "" {
+		response.JSON(w, http.StatusOK, twoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    result.ChallengeToken,
+		})
+		return
+	}
+
+	response.JSON(w, http.StatusOK, NewAuthResponse(result.User, result.Tokens))
+}
+
+// OIDCLink handles POST /auth/oidc/{provider}/link for the authenticated user.
+func (h Handler) OIDCLink(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	authURL, err := h.service.StartOIDCLink(r.Context(), user, r.PathValue("provider"))
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	response.JSON(w, http.StatusOK, map[string]string{"authorizationUrl": authURL})
+}
+
+// OIDCLinkCallback handles POST /auth/oidc/{provider}/link/callback.
+func (h Handler) OIDCLinkCallback(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var req oidcCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	identity, err := h.service.CompleteOIDCLink(r.Context(), user, r.PathValue("provider"), req.Code, req.State)
+	if err != nil {
+		writeOIDCError(w, err)
+		return
+	}
+	response.JSON(w, http.StatusCreated, mapIdentity(identity))
+}
+
+// ListIdentities handles GET /auth/identities.
+func (h Handler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	identities, err := h.service.ListIdentities(r.Context(), user.ID)
+	if err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	result := make([]identityResponse, 0, len(identities))
+	for _, identity := range identities {
+		result = append(result, mapIdentity(identity))
+	}
+	response.JSON(w, http.StatusOK, result)
+}
+
+// UnlinkIdentity handles DELETE /auth/identities/{id}.
+func (h Handler) UnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	identityID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		response.BadRequest(w, "invalid identity ID")
+		return
+	}
+
+	if err := h.service.UnlinkIdentity(r.Context(), user.ID, identityID); err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			response.NotFound(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeOIDCError maps errors of the OpenID Connect flows to responses.
+func writeOIDCError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownProvider):
+		response.NotFound(w, err.Error())
+	case errors.Is(err, ErrInvalidOIDCState), errors.Is(err, ErrInvalidOIDCCode), errors.Is(err, ErrInvalidIDToken):
+		response.Unauthorized(w, err.Error())
+	case errors.Is(err, ErrOIDCEmailNotVerified):
+		response.Forbidden(w, err.Error())
+	case errors.Is(err, ErrOIDCAccountExists), errors.Is(err, ErrIdentityLinked):
+		response.Conflict(w, err.Error())
+	default:
+		response.InternalError(w, err)
+	}
+}
+
+// LoginTwoFactor handles POST /auth/login/2fa requests.
+func (h Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req twoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	user, tokens, err := h.service.CompleteTwoFactorLogin(r.Context(), req.ChallengeToken, req.Code, ClientInfoFromRequest(r))
+	if err != nil {
+		var limited *RateLimitError
+		if errors.As(err, &limited) {
+			response.TooManyRequests(w, ErrTooManyAttempts.Error(), limited.RetryAfter)
+			return
+		}
+		if errors.Is(err, ErrInvalidChallenge) || errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrTwoFactorNotEnabled) {
+			response.Unauthorized(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, NewAuthResponse(user, tokens))
+}
+
+// Refresh handles POST /auth/refresh requests.
+func (h Handler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	user, tokens, err := h.service.Refresh(r.Context(), req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+			response.Unauthorized(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, NewAuthResponse(user, tokens))
 }
 
-type userResponse struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
-	Name  string `json:"name"`
+// Logout handles POST /auth/logout by revoking the current session.
+func (h Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	sessionID, ok := SessionIDFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	if err := h.service.Logout(r.Context(), sessionID); err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// JWKS handles GET /.well-known/jwks.json with the public signing keys.
+func (h Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	response.JSON(w, http.StatusOK, h.service.JWKS())
+}
+
+// ListSessions handles GET /auth/sessions and flags the session of the caller.
+func (h Handler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+	currentID, _ := SessionIDFromContext(r.Context())
+
+	sessions, err := h.service.ListSessions(r.Context(), user.ID)
+	if err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	result := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, sessionResponse{
+			ID:          session.ID.String(),
+			DeviceLabel: session.DeviceLabel,
+			UserAgent:   session.UserAgent,
+			IPAddress:   session.IPAddress,
+			CreatedAt:   session.CreatedAt.Format(time.RFC3339),
+			LastSeenAt:  session.LastSeenAt.Format(time.RFC3339),
+			Current:     session.ID == currentID,
+		})
+	}
+
+	response.JSON(w, http.StatusOK, result)
+}
+
+// RevokeSession handles DELETE /auth/sessions/{id} to sign out another device.
+func (h Handler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		response.BadRequest(w, "invalid session ID")
+		return
+	}
+
+	if err := h.service.RevokeSession(r.Context(), user.ID, sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			response.NotFound(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// Register handles POST /auth/register requests.
-func (h Handler) Register(w http.ResponseWriter, r *http.Request) {
-	var req registerRequest
+// CreateToken handles POST /auth/tokens. The token is only shown in this response.
+func (h Handler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var req createTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.BadRequest(w, "invalid payload")
 		return
 	}
 
-	user, token, err := h.service.Register(r.Context(), req.Email, req.Password, req.Name)
+	var expiresAt *time.Time
+	if req.ExpiresAt != nil && *req.ExpiresAt != "" {
+		parsed, err := time.Parse(time.RFC3339, *req.ExpiresAt)
+		if err != nil {
+			response.BadRequest(w, "invalid expiresAt, expected RFC3339")
+			return
+		}
+		expiresAt = &parsed
+	}
+
+	token, raw, err := h.service.CreatePersonalAccessToken(r.Context(), user.ID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTokenNameRequired), errors.Is(err, ErrScopesRequired), errors.Is(err, ErrInvalidScope), errors.Is(err, ErrInvalidTokenExpiry):
+			response.BadRequest(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	result := mapToken(token)
+	result.Token = raw
+	response.JSON(w, http.StatusCreated, result)
+}
+
+// ListTokens handles GET /auth/tokens.
+func (h Handler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	tokens, err := h.service.ListPersonalAccessTokens(r.Context(), user.ID)
 	if err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	result := make([]tokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, mapToken(token))
+	}
+
+	response.JSON(w, http.StatusOK, result)
+}
+
+// RevokeToken handles DELETE /auth/tokens/{id}.
+func (h Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		response.BadRequest(w, "invalid token ID")
+		return
+	}
+
+	if err := h.service.RevokePersonalAccessToken(r.Context(), user.ID, tokenID); err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			response.NotFound(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ForgotPassword handles POST /auth/password/forgot requests. The response is
+// identical whether or not the address is registered.
+func (h Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	if err := h.service.ForgotPassword(r.Context(), req.Email); err != nil {
 		if isValidationError(err) {
 			response.BadRequest(w, err.Error())
 			return
@@ -60,34 +653,70 @@ func (h Handler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response.JSON(w, http.StatusCreated, authResponse{
-		Token: token,
-		User:  mapUser(user),
+	response.JSON(w, http.StatusAccepted, map[string]string{
+		"message": "if the address is registered, a reset link has been sent",
 	})
 }
 
-// Login handles POST /auth/login requests.
-func (h Handler) Login(w http.ResponseWriter, r *http.Request) {
-	var req loginRequest
+// ResetPassword handles POST /auth/password/reset requests.
+func (h Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	if err := h.service.ResetPassword(r.Context(), req.Token, req.Password); err != nil {
+		if isValidationError(err) || errors.Is(err, ErrInvalidResetToken) {
+			response.BadRequest(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// VerifyEmail handles POST /auth/verify-email requests.
+func (h Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req verifyEmailRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		response.BadRequest(w, "invalid payload")
 		return
 	}
 
-	user, token, err := h.service.Login(r.Context(), req.Email, req.Password)
+	user, err := h.service.VerifyEmail(r.Context(), req.Token)
 	if err != nil {
-		if isValidationError(err) || errors.Is(err, ErrInvalidCredentials) {
-			response.Unauthorized(w, err.Error())
+		if errors.Is(err, ErrInvalidVerifyToken) {
+			response.BadRequest(w, err.Error())
 			return
 		}
 		response.InternalError(w, err)
 		return
 	}
 
-	response.JSON(w, http.StatusOK, authResponse{
-		Token: token,
-		User:  mapUser(user),
-	})
+	response.JSON(w, http.StatusOK, mapUser(user))
+}
+
+// ResendVerification handles POST /auth/verify-email/resend requests.
+func (h Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	if err := h.service.ResendEmailVerification(r.Context(), user); err != nil {
+		if errors.Is(err, ErrEmailAlreadyVerified) {
+			response.Conflict(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusAccepted, map[string]string{"message": "verification email sent"})
 }
 
 // Me returns the authenticated user profile.
@@ -101,6 +730,201 @@ func (h Handler) Me(w http.ResponseWriter, r *http.Request) {
 	response.JSON(w, http.StatusOK, mapUser(user))
 }
 
+// UpdateMe handles PATCH /auth/me requests.
+func (h Handler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var req updateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	updated, err := h.service.UpdateName(r.Context(), user, req.Name)
+	if err != nil {
+		if isValidationError(err) {
+			response.BadRequest(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, mapUser(updated))
+}
+
+// ChangePassword handles POST /auth/me/password requests.
+func (h Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+	sessionID, _ := SessionIDFromContext(r.Context())
+
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	if err := h.service.ChangePassword(r.Context(), user, sessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPassword):
+			response.Forbidden(w, err.Error())
+		case isValidationError(err):
+			response.BadRequest(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ChangeEmail handles POST /auth/me/email requests.
+func (h Handler) ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var req changeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	if err := h.service.RequestEmailChange(r.Context(), user, req.Password, req.NewEmail); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPassword):
+			response.Forbidden(w, err.Error())
+		case errors.Is(err, ErrEmailAlreadyRegistered):
+			response.Conflict(w, err.Error())
+		case isValidationError(err), errors.Is(err, ErrSameEmail):
+			response.BadRequest(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusAccepted, map[string]string{"message": "confirmation email sent to the new address"})
+}
+
+// ConfirmEmailChange handles POST /auth/me/email/confirm requests.
+func (h Handler) ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	var req confirmEmailChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	user, err := h.service.ConfirmEmailChange(r.Context(), req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidEmailChange):
+			response.BadRequest(w, err.Error())
+		case errors.Is(err, ErrEmailAlreadyRegistered):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusOK, mapUser(user))
+}
+
+// EnrollTOTP handles POST /auth/2fa/enroll requests.
+func (h Handler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	enrollment, err := h.service.EnrollTOTP(r.Context(), user)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorEnabled) {
+			response.Conflict(w, err.Error())
+			return
+		}
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, totpEnrollmentResponse{
+		Secret:        enrollment.Secret,
+		OTPAuthURI:    enrollment.URI,
+		RecoveryCodes: enrollment.RecoveryCodes,
+	})
+}
+
+// ConfirmTOTP handles POST /auth/2fa/confirm requests.
+func (h Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	if err := h.service.ConfirmTOTP(r.Context(), user, req.Code); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidTwoFactorCode), errors.Is(err, ErrTwoFactorNotEnrolled):
+			response.BadRequest(w, err.Error())
+		case errors.Is(err, ErrTwoFactorEnabled):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableTOTP handles POST /auth/2fa/disable requests.
+func (h Handler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var req disableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	if err := h.service.DisableTOTP(r.Context(), user, req.Password, req.Code); err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPassword), errors.Is(err, ErrInvalidTwoFactorCode):
+			response.Forbidden(w, err.Error())
+		case errors.Is(err, ErrTwoFactorNotEnabled):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func isValidationError(err error) bool {
 	switch {
 	case errors.Is(err, ErrEmailRequired):
@@ -118,10 +942,126 @@ func isValidationError(err error) bool {
 	}
 }
 
+// NewAuthResponse builds the payload returned after a successful authentication.
+func NewAuthResponse(user users.User, tokens TokenPair) interface{} {
+	return authResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt.Format(time.RFC3339),
+		User:         mapUser(user),
+	}
+}
+
+// ClientInfoFromRequest describes the client opening a session. Apps may name
+// the device through the X-Device-Label header; otherwise a label is derived
+// from the user agent.
+func ClientInfoFromRequest(r *http.Request) ClientInfo {
+	userAgent := strings.TrimSpace(r.UserAgent())
+	label := strings.TrimSpace(r.Header.Get("X-Device-Label"))
+	if label == "" {
+		label = deviceLabelFromUserAgent(userAgent)
+	}
+	if len(label) > 100 {
+		label = label[:100]
+	}
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	return ClientInfo{
+		DeviceLabel: label,
+		UserAgent:   userAgent,
+		IPAddress:   clientIP(r),
+	}
+}
+
+// deviceLabelFromUserAgent makes a rough, human-readable guess of the device.
+func deviceLabelFromUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+
+	var device string
+	switch {
+	case strings.Contains(ua, "iphone"):
+		device = "iPhone"
+	case strings.Contains(ua, "ipad"):
+		device = "iPad"
+	case strings.Contains(ua, "android"):
+		device = "Android"
+	case strings.Contains(ua, "macintosh") || strings.Contains(ua, "mac os"):
+		device = "Mac"
+	case strings.Contains(ua, "windows"):
+		device = "Windows"
+	case strings.Contains(ua, "linux"):
+		device = "Linux"
+	default:
+		return "Unknown device"
+	}
+
+	switch {
+	case strings.Contains(ua, "edg/"):
+		return "Edge on " + device
+	case strings.Contains(ua, "firefox/"):
+		return "Firefox on " + device
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		return "Chrome on " + device
+	case strings.Contains(ua, "safari/"):
+		return "Safari on " + device
+	default:
+		return device
+	}
+}
+
+// clientIP returns the originating client address. Forwarding headers are
+// only honoured through ResolveClientIP, which checks they were set by a
+// trusted proxy; otherwise the peer address is used.
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey).(string); ok && ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func mapIdentity(identity Identity) identityResponse {
+	result := identityResponse{
+		ID:        identity.ID.String(),
+		Provider:  identity.Provider,
+		Email:     identity.Email,
+		CreatedAt: identity.CreatedAt.Format(time.RFC3339),
+	}
+	if identity.LastLoginAt != nil {
+		formatted := identity.LastLoginAt.Format(time.RFC3339)
+		result.LastLoginAt = &formatted
+	}
+	return result
+}
+
+func mapToken(token PersonalAccessToken) tokenResponse {
+	result := tokenResponse{
+		ID:        token.ID.String(),
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt.Format(time.RFC3339),
+	}
+	if token.ExpiresAt != nil {
+		formatted := token.ExpiresAt.Format(time.RFC3339)
+		result.ExpiresAt = &formatted
+	}
+	if token.LastUsedAt != nil {
+		formatted := token.LastUsedAt.Format(time.RFC3339)
+		result.LastUsedAt = &formatted
+	}
+	return result
+}
+
 func mapUser(user users.User) userResponse {
 	return userResponse{
-		ID:    user.ID.String(),
-		Email: user.Email,
-		Name:  user.Name,
+		ID:            user.ID.String(),
+		Email:         user.Email,
+		Name:          user.Name,
+		EmailVerified: user.EmailVerifiedAt != nil,
 	}
 }
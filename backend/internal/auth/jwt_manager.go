@@ -9,49 +9,119 @@ import (
 
 // TokenClaims represents JWT claims for access tokens.
 type TokenClaims struct {
+	UserID    uuid.UUID `json:"user_id"`
+	SessionID uuid.UUID `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// ActionClaims represents claims of single-purpose tokens sent by email, such
+// as address verification links. The audience identifies the purpose. Stamp,
+// when set, binds the token to the state of the account it was issued for.
+type ActionClaims struct {
 	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+	Stamp  string    `json:"stamp,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // Manager handles JWT token creation and validation.
 type Manager struct {
-	secret []byte
-	ttl    time.Duration
+	keys Keyring
+	ttl  time.Duration
+}
+
+// NewManager creates a new JWT manager instance signing with the active key
+// of the keyring.
+func NewManager(keys Keyring, ttl time.Duration) Manager {
+	return Manager{keys: keys, ttl: ttl}
 }
 
-// NewManager creates a new JWT manager instance.
-func NewManager(secret string, ttl time.Duration) Manager {
-	return Manager{secret: []byte(secret), ttl: ttl}
+// TTL returns the lifetime of access tokens issued by the manager.
+func (m Manager) TTL() time.Duration {
+	return m.ttl
 }
 
-// GenerateAccessToken creates a signed JWT for the provided user ID.
-func (m Manager) GenerateAccessToken(userID uuid.UUID) (string, error) {
+// GenerateAccessToken creates a signed JWT for the provided user and session.
+func (m Manager) GenerateAccessToken(userID, sessionID uuid.UUID) (string, error) {
 	claims := TokenClaims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			Subject:   userID.String(),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(m.ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(m.secret)
+	return m.sign(claims)
 }
 
 // Parse validates the token string and returns the embedded claims.
 func (m Manager) Parse(tokenString string) (*TokenClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return m.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &TokenClaims{}, m.keys.keyFunc, jwt.WithValidMethods(m.keys.Algorithms()))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Action tokens carry an audience and must never be accepted as access tokens.
+	if claims, ok := token.Claims.(*TokenClaims); ok && token.Valid && len(claims.Audience) == 0 {
+		return claims, nil
+	}
+
+	return nil, jwt.ErrTokenInvalidClaims
+}
+
+// GenerateActionToken creates a signed single-purpose token bound to a user and
+// email address.
+func (m Manager) GenerateActionToken(audience string, userID uuid.UUID, email string, ttl time.Duration) (string, error) {
+	return m.GenerateStampedActionToken(audience, userID, email, "", ttl)
+}
+
+// GenerateStampedActionToken creates an action token that is only honoured
+// while the account still has the given stamp.
+func (m Manager) GenerateStampedActionToken(audience string, userID uuid.UUID, email, stamp string, ttl time.Duration) (string, error) {
+	claims := ActionClaims{
+		UserID: userID,
+		Email:  email,
+		Stamp:  stamp,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{audience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return m.sign(claims)
+}
+
+// ParseActionToken validates a single-purpose token for the given audience.
+func (m Manager) ParseActionToken(audience, tokenString string) (*ActionClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &ActionClaims{}, m.keys.keyFunc, jwt.WithValidMethods(m.keys.Algorithms()), jwt.WithAudience(audience))
 
 	if err != nil {
 		return nil, err
 	}
 
-	if claims, ok := token.Claims.(*TokenClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*ActionClaims); ok && token.Valid {
 		return claims, nil
 	}
 
 	return nil, jwt.ErrTokenInvalidClaims
 }
+
+// JWKS returns the public keys other services can verify tokens with.
+func (m Manager) JWKS() JWKSet {
+	return m.keys.JWKS()
+}
+
+// sign signs the claims with the active key and names it in the kid header.
+func (m Manager) sign(claims jwt.Claims) (string, error) {
+	key := m.keys.ActiveKey()
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
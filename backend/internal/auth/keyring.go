@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+	ErrNoActiveKey       = errors.New("active signing key is not in the keyring")
+)
+
+const minHMACSecretLength = 32
+
+// SigningKey is one key of the keyring, identified by the kid header of the
+// tokens it signs.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// NewHMACKey builds an HS256 key from a shared secret.
+func NewHMACKey(kid string, secret []byte) (SigningKey, error) {
+	if len(secret) == 0 {
+		return SigningKey{}, fmt.Errorf("signing key %s: empty secret", kid)
+	}
+	return SigningKey{ID: kid, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}, nil
+}
+
+// NewKeyFromPEM builds an asymmetric key from a PEM encoded private key.
+// Ed25519 keys sign with EdDSA, RSA keys of at least 2048 bits with RS256.
+func NewKeyFromPEM(kid string, data []byte) (SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return SigningKey{}, fmt.Errorf("signing key %s: no PEM block found", kid)
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return SigningKey{}, fmt.Errorf("signing key %s: unsupported PEM block %q", kid, block.Type)
+	}
+	if err != nil {
+		return SigningKey{}, fmt.Errorf("signing key %s: %w", kid, err)
+	}
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, signKey: key, verifyKey: key.Public()}, nil
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < 2048 {
+			return SigningKey{}, fmt.Errorf("signing key %s: RSA keys must have at least 2048 bits", kid)
+		}
+		return SigningKey{ID: kid, Method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey}, nil
+	default:
+		return SigningKey{}, fmt.Errorf("signing key %s: unsupported key type %T", kid, parsed)
+	}
+}
+
+// Keyring holds every key tokens may be verified with and designates the one
+// new tokens are signed with. Retired keys stay in the keyring until the
+// tokens they signed have expired.
+type Keyring struct {
+	keys       map[string]SigningKey
+	active     string
+	legacy     string
+	algorithms []string
+}
+
+// NewKeyring creates a keyring signing with the key identified by activeKID.
+// Tokens without a kid header, issued before keys were named, are verified
+// with the key identified by legacyKID when it is not empty.
+func NewKeyring(activeKID, legacyKID string, keys ...SigningKey) (Keyring, error) {
+	ring := Keyring{keys: make(map[string]SigningKey, len(keys)), active: activeKID, legacy: legacyKID}
+
+	algorithms := map[string]bool{}
+	for _, key := range keys {
+		if _, exists := ring.keys[key.ID]; exists {
+			return Keyring{}, fmt.Errorf("duplicate signing key %s", key.ID)
+		}
+		ring.keys[key.ID] = key
+		algorithms[key.Method.Alg()] = true
+	}
+
+	if _, ok := ring.keys[activeKID]; !ok {
+		return Keyring{}, ErrNoActiveKey
+	}
+	if legacyKID != "" {
+		if _, ok := ring.keys[legacyKID]; !ok {
+			return Keyring{}, fmt.Errorf("legacy signing key %s is not in the keyring", legacyKID)
+		}
+	}
+
+	for alg := range algorithms {
+		ring.algorithms = append(ring.algorithms, alg)
+	}
+	sort.Strings(ring.algorithms)
+
+	return ring, nil
+}
+
+// LoadKeyring reads every key stored in dir: <kid>.pem files hold Ed25519 or
+// RSA private keys and <kid>.secret files hold HMAC secrets. A non-empty
+// legacySecret is added as an HMAC key under legacyKID and verifies tokens
+// without a kid header. activeKID defaults to legacyKID.
+func LoadKeyring(dir, activeKID, legacySecret, legacyKID string) (Keyring, error) {
+	var keys []SigningKey
+
+	if legacySecret != "" {
+		key, err := NewHMACKey(legacyKID, []byte(legacySecret))
+		if err != nil {
+			return Keyring{}, err
+		}
+		keys = append(keys, key)
+	} else {
+		legacyKID = ""
+	}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return Keyring{}, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+
+			name := entry.Name()
+			ext := filepath.Ext(name)
+			kid := strings.TrimSuffix(name, ext)
+			if ext != ".pem" && ext != ".secret" {
+				continue
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				return Keyring{}, err
+			}
+
+			var key SigningKey
+			if ext == ".pem" {
+				key, err = NewKeyFromPEM(kid, data)
+			} else {
+				secret := []byte(strings.TrimSpace(string(data)))
+				if len(secret) < minHMACSecretLength {
+					return Keyring{}, fmt.Errorf("signing key %s: HMAC secrets must be at least %d bytes", kid, minHMACSecretLength)
+				}
+				key, err = NewHMACKey(kid, secret)
+			}
+			if err != nil {
+				return Keyring{}, err
+			}
+			keys = append(keys, key)
+		}
+	}
+
+	if activeKID == "" {
+		activeKID = legacyKID
+	}
+
+	return NewKeyring(activeKID, legacyKID, keys...)
+}
+
+// ActiveKey returns the key new tokens are signed with.
+func (k Keyring) ActiveKey() SigningKey {
+	return k.keys[k.active]
+}
+
+// Algorithms lists the signing algorithms accepted by the keyring.
+func (k Keyring) Algorithms() []string {
+	return k.algorithms
+}
+
+// keyFunc resolves the verification key of a token from its kid header and
+// refuses tokens whose algorithm does not match the key.
+func (k Keyring) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = k.legacy
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownSigningKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return key.verifyKey, nil
+}
+
+// JWK is the public part of an asymmetric signing key (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys of the keyring. HMAC secrets are never published.
+func (k Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		switch public := key.verifyKey.(type) {
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "OKP",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(public),
+			})
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		}
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
@@ -2,76 +2,147 @@ package auth
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/piggybank/backend/internal/common/response"
 	"github.com/piggybank/backend/internal/users"
 )
 
 type contextKey string
 
-const userContextKey contextKey = "authenticatedUser"
+const (
+	userContextKey     contextKey = "authenticatedUser"
+	sessionContextKey  contextKey = "authenticatedSession"
+	scopesContextKey   contextKey = "authenticatedScopes"
+	signInContextKey   contextKey = "authenticatedSignIn"
+	clientIPContextKey contextKey = "clientIP"
+)
+
+// sessionTouchInterval bounds how often a session's last-seen time is written.
+const sessionTouchInterval = time.Minute
+
+// ReauthenticationWindow is how long after signing in a session may perform
+// sensitive account changes without supplying the password again.
+const ReauthenticationWindow = 10 * time.Minute
 
-// Middleware validates JWT tokens and attaches the user to the request context.
+// Middleware validates JWT and personal access tokens and attaches the user to
+// the request context.
 type Middleware struct {
 	manager Manager
 	users   users.Repository
+	store   Store
 }
 
 // NewMiddleware constructs an auth middleware instance.
-func NewMiddleware(manager Manager, repo users.Repository) Middleware {
-	return Middleware{manager: manager, users: repo}
+func NewMiddleware(manager Manager, repo users.Repository, store Store) Middleware {
+	return Middleware{manager: manager, users: repo, store: store}
 }
 
 // Authenticate wraps handlers requiring a valid JWT token.
 func (m Middleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenString := extractToken(r.Header.Get("Authorization"))
-		if tokenString == "" {
-			response.Unauthorized(w, "missing authorization token")
-			return
-		}
-
-		claims, err := m.manager.Parse(tokenString)
-		if err != nil {
-			response.Unauthorized(w, "invalid token")
+		ctx, message := m.authenticate(r)
+		if message != "" {
+			response.Unauthorized(w, message)
 			return
 		}
 
-		user, err := m.users.GetByID(r.Context(), claims.UserID)
-		if err != nil {
-			response.Unauthorized(w, "user not found")
-			return
-		}
-
-		ctx := context.WithValue(r.Context(), userContextKey, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
 // GinAuthenticate is the Gin version of the authentication middleware.
 func (m Middleware) GinAuthenticate(c *gin.Context) {
-	tokenString := extractToken(c.GetHeader("Authorization"))
-	if tokenString == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing authorization token"})
+	ctx, message := m.authenticate(c.Request)
+	if message != "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
 		return
 	}
 
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// authenticate resolves the bearer token into an authenticated context. On
+// failure it returns the message to send back to the client.
+func (m Middleware) authenticate(r *http.Request) (context.Context, string) {
+	ctx := r.Context()
+	tokenString := extractToken(r.Header.Get("Authorization"))
+	if tokenString == "" {
+		return ctx, "missing authorization token"
+	}
+
+	if strings.HasPrefix(tokenString, personalAccessTokenPrefix) {
+		return m.authenticatePersonalAccessToken(ctx, tokenString)
+	}
+
 	claims, err := m.manager.Parse(tokenString)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
-		return
+		return ctx, "invalid token"
 	}
 
-	user, err := m.users.GetByID(c.Request.Context(), claims.UserID)
+	session, err := m.store.GetSession(ctx, claims.SessionID)
+	if err != nil || session.RevokedAt != nil || session.UserID != claims.UserID {
+		return ctx, "session revoked"
+	}
+
+	now := time.Now().UTC()
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		if err := m.store.TouchSession(ctx, session.ID, now, now.Add(-sessionTouchInterval), clientIP(r)); err != nil {
+			log.Printf("failed to update last seen time of session %s: %v", session.ID, err)
+		}
+	}
+
+	user, err := m.users.GetByID(ctx, claims.UserID)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
-		return
+		return ctx, "user not found"
+	}
+
+	ctx = context.WithValue(ctx, userContextKey, user)
+	ctx = context.WithValue(ctx, sessionContextKey, session.ID)
+	ctx = context.WithValue(ctx, signInContextKey, session.CreatedAt)
+	return ctx, ""
+}
+
+// authenticatePersonalAccessToken resolves a personal access token and records
+// its granted scopes in the context.
+func (m Middleware) authenticatePersonalAccessToken(ctx context.Context, tokenString string) (context.Context, string) {
+	token, err := m.store.GetPersonalAccessTokenByHash(ctx, hashToken(tokenString))
+	if err != nil {
+		return ctx, "invalid token"
+	}
+
+	now := time.Now().UTC()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return ctx, "token expired"
+	}
+
+	user, err := m.users.GetByID(ctx, token.UserID)
+	if err != nil {
+		return ctx, "user not found"
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= sessionTouchInterval {
+		if err := m.store.TouchPersonalAccessToken(ctx, token.ID, now, now.Add(-sessionTouchInterval)); err != nil {
+			log.Printf("failed to update last use of token %s: %v", token.ID, err)
+		}
 	}
 
-	ctx := context.WithValue(c.Request.Context(), userContextKey, user)
+	ctx = context.WithValue(ctx, userContextKey, user)
+	ctx = context.WithValue(ctx, scopesContextKey, token.Scopes)
+	return ctx, ""
+}
+
+// ResolveClientIP records the client address Gin derives from the connection
+// and the router's trusted proxies, so the net/http handlers wrapped by Gin see
+// the same address.
+func ResolveClientIP(c *gin.Context) {
+	ctx := context.WithValue(c.Request.Context(), clientIPContextKey, c.ClientIP())
 	c.Request = c.Request.WithContext(ctx)
 	c.Next()
 }
@@ -87,6 +158,20 @@ func UserFromContext(ctx context.Context) (users.User, bool) {
 	return user, ok
 }
 
+// SessionIDFromContext retrieves the session of the authenticated access token.
+func SessionIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	sessionID, ok := ctx.Value(sessionContextKey).(uuid.UUID)
+	return sessionID, ok
+}
+
+// RecentlyAuthenticated reports whether the request comes from a session
+// opened within ReauthenticationWindow, whatever sign-in method was used.
+// Personal access tokens never count as a recent sign-in.
+func RecentlyAuthenticated(ctx context.Context) bool {
+	signedInAt, ok := ctx.Value(signInContextKey).(time.Time)
+	return ok && time.Since(signedInAt) < ReauthenticationWindow
+}
+
 func extractToken(header string) string {
 	if header == "" {
 		return ""
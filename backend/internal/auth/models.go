@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/piggybank/backend/internal/users"
+)
+
+// Session groups every refresh token issued from a single login. Revoking a
+// session revokes the whole token family.
+type Session struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	DeviceLabel string
+	UserAgent   string
+	IPAddress   string
+	CreatedAt   time.Time
+	LastSeenAt  time.Time
+	RevokedAt   *time.Time
+}
+
+// ClientInfo describes the device that opens a session.
+type ClientInfo struct {
+	DeviceLabel string
+	UserAgent   string
+	IPAddress   string
+}
+
+// RefreshToken is a single-use token within a session. Only its hash is stored.
+type RefreshToken struct {
+	ID        uuid.UUID
+	SessionID uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RotatedAt *time.Time
+}
+
+// TokenPair is returned to clients after a successful authentication.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// PasswordResetToken is a single-use token emailed to recover an account.
+type PasswordResetToken struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	UsedAt    *time.Time
+}
+
+// MagicLinkToken is a hashed single-use sign-in link bound to an email
+// address. Links sent to invited addresses without an account carry the
+// invitation and the name to sign up with instead of a user.
+type MagicLinkToken struct {
+	ID              uuid.UUID
+	Email           string
+	UserID          *uuid.UUID
+	Name            *string
+	InvitationToken *string
+	TokenHash       string
+	ExpiresAt       time.Time
+	CreatedAt       time.Time
+	UsedAt          *time.Time
+}
+
+// TOTPSecret holds the shared secret of a user's authenticator app. Two-factor
+// authentication is enabled once the secret is confirmed with a first code.
+type TOTPSecret struct {
+	UserID       uuid.UUID
+	Secret       string
+	LastUsedStep int64
+	ConfirmedAt  *time.Time
+	CreatedAt    time.Time
+}
+
+// RecoveryCode is a hashed single-use fallback for a lost authenticator.
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// TOTPEnrollment is returned once when a user starts enrolling an authenticator.
+type TOTPEnrollment struct {
+	Secret        string
+	URI           string
+	RecoveryCodes []string
+}
+
+// LoginResult carries either a token pair or, when two-factor authentication
+// is enabled, the challenge token to exchange at /auth/login/2fa.
+type LoginResult struct {
+	User           users.User
+	Tokens         TokenPair
+	ChallengeToken string
+}
+
+const (
+	SecurityEventAccountLocked   = "account_locked"
+	SecurityEventTwoFactorLocked = "two_factor_locked"
+)
+
+// SecurityEvent is an audit record of a security relevant occurrence.
+type SecurityEvent struct {
+	ID        uuid.UUID
+	UserID    *uuid.UUID
+	EventType string
+	Email     *string
+	IPAddress *string
+	Details   *string
+	CreatedAt time.Time
+}
+
+// PersonalAccessToken is a long-lived, scoped credential for scripts and
+// integrations. Only the hash of the token is stored.
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// Identity links an account of an external OpenID Connect provider, identified
+// by the issuer's subject, to a user.
+type Identity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Provider    string
+	Subject     string
+	Email       *string
+	CreatedAt   time.Time
+	LastLoginAt *time.Time
+}
+
+// OIDCLoginState remembers an authorization request until the provider
+// redirects back. UserID is set when the request links an identity to an
+// existing account instead of signing in.
+type OIDCLoginState struct {
+	StateHash    string
+	Provider     string
+	UserID       *uuid.UUID
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+}
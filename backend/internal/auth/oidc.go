@@ -0,0 +1,409 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	ErrInvalidIDToken  = errors.New("invalid ID token")
+)
+
+const (
+	oidcHTTPTimeout = 10 * time.Second
+	// oidcKeysRefreshInterval bounds how often an unknown kid triggers a JWKS
+	// refetch, so forged tokens cannot make us hammer the issuer.
+	oidcKeysRefreshInterval = time.Minute
+	oidcClockSkew           = time.Minute
+)
+
+// oidcSigningMethods are the ID token algorithms accepted from issuers.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCConfig describes an OpenID Connect provider users can sign in with.
+type OIDCConfig struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCClaims are the ID token claims used to find or create the account.
+type OIDCClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+type oidcIDTokenClaims struct {
+	Nonce           string      `json:"nonce"`
+	Email           string      `json:"email"`
+	EmailVerified   interface{} `json:"email_verified"`
+	Name            string      `json:"name"`
+	AuthorizedParty string      `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// OIDCProvider is an OpenID Connect relying party for one issuer. Discovery
+// and the issuer keys are fetched lazily and cached.
+type OIDCProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider creates a provider. Plain HTTP issuers are accepted so a
+// local mock issuer can be used during development.
+func NewOIDCProvider(config OIDCConfig) *OIDCProvider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if config.DisplayName == "" {
+		config.DisplayName = config.Name
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &OIDCProvider{config: config, client: &http.Client{Timeout: oidcHTTPTimeout}}
+}
+
+// Name returns the identifier of the provider used in URLs and identities.
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+// DisplayName returns the label shown on sign-in buttons.
+func (p *OIDCProvider) DisplayName() string {
+	return p.config.DisplayName
+}
+
+// AuthorizationURL builds the authorization code request with PKCE (S256).
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token
+// claims. The nonce must match the one sent with the authorization request.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (OIDCClaims, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("token request to %s: %w", p.config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var token oidcTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return OIDCClaims{}, fmt.Errorf("token response from %s: %w", p.config.Name, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return OIDCClaims{}, fmt.Errorf("%w: %s", ErrInvalidOIDCCode, strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+	}
+	if token.IDToken == "" {
+		return OIDCClaims{}, ErrInvalidIDToken
+	}
+
+	return p.verifyIDToken(ctx, discovery.Issuer, token.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature against the issuer keys and validates
+// issuer, audience, expiry and nonce.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, issuer, rawToken, nonce string) (OIDCClaims, error) {
+	token, err := jwt.ParseWithClaims(rawToken, &oidcIDTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcClockSkew),
+	)
+	if err != nil {
+		return OIDCClaims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	claims, ok := token.Claims.(*oidcIDTokenClaims)
+	if !ok || !token.Valid || claims.Subject == "" {
+		return OIDCClaims{}, ErrInvalidIDToken
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return OIDCClaims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != p.config.ClientID {
+		return OIDCClaims{}, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	}
+
+	verified := false
+	switch value := claims.EmailVerified.(type) {
+	case bool:
+		verified = value
+	case string:
+		verified = strings.EqualFold(value, "true")
+	}
+
+	return OIDCClaims{
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(strings.TrimSpace(claims.Email)),
+		EmailVerified: verified,
+		Name:          strings.TrimSpace(claims.Name),
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("discovery of %s returned issuer %q", p.config.Name, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery of %s is missing endpoints", p.config.Name)
+	}
+
+	p.discovery = &discovery
+	return p.discovery, nil
+}
+
+// key returns the issuer key with the given kid, refetching the key set when
+// the kid is unknown, e.g. after the issuer rotated its keys.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (interface{}, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval {
+		return nil, ErrUnknownSigningKey
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, raw := range set.Keys {
+		id, key, err := parseJWK(raw)
+		if err != nil {
+			// Skip keys we cannot use, such as encryption keys.
+			continue
+		}
+		keys[id] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// lookupKey finds a cached key. Tokens without kid are accepted when the
+// issuer publishes a single key.
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s: %w", p.config.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s returned %s", endpoint, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(target)
+}
+
+// parseJWK converts a public JSON Web Key into a verification key.
+func parseJWK(raw json.RawMessage) (string, interface{}, error) {
+	var jwk struct {
+		KeyType string `json:"kty"`
+		KeyID   string `json:"kid"`
+		Use     string `json:"use"`
+		Curve   string `json:"crv"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+		X       string `json:"x"`
+		Y       string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, errors.New("not a signing key")
+	}
+
+	decode := base64.RawURLEncoding.DecodeString
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31 {
+			return "", nil, errors.New("invalid RSA exponent")
+		}
+		return jwk.KeyID, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return "", nil, errors.New("EC point is not on the curve")
+		}
+		return jwk.KeyID, key, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return "", nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return "", nil, errors.New("invalid Ed25519 key")
+		}
+		return jwk.KeyID, ed25519.PublicKey(x), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+	}
+}
@@ -0,0 +1,532 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/piggybank/backend/internal/users"
+)
+
+const testClientID = "piggybank-test"
+
+// mockIssuer is a minimal OpenID provider: discovery, JWKS and a token
+// endpoint redeeming codes registered with authorize.
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// advertised overrides the issuer named in the discovery document.
+	advertised string
+
+	mu    sync.Mutex
+	codes map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{t: t, key: key, codes: map[string]mockGrant{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := m.server.URL
+		if m.advertised != "" {
+			issuer = m.advertised
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test-key",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: "https://piggybank.test/auth/oidc/mock/callback",
+	})
+}
+
+// authorize plays the user consenting at the authorization URL: it registers
+// a code bound to the PKCE challenge and returns it with the state. claims
+// are the ID token claims; nonce, iss, aud and times default to the request.
+func (m *mockIssuer) authorize(authURL string, claims jwt.MapClaims) (code, state string) {
+	m.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		m.t.Fatalf("authorization URL without S256 PKCE: %s", authURL)
+	}
+	if q.Get("client_id") != testClientID || q.Get("response_type") != "code" {
+		m.t.Fatalf("unexpected authorization request: %s", authURL)
+	}
+
+	now := time.Now()
+	defaults := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   testClientID,
+		"nonce": q.Get("nonce"),
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		defaults[k] = v
+	}
+
+	code = uuid.NewString()
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: q.Get("code_challenge"), claims: defaults}
+	m.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, grant.claims)
+	token.Header["kid"] = "test-key"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	issuer := newMockIssuer(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		claims   jwt.MapClaims
+		nonce    string
+		verifier string
+		wantErr  error
+	}{
+		{name: "valid", claims: jwt.MapClaims{"sub": "alice", "email": "Alice@Example.com", "email_verified": true}},
+		{name: "email verified as string", claims: jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": "true"}},
+		{name: "wrong issuer", claims: jwt.MapClaims{"sub": "alice", "iss": "https://evil.test"}, wantErr: ErrInvalidIDToken},
+		{name: "wrong audience", claims: jwt.MapClaims{"sub": "alice", "aud": "someone-else"}, wantErr: ErrInvalidIDToken},
+		{name: "wrong nonce", claims: jwt.MapClaims{"sub": "alice"}, nonce: "other", wantErr: ErrInvalidIDToken},
+		{name: "expired", claims: jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-time.Hour).Unix()}, wantErr: ErrInvalidIDToken},
+		{name: "without subject", claims: jwt.MapClaims{}, wantErr: ErrInvalidIDToken},
+		{name: "wrong PKCE verifier", claims: jwt.MapClaims{"sub": "alice"}, verifier: "guessed", wantErr: ErrInvalidOIDCCode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := issuer.provider()
+			authURL, err := provider.AuthorizationURL(ctx, "state", "nonce", "verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			code, state := issuer.authorize(authURL, tt.claims)
+			if state != "state" {
+				t.Fatalf("state = %q, want %q", state, "state")
+			}
+
+			nonce, verifier := "nonce", "verifier"
+			if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			if tt.verifier != "" {
+				verifier = tt.verifier
+			}
+			claims, err := provider.Exchange(ctx, code, verifier, nonce)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := OIDCClaims{Subject: "alice", Email: "alice@example.com", EmailVerified: true}
+			if claims != want {
+				t.Fatalf("claims = %+v, want %+v", claims, want)
+			}
+		})
+	}
+}
+
+func TestOIDCProviderRejectsForeignSignature(t *testing.T) {
+	issuer := newMockIssuer(t)
+	ctx := context.Background()
+	provider := issuer.provider()
+
+	authURL, err := provider.AuthorizationURL(ctx, "state", "nonce", "verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := issuer.authorize(authURL, jwt.MapClaims{"sub": "alice"})
+
+	// Sign with a key the issuer does not publish.
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.key = forger
+
+	if _, err := provider.Exchange(ctx, code, "verifier", "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestOIDCProviderDiscoveryIssuerMismatch(t *testing.T) {
+	issuer := newMockIssuer(t)
+	provider := NewOIDCProvider(OIDCConfig{Name: "mock", Issuer: issuer.server.URL + "/other", ClientID: testClientID})
+	// The discovery document lives at the issuer URL only.
+	if _, err := provider.AuthorizationURL(context.Background(), "s", "n", "v"); err == nil {
+		t.Fatal("expected discovery to fail")
+	}
+
+	issuer.advertised = "https://evil.test"
+	provider = issuer.provider()
+	if _, err := provider.AuthorizationURL(context.Background(), "s", "n", "v"); err == nil || !strings.Contains(err.Error(), "returned issuer") {
+		t.Fatalf("err = %v, want an issuer mismatch", err)
+	}
+}
+
+// memoryIdentities is an in-memory IdentityStore.
+type memoryIdentities struct {
+	states     map[string]OIDCLoginState
+	identities map[string]Identity
+}
+
+func newMemoryIdentities() *memoryIdentities {
+	return &memoryIdentities{states: map[string]OIDCLoginState{}, identities: map[string]Identity{}}
+}
+
+func (m *memoryIdentities) CreateOIDCLoginState(ctx context.Context, state OIDCLoginState) error {
+	m.states[state.StateHash] = state
+	return nil
+}
+
+func (m *memoryIdentities) ConsumeOIDCLoginState(ctx context.Context, stateHash string, now time.Time) (OIDCLoginState, error) {
+	state, ok := m.states[stateHash]
+	if !ok {
+		return OIDCLoginState{}, ErrNotFound
+	}
+	delete(m.states, stateHash)
+	return state, nil
+}
+
+func (m *memoryIdentities) GetIdentity(ctx context.Context, provider, subject string) (Identity, error) {
+	identity, ok := m.identities[provider+"|"+subject]
+	if !ok {
+		return Identity{}, ErrNotFound
+	}
+	return identity, nil
+}
+
+func (m *memoryIdentities) CreateIdentity(ctx context.Context, identity Identity) error {
+	key := identity.Provider + "|" + identity.Subject
+	if _, ok := m.identities[key]; ok {
+		return ErrIdentityLinked
+	}
+	for _, other := range m.identities {
+		if other.UserID == identity.UserID && other.Provider == identity.Provider {
+			return ErrIdentityLinked
+		}
+	}
+	m.identities[key] = identity
+	return nil
+}
+
+func (m *memoryIdentities) TouchIdentity(ctx context.Context, id uuid.UUID, email *string, loginAt time.Time) error {
+	for key, identity := range m.identities {
+		if identity.ID == id {
+			identity.Email = email
+			identity.LastLoginAt = &loginAt
+			m.identities[key] = identity
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// memoryUsers is an in-memory users.Repository.
+type memoryUsers map[uuid.UUID]users.User
+
+func (m memoryUsers) Create(ctx context.Context, user users.User) error {
+	if _, err := m.GetByEmail(ctx, user.Email); err == nil {
+		return users.ErrEmailTaken
+	}
+	m[user.ID] = user
+	return nil
+}
+
+func (m memoryUsers) GetByEmail(ctx context.Context, email string) (users.User, error) {
+	for _, user := range m {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return users.User{}, users.ErrNotFound
+}
+
+func (m memoryUsers) GetByID(ctx context.Context, id uuid.UUID) (users.User, error) {
+	user, ok := m[id]
+	if !ok {
+		return users.User{}, users.ErrNotFound
+	}
+	return user, nil
+}
+
+func (m memoryUsers) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string, updatedAt time.Time) error {
+	return nil
+}
+
+func (m memoryUsers) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string, verifiedAt time.Time) error {
+	return nil
+}
+
+func (m memoryUsers) UpdateName(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time) error {
+	return nil
+}
+
+func (m memoryUsers) UpdateEmail(ctx context.Context, id uuid.UUID, email string, updatedAt time.Time) error {
+	return nil
+}
+
+func newOIDCTestService(issuer *mockIssuer) (Service, memoryUsers, *memoryIdentities) {
+	repo := memoryUsers{}
+	identities := newMemoryIdentities()
+	return Service{users: repo, identities: identities, providers: []*OIDCProvider{issuer.provider()}}, repo, identities
+}
+
+// signIn runs the login flow up to resolving the account.
+func signIn(t *testing.T, s Service, issuer *mockIssuer, claims jwt.MapClaims) (users.User, error) {
+	t.Helper()
+	ctx := context.Background()
+	authURL, err := s.StartOIDCLogin(ctx, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := issuer.authorize(authURL, claims)
+	oidcClaims, err := s.finishOIDC(ctx, "mock", code, state, nil)
+	if err != nil {
+		return users.User{}, err
+	}
+	return s.oidcAccount(ctx, "mock", oidcClaims, time.Now().UTC())
+}
+
+func TestOIDCSignInCreatesAccount(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s, repo, identities := newOIDCTestService(issuer)
+
+	user, err := signIn(t, s, issuer, jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true, "name": "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "alice@example.com" || user.Name != "Alice" || user.EmailVerifiedAt == nil {
+		t.Fatalf("unexpected account %+v", user)
+	}
+	if _, ok := repo[user.ID]; !ok {
+		t.Fatal("account was not stored")
+	}
+	identity, err := identities.GetIdentity(context.Background(), "mock", "alice")
+	if err != nil || identity.UserID != user.ID {
+		t.Fatalf("identity = %+v, %v; want one linked to %s", identity, err, user.ID)
+	}
+
+	// Signing in again reaches the same account.
+	again, err := signIn(t, s, issuer, jwt.MapClaims{"sub": "alice", "email": "alice@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID || len(repo) != 1 {
+		t.Fatalf("signed in to %s with %d accounts, want %s with 1", again.ID, len(repo), user.ID)
+	}
+	identity, _ = identities.GetIdentity(context.Background(), "mock", "alice")
+	if identity.LastLoginAt == nil {
+		t.Fatal("sign-in was not recorded on the identity")
+	}
+}
+
+func TestOIDCAccountConfirmsChangesWithRecentSignIn(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s, _, _ := newOIDCTestService(issuer)
+
+	user, err := signIn(t, s, issuer, jwt.MapClaims{"sub": "erin", "email": "erin@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nobody knows the random password of an account created through OIDC.
+	if err := confirmPassword(context.Background(), user, ""); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidPassword)
+	}
+
+	stale := context.WithValue(context.Background(), signInContextKey, time.Now().Add(-ReauthenticationWindow))
+	if err := confirmPassword(stale, user, ""); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("err = %v, want %v for a stale sign-in", err, ErrInvalidPassword)
+	}
+
+	fresh := context.WithValue(context.Background(), signInContextKey, time.Now().Add(-time.Minute))
+	if err := confirmPassword(fresh, user, ""); err != nil {
+		t.Fatalf("err = %v, want a recent sign-in to stand in for the password", err)
+	}
+	if err := confirmPassword(fresh, user, "guess"); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("err = %v, want a wrong password to be refused even after a recent sign-in", err)
+	}
+}
+
+func TestOIDCSignInRefusesUnverifiedOrTakenEmail(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s, repo, identities := newOIDCTestService(issuer)
+
+	if _, err := signIn(t, s, issuer, jwt.MapClaims{"sub": "bob", "email": "bob@example.com", "email_verified": false}); !errors.Is(err, ErrOIDCEmailNotVerified) {
+		t.Fatalf("err = %v, want %v", err, ErrOIDCEmailNotVerified)
+	}
+
+	existing := users.User{ID: uuid.New(), Email: "carol@example.com", Name: "Carol"}
+	repo[existing.ID] = existing
+	if _, err := signIn(t, s, issuer, jwt.MapClaims{"sub": "carol", "email": "carol@example.com", "email_verified": true}); !errors.Is(err, ErrOIDCAccountExists) {
+		t.Fatalf("err = %v, want %v", err, ErrOIDCAccountExists)
+	}
+	if len(identities.identities) != 0 || len(repo) != 1 {
+		t.Fatalf("refused sign-ins left %d identities and %d accounts", len(identities.identities), len(repo))
+	}
+}
+
+func TestOIDCLinkIdentity(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s, repo, _ := newOIDCTestService(issuer)
+	ctx := context.Background()
+
+	carol := users.User{ID: uuid.New(), Email: "carol@example.com", Name: "Carol"}
+	repo[carol.ID] = carol
+
+	authURL, err := s.StartOIDCLink(ctx, carol, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := issuer.authorize(authURL, jwt.MapClaims{"sub": "carol", "email": "carol@example.com", "email_verified": true})
+	identity, err := s.CompleteOIDCLink(ctx, carol, "mock", code, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.UserID != carol.ID || identity.Subject != "carol" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	// The linked identity now signs in to Carol's account.
+	user, err := signIn(t, s, issuer, jwt.MapClaims{"sub": "carol", "email": "carol@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != carol.ID {
+		t.Fatalf("signed in to %s, want %s", user.ID, carol.ID)
+	}
+
+	// The same identity cannot be linked to another account.
+	dave := users.User{ID: uuid.New(), Email: "dave@example.com", Name: "Dave"}
+	repo[dave.ID] = dave
+	authURL, err = s.StartOIDCLink(ctx, dave, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state = issuer.authorize(authURL, jwt.MapClaims{"sub": "carol"})
+	if _, err := s.CompleteOIDCLink(ctx, dave, "mock", code, state); !errors.Is(err, ErrIdentityLinked) {
+		t.Fatalf("err = %v, want %v", err, ErrIdentityLinked)
+	}
+}
+
+func TestOIDCStateIsBoundToItsFlow(t *testing.T) {
+	issuer := newMockIssuer(t)
+	s, repo, _ := newOIDCTestService(issuer)
+	ctx := context.Background()
+
+	carol := users.User{ID: uuid.New(), Email: "carol@example.com", Name: "Carol"}
+	dave := users.User{ID: uuid.New(), Email: "dave@example.com", Name: "Dave"}
+	repo[carol.ID], repo[dave.ID] = carol, dave
+	claims := jwt.MapClaims{"sub": "carol"}
+
+	// A login state cannot complete a link.
+	authURL, err := s.StartOIDCLogin(ctx, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := issuer.authorize(authURL, claims)
+	if _, err := s.CompleteOIDCLink(ctx, carol, "mock", code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidOIDCState)
+	}
+
+	// A link started by Carol cannot be completed by Dave.
+	authURL, err = s.StartOIDCLink(ctx, carol, "mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state = issuer.authorize(authURL, claims)
+	if _, err := s.CompleteOIDCLink(ctx, dave, "mock", code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidOIDCState)
+	}
+
+	// A state is consumed by its first use, even a failed one.
+	if _, err := s.CompleteOIDCLink(ctx, carol, "mock", code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
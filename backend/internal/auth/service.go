@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"errors"
+	"log"
 	"net/mail"
 	"strings"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/piggybank/backend/internal/common/email"
 	"github.com/piggybank/backend/internal/users"
 )
 
@@ -20,45 +22,135 @@ var (
 	ErrNameRequired           = errors.New("name is required")
 	ErrEmailAlreadyRegistered = errors.New("email already registered")
 	ErrInvalidCredentials     = errors.New("invalid credentials")
+	ErrInvalidRefreshToken    = errors.New("invalid refresh token")
+	ErrRefreshTokenReused     = errors.New("refresh token reuse detected")
+	ErrInvalidResetToken      = errors.New("invalid or expired reset token")
+	ErrInvalidVerifyToken     = errors.New("invalid or expired verification token")
+	ErrEmailAlreadyVerified   = errors.New("email already verified")
+	ErrInvalidPassword        = errors.New("current password is incorrect")
+	ErrSameEmail              = errors.New("new email matches the current one")
+	ErrInvalidEmailChange     = errors.New("invalid or expired email change token")
+	ErrInvalidTwoFactorCode   = errors.New("invalid two-factor code")
+	ErrInvalidChallenge       = errors.New("invalid or expired two-factor challenge")
+	ErrTwoFactorEnabled       = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled    = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotEnrolled   = errors.New("start two-factor enrolment first")
+	ErrSessionNotFound        = errors.New("session not found")
+	ErrTokenNameRequired      = errors.New("token name is required")
+	ErrScopesRequired         = errors.New("at least one scope is required")
+	ErrInvalidScope           = errors.New("unknown scope")
+	ErrInvalidTokenExpiry     = errors.New("token expiry must be in the future")
+	ErrTokenNotFound          = errors.New("token not found")
+	ErrInvalidMagicLink       = errors.New("invalid or expired sign-in link")
+	ErrInvalidOIDCState       = errors.New("invalid or expired sign-in state")
+	ErrInvalidOIDCCode        = errors.New("identity provider rejected the authorization code")
+	ErrOIDCEmailNotVerified   = errors.New("identity provider did not return a verified email")
+	ErrOIDCAccountExists      = errors.New("an account with this email already exists; sign in and link the provider instead")
+	ErrIdentityLinked         = errors.New("identity is already linked")
+	ErrIdentityNotFound       = errors.New("identity not found")
 )
 
+const (
+	passwordResetTTL    = time.Hour
+	passwordResetWindow = time.Hour
+	passwordResetLimit  = 3
+
+	emailVerificationAudience = "email-verification"
+	emailVerificationTTL      = 48 * time.Hour
+
+	emailChangeAudience = "email-change"
+	emailChangeTTL      = 24 * time.Hour
+
+	twoFactorChallengeAudience = "2fa-challenge"
+	twoFactorChallengeTTL      = 5 * time.Minute
+
+	// personalAccessTokenPrefix lets the middleware tell personal access
+	// tokens from JWTs and makes leaked tokens easy to scan for.
+	personalAccessTokenPrefix  = "pbpat_"
+	personalAccessTokenNameMax = 100
+
+	magicLinkTTL    = 15 * time.Minute
+	magicLinkWindow = time.Hour
+	magicLinkLimit  = 5
+
+	oidcStateTTL = 10 * time.Minute
+)
+
+// dummyPasswordHash is compared against when the email is unknown so that both
+// failure paths take the same time.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("piggybank-timing-equaliser"), bcrypt.DefaultCost)
+
+// Invitations lets people invited to a couple sign up through a magic link.
+// It is implemented by couples.Service.
+type Invitations interface {
+	CheckInvitation(ctx context.Context, token, email string) error
+	ClaimInvitation(ctx context.Context, token, email string, userID uuid.UUID) error
+}
+
+// IdentityStore persists external identities and the OIDC sign-ins awaiting
+// the provider's redirect. Store implements it.
+type IdentityStore interface {
+	CreateOIDCLoginState(ctx context.Context, state OIDCLoginState) error
+	ConsumeOIDCLoginState(ctx context.Context, stateHash string, now time.Time) (OIDCLoginState, error)
+	GetIdentity(ctx context.Context, provider, subject string) (Identity, error)
+	CreateIdentity(ctx context.Context, identity Identity) error
+	TouchIdentity(ctx context.Context, id uuid.UUID, email *string, loginAt time.Time) error
+}
+
 // Service encapsulates the business logic for authentication.
 type Service struct {
-	users      users.Repository
-	jwtManager Manager
+	users       users.Repository
+	store       Store
+	identities  IdentityStore
+	attempts    AttemptStore
+	jwtManager  Manager
+	emailSender *email.Service
+	invitations Invitations
+	providers   []*OIDCProvider
+	refreshTTL  time.Duration
 }
 
 // NewService constructs a Service instance.
-func NewService(repo users.Repository, manager Manager) Service {
-	return Service{users: repo, jwtManager: manager}
+func NewService(repo users.Repository, store Store, attempts AttemptStore, manager Manager, emailSender *email.Service, invitations Invitations, providers []*OIDCProvider, refreshTTL time.Duration) Service {
+	return Service{
+		users:       repo,
+		store:       store,
+		identities:  store,
+		attempts:    attempts,
+		jwtManager:  manager,
+		emailSender: emailSender,
+		invitations: invitations,
+		providers:   providers,
+		refreshTTL:  refreshTTL,
+	}
 }
 
-// Register registers a new user and returns a signed JWT.
-func (s Service) Register(ctx context.Context, email, password, name string) (users.User, string, error) {
+// Register registers a new user and returns a fresh token pair.
+func (s Service) Register(ctx context.Context, email, password, name string, client ClientInfo) (users.User, TokenPair, error) {
 	if err := validateEmail(email); err != nil {
-		return users.User{}, "", err
+		return users.User{}, TokenPair{}, err
 	}
 
 	if err := validatePassword(password); err != nil {
-		return users.User{}, "", err
+		return users.User{}, TokenPair{}, err
 	}
 
 	email = strings.ToLower(strings.TrimSpace(email))
 	name = strings.TrimSpace(name)
 
 	if name == "" {
-		return users.User{}, "", ErrNameRequired
+		return users.User{}, TokenPair{}, ErrNameRequired
 	}
 
 	if _, err := s.users.GetByEmail(ctx, email); err == nil {
-		return users.User{}, "", ErrEmailAlreadyRegistered
+		return users.User{}, TokenPair{}, ErrEmailAlreadyRegistered
 	} else if !errors.Is(err, users.ErrNotFound) {
-		return users.User{}, "", err
+		return users.User{}, TokenPair{}, err
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return users.User{}, "", err
+		return users.User{}, TokenPair{}, err
 	}
 
 	now := time.Now().UTC()
@@ -72,44 +164,1293 @@ func (s Service) Register(ctx context.Context, email, password, name string) (us
 	}
 
 	if err := s.users.Create(ctx, user); err != nil {
-		return users.User{}, "", err
+		return users.User{}, TokenPair{}, err
+	}
+
+	if err := s.sendEmailVerification(user); err != nil {
+		log.Printf("failed to issue verification email for user %s: %v", user.ID, err)
 	}
 
-	
-	token, err := s.jwtManager.GenerateAccessToken(user.ID)
+	tokens, err := s.startSession(ctx, user.ID, client)
 	if err != nil {
-		return users.User{}, "", err
+		return users.User{}, TokenPair{}, err
 	}
 
-	return user, token, nil
+	return user, tokens, nil
 }
 
-// Login validates credentials and returns a signed JWT.
-func (s Service) Login(ctx context.Context, email, password string) (users.User, string, error) {
+// Login validates credentials. It returns a fresh token pair, or only a
+// challenge token when the user enabled two-factor authentication. Failed
+// attempts are throttled per email address and per client IP.
+func (s Service) Login(ctx context.Context, email, password string, client ClientInfo) (LoginResult, error) {
 	if err := validateEmail(email); err != nil {
-		return users.User{}, "", err
+		return LoginResult{}, err
 	}
 
 	email = strings.ToLower(strings.TrimSpace(email))
+	emailKey := emailAttemptKey(email)
+	ipKey := ipAttemptKey(client.IPAddress)
+	now := time.Now().UTC()
+
+	if err := s.checkAttempts(ctx, now, emailKey, ipKey); err != nil {
+		return LoginResult{}, err
+	}
 
 	user, err := s.users.GetByEmail(ctx, email)
 	if err != nil {
 		if errors.Is(err, users.ErrNotFound) {
-			return users.User{}, "", ErrInvalidCredentials
+			// Still hash so unknown addresses cost as much as wrong passwords.
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+			return LoginResult{}, s.loginFailed(ctx, nil, email, client.IPAddress, now)
 		}
-		return users.User{}, "", err
+		return LoginResult{}, err
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
-		return users.User{}, "", ErrInvalidCredentials
+		return LoginResult{}, s.loginFailed(ctx, &user.ID, email, client.IPAddress, now)
+	}
+
+	if err := s.attempts.Reset(ctx, emailKey); err != nil {
+		return LoginResult{}, err
+	}
+
+	enabled, err := s.twoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if enabled {
+		challenge, err := s.jwtManager.GenerateActionToken(twoFactorChallengeAudience, user.ID, user.Email, twoFactorChallengeTTL)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{User: user, ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := s.startSession(ctx, user.ID, client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return LoginResult{User: user, Tokens: tokens}, nil
+}
+
+// CompleteTwoFactorLogin exchanges a login challenge and a TOTP or recovery
+// code for a fresh token pair. Wrong codes are throttled per user.
+func (s Service) CompleteTwoFactorLogin(ctx context.Context, challenge, code string, client ClientInfo) (users.User, TokenPair, error) {
+	claims, err := s.jwtManager.ParseActionToken(twoFactorChallengeAudience, challenge)
+	if err != nil {
+		return users.User{}, TokenPair{}, ErrInvalidChallenge
+	}
+
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			return users.User{}, TokenPair{}, ErrInvalidChallenge
+		}
+		return users.User{}, TokenPair{}, err
+	}
+
+	key := twoFactorAttemptKey(user.ID.String())
+	now := time.Now().UTC()
+	if err := s.checkAttempts(ctx, now, key); err != nil {
+		return users.User{}, TokenPair{}, err
+	}
+
+	if err := s.verifySecondFactor(ctx, user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			locked, recordErr := s.recordFailure(ctx, key, twoFactorAttemptPolicy, now)
+			if recordErr != nil {
+				return users.User{}, TokenPair{}, recordErr
+			}
+			if locked {
+				s.recordSecurityEvent(ctx, SecurityEventTwoFactorLocked, &user.ID, user.Email, client.IPAddress, now)
+			}
+		}
+		return users.User{}, TokenPair{}, err
+	}
+
+	if err := s.attempts.Reset(ctx, key); err != nil {
+		return users.User{}, TokenPair{}, err
+	}
+
+	tokens, err := s.startSession(ctx, user.ID, client)
+	if err != nil {
+		return users.User{}, TokenPair{}, err
+	}
+
+	return user, tokens, nil
+}
+
+// RequestMagicLink emails a single-use sign-in link. An address without an
+// account only receives a link together with a pending couple invitation sent
+// to it; following that link creates the account with the given name. Unknown
+// addresses and requests above the per-address limit are silently dropped so
+// callers cannot probe for accounts.
+func (s Service) RequestMagicLink(ctx context.Context, emailAddress, name, invitationToken string) error {
+	if err := validateEmail(emailAddress); err != nil {
+		return err
+	}
+
+	emailAddress = strings.ToLower(strings.TrimSpace(emailAddress))
+	name = strings.TrimSpace(name)
+	invitationToken = strings.TrimSpace(invitationToken)
+	if invitationToken != "" && name == "" {
+		return ErrNameRequired
+	}
+
+	now := time.Now().UTC()
+
+	recent, err := s.store.CountMagicLinkTokensSince(ctx, emailAddress, now.Add(-magicLinkWindow))
+	if err != nil {
+		return err
+	}
+	if recent >= magicLinkLimit {
+		log.Printf("magic link throttled for %s", emailAddress)
+		return nil
+	}
+
+	token := MagicLinkToken{
+		ID:        uuid.New(),
+		Email:     emailAddress,
+		ExpiresAt: now.Add(magicLinkTTL),
+		CreatedAt: now,
+	}
+	recipientName := name
+
+	user, err := s.users.GetByEmail(ctx, emailAddress)
+	switch {
+	case err == nil:
+		token.UserID = &user.ID
+		recipientName = user.Name
+	case errors.Is(err, users.ErrNotFound):
+		if invitationToken == "" || s.invitations == nil {
+			return nil
+		}
+		if err := s.invitations.CheckInvitation(ctx, invitationToken, emailAddress); err != nil {
+			log.Printf("magic link sign-up refused for %s: %v", emailAddress, err)
+			return nil
+		}
+		token.Name = &name
+		token.InvitationToken = &invitationToken
+	default:
+		return err
+	}
+
+	rawToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+	token.TokenHash = hashToken(rawToken)
+
+	if err := s.store.CreateMagicLinkToken(ctx, token); err != nil {
+		return err
+	}
+
+	if s.emailSender != nil {
+		go func() {
+			if err := s.emailSender.SendMagicLink(emailAddress, recipientName, rawToken, magicLinkTTL); err != nil {
+				log.Printf("failed to send magic link to %s: %v", emailAddress, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// ConsumeMagicLink signs in with a magic link, creating the account first when
+// the link finishes an invited sign-up. Like Login it only returns a
+// challenge token when two-factor authentication is enabled.
+func (s Service) ConsumeMagicLink(ctx context.Context, rawToken string, client ClientInfo) (LoginResult, error) {
+	token, err := s.store.GetMagicLinkTokenByHash(ctx, hashToken(rawToken))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return LoginResult{}, ErrInvalidMagicLink
+		}
+		return LoginResult{}, err
+	}
+
+	now := time.Now().UTC()
+	if token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return LoginResult{}, ErrInvalidMagicLink
+	}
+
+	if err := s.store.ConsumeMagicLinkToken(ctx, token, now); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return LoginResult{}, ErrInvalidMagicLink
+		}
+		return LoginResult{}, err
+	}
+
+	var user users.User
+	if token.UserID != nil {
+		user, err = s.users.GetByID(ctx, *token.UserID)
+		if err != nil {
+			if errors.Is(err, users.ErrNotFound) {
+				return LoginResult{}, ErrInvalidMagicLink
+			}
+			return LoginResult{}, err
+		}
+		// The link is bound to the address it was sent to.
+		if user.Email != token.Email {
+			return LoginResult{}, ErrInvalidMagicLink
+		}
+	} else {
+		user, err = s.signUpInvited(ctx, token, now)
+		if err != nil {
+			return LoginResult{}, err
+		}
+	}
+
+	// Following the link proves ownership of the address.
+	if user.EmailVerifiedAt == nil {
+		user, err = s.MarkEmailVerified(ctx, user)
+		if err != nil {
+			return LoginResult{}, err
+		}
+	}
+
+	enabled, err := s.twoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if enabled {
+		challenge, err := s.jwtManager.GenerateActionToken(twoFactorChallengeAudience, user.ID, user.Email, twoFactorChallengeTTL)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{User: user, ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := s.startSession(ctx, user.ID, client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return LoginResult{User: user, Tokens: tokens}, nil
+}
+
+// signUpInvited creates the account of an invited address from a magic link
+// and attaches it to the invitation. The account has no usable password until
+// the user sets one through the password reset flow.
+func (s Service) signUpInvited(ctx context.Context, token MagicLinkToken, now time.Time) (users.User, error) {
+	if token.InvitationToken == nil || token.Name == nil || s.invitations == nil {
+		return users.User{}, ErrInvalidMagicLink
+	}
+
+	if _, err := s.users.GetByEmail(ctx, token.Email); err == nil {
+		return users.User{}, ErrEmailAlreadyRegistered
+	} else if !errors.Is(err, users.ErrNotFound) {
+		return users.User{}, err
+	}
+
+	unusable, err := generateToken()
+	if err != nil {
+		return users.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(unusable), bcrypt.DefaultCost)
+	if err != nil {
+		return users.User{}, err
+	}
+
+	user := users.User{
+		ID:           uuid.New(),
+		Email:        token.Email,
+		PasswordHash: string(hash),
+		Name:         *token.Name,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := s.users.Create(ctx, user); err != nil {
+		return users.User{}, err
+	}
+
+	if err := s.invitations.ClaimInvitation(ctx, *token.InvitationToken, token.Email, user.ID); err != nil {
+		log.Printf("failed to attach invitation to new user %s: %v", user.ID, err)
+	}
+
+	return user, nil
+}
+
+// OIDCProviders returns the configured identity providers.
+func (s Service) OIDCProviders() []*OIDCProvider {
+	return s.providers
+}
+
+// StartOIDCLogin returns the provider URL to send the user to for signing in.
+func (s Service) StartOIDCLogin(ctx context.Context, providerName string) (string, error) {
+	return s.startOIDC(ctx, providerName, nil)
+}
+
+// CompleteOIDCLogin signs in with the code the provider redirected back with.
+// Known identities sign in to their linked account. Unknown ones create a new
+// account from the verified email, unless that email already has an account:
+// its owner has to sign in and link the provider first.
+func (s Service) CompleteOIDCLogin(ctx context.Context, providerName, code, state string, client ClientInfo) (LoginResult, error) {
+	claims, err := s.finishOIDC(ctx, providerName, code, state, nil)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	user, err := s.oidcAccount(ctx, providerName, claims, time.Now().UTC())
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	enabled, err := s.twoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return LoginResult{}, err
+	}
+	if enabled {
+		challenge, err := s.jwtManager.GenerateActionToken(twoFactorChallengeAudience, user.ID, user.Email, twoFactorChallengeTTL)
+		if err != nil {
+			return LoginResult{}, err
+		}
+		return LoginResult{User: user, ChallengeToken: challenge}, nil
+	}
+
+	tokens, err := s.startSession(ctx, user.ID, client)
+	if err != nil {
+		return LoginResult{}, err
+	}
+
+	return LoginResult{User: user, Tokens: tokens}, nil
+}
+
+// oidcAccount returns the account an external identity signs in to, creating
+// it for an unknown identity.
+func (s Service) oidcAccount(ctx context.Context, providerName string, claims OIDCClaims, now time.Time) (users.User, error) {
+	identity, err := s.identities.GetIdentity(ctx, providerName, claims.Subject)
+	if errors.Is(err, ErrNotFound) {
+		return s.signUpWithIdentity(ctx, providerName, claims, now)
+	}
+	if err != nil {
+		return users.User{}, err
+	}
+
+	user, err := s.users.GetByID(ctx, identity.UserID)
+	if err != nil {
+		return users.User{}, err
+	}
+	var email *string
+	if claims.Email != "" {
+		email = &claims.Email
+	}
+	if err := s.identities.TouchIdentity(ctx, identity.ID, email, now); err != nil {
+		return users.User{}, err
+	}
+	return user, nil
+}
+
+// StartOIDCLink returns the provider URL to send the user to for linking an
+// identity to their account.
+func (s Service) StartOIDCLink(ctx context.Context, user users.User, providerName string) (string, error) {
+	return s.startOIDC(ctx, providerName, &user.ID)
+}
+
+// CompleteOIDCLink links the identity the provider redirected back with to the
+// user's account.
+func (s Service) CompleteOIDCLink(ctx context.Context, user users.User, providerName, code, state string) (Identity, error) {
+	claims, err := s.finishOIDC(ctx, providerName, code, state, &user.ID)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	now := time.Now().UTC()
+	identity := Identity{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Provider:  providerName,
+		Subject:   claims.Subject,
+		CreatedAt: now,
+	}
+	if claims.Email != "" {
+		identity.Email = &claims.Email
+	}
+
+	if err := s.identities.CreateIdentity(ctx, identity); err != nil {
+		return Identity{}, err
+	}
+	return identity, nil
+}
+
+// ListIdentities returns the external identities linked to the user.
+func (s Service) ListIdentities(ctx context.Context, userID uuid.UUID) ([]Identity, error) {
+	return s.store.ListIdentities(ctx, userID)
+}
+
+// UnlinkIdentity removes a linked identity. The account keeps its password and
+// magic-link sign-in.
+func (s Service) UnlinkIdentity(ctx context.Context, userID, identityID uuid.UUID) error {
+	err := s.store.DeleteIdentity(ctx, userID, identityID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrIdentityNotFound
+	}
+	return err
+}
+
+func (s Service) provider(name string) (*OIDCProvider, error) {
+	for _, provider := range s.providers {
+		if provider.Name() == name {
+			return provider, nil
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+// startOIDC stores a fresh state, nonce and PKCE verifier and builds the
+// authorization URL.
+func (s Service) startOIDC(ctx context.Context, providerName string, userID *uuid.UUID) (string, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := generateToken()
+	if err != nil {
+		return "", err
 	}
 
-	token, err := s.jwtManager.GenerateAccessToken(user.ID)
+	authURL, err := provider.AuthorizationURL(ctx, state, nonce, verifier)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	loginState := OIDCLoginState{
+		StateHash:    hashToken(state),
+		Provider:     providerName,
+		UserID:       userID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(oidcStateTTL),
+		CreatedAt:    now,
+	}
+	if err := s.identities.CreateOIDCLoginState(ctx, loginState); err != nil {
+		return "", err
+	}
+
+	return authURL, nil
+}
+
+// finishOIDC consumes the state, which must belong to the same provider and
+// flow, and exchanges the code for verified ID token claims.
+func (s Service) finishOIDC(ctx context.Context, providerName, code, state string, userID *uuid.UUID) (OIDCClaims, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return OIDCClaims{}, err
+	}
+
+	now := time.Now().UTC()
+	loginState, err := s.identities.ConsumeOIDCLoginState(ctx, hashToken(state), now)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return OIDCClaims{}, ErrInvalidOIDCState
+		}
+		return OIDCClaims{}, err
+	}
+
+	if loginState.Provider != providerName || now.After(loginState.ExpiresAt) {
+		return OIDCClaims{}, ErrInvalidOIDCState
+	}
+	if (loginState.UserID == nil) != (userID == nil) || (userID != nil && *loginState.UserID != *userID) {
+		return OIDCClaims{}, ErrInvalidOIDCState
+	}
+
+	return provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+}
+
+// signUpWithIdentity creates an account for a new external identity. The
+// account has no usable password until the user sets one.
+func (s Service) signUpWithIdentity(ctx context.Context, providerName string, claims OIDCClaims, now time.Time) (users.User, error) {
+	if claims.Email == "" || !claims.EmailVerified {
+		return users.User{}, ErrOIDCEmailNotVerified
+	}
+
+	if _, err := s.users.GetByEmail(ctx, claims.Email); err == nil {
+		return users.User{}, ErrOIDCAccountExists
+	} else if !errors.Is(err, users.ErrNotFound) {
+		return users.User{}, err
+	}
+
+	unusable, err := generateToken()
+	if err != nil {
+		return users.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(unusable), bcrypt.DefaultCost)
+	if err != nil {
+		return users.User{}, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	user := users.User{
+		ID:              uuid.New(),
+		Email:           claims.Email,
+		PasswordHash:    string(hash),
+		Name:            name,
+		EmailVerifiedAt: &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return users.User{}, err
+	}
+
+	identity := Identity{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		Provider:    providerName,
+		Subject:     claims.Subject,
+		Email:       &claims.Email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	}
+	if err := s.identities.CreateIdentity(ctx, identity); err != nil {
+		return users.User{}, err
+	}
+
+	return user, nil
+}
+
+// loginFailed records a failed login for the email and the client IP and
+// returns the error to report.
+func (s Service) loginFailed(ctx context.Context, userID *uuid.UUID, email, clientIP string, now time.Time) error {
+	locked, err := s.recordFailure(ctx, emailAttemptKey(email), emailAttemptPolicy, now)
+	if err != nil {
+		return err
+	}
+	if locked {
+		s.recordSecurityEvent(ctx, SecurityEventAccountLocked, userID, email, clientIP, now)
+	}
+
+	if _, err := s.recordFailure(ctx, ipAttemptKey(clientIP), ipAttemptPolicy, now); err != nil {
+		return err
+	}
+
+	return ErrInvalidCredentials
+}
+
+// checkAttempts returns a RateLimitError when any of the keys is blocked.
+func (s Service) checkAttempts(ctx context.Context, now time.Time, keys ...string) error {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		record, err := s.attempts.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if record.BlockedUntil != nil && record.BlockedUntil.After(now) {
+			if wait := record.BlockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		return &RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordFailure registers a failure for key and blocks it according to the
+// policy. It reports whether the failure triggered a lockout.
+func (s Service) recordFailure(ctx context.Context, key string, policy attemptPolicy, now time.Time) (bool, error) {
+	record, err := s.attempts.RegisterFailure(ctx, key, now, policy.Window)
+	if err != nil {
+		return false, err
+	}
+
+	delay, lockout := policy.delayAfter(record.Failures)
+	if delay == 0 {
+		return false, nil
+	}
+
+	if err := s.attempts.Block(ctx, key, now.Add(delay)); err != nil {
+		return false, err
+	}
+	return lockout, nil
+}
+
+func (s Service) recordSecurityEvent(ctx context.Context, eventType string, userID *uuid.UUID, email, clientIP string, now time.Time) {
+	log.Printf("security event %s for %s from %s", eventType, email, clientIP)
+
+	event := SecurityEvent{
+		ID:        uuid.New(),
+		UserID:    userID,
+		EventType: eventType,
+		Email:     &email,
+		IPAddress: &clientIP,
+		CreatedAt: now,
+	}
+	if err := s.store.CreateSecurityEvent(ctx, event); err != nil {
+		log.Printf("failed to record security event %s: %v", eventType, err)
+	}
+}
+
+// Refresh rotates a refresh token and issues a new token pair for its session.
+// Presenting a token that was already rotated revokes the whole session.
+func (s Service) Refresh(ctx context.Context, refreshToken string) (users.User, TokenPair, error) {
+	if refreshToken == "" {
+		return users.User{}, TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	current, err := s.store.GetRefreshTokenByHash(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return users.User{}, TokenPair{}, ErrInvalidRefreshToken
+		}
+		return users.User{}, TokenPair{}, err
+	}
+
+	now := time.Now().UTC()
+
+	if current.RotatedAt != nil {
+		if err := s.store.RevokeSession(ctx, current.SessionID, now); err != nil {
+			return users.User{}, TokenPair{}, err
+		}
+		return users.User{}, TokenPair{}, ErrRefreshTokenReused
+	}
+
+	session, err := s.store.GetSession(ctx, current.SessionID)
+	if err != nil {
+		return users.User{}, TokenPair{}, err
+	}
+
+	if session.RevokedAt != nil || now.After(current.ExpiresAt) {
+		return users.User{}, TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	user, err := s.users.GetByID(ctx, session.UserID)
+	if err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			return users.User{}, TokenPair{}, ErrInvalidRefreshToken
+		}
+		return users.User{}, TokenPair{}, err
+	}
+
+	rawToken, next, err := s.newRefreshToken(session.ID, now)
+	if err != nil {
+		return users.User{}, TokenPair{}, err
+	}
+
+	if err := s.store.RotateRefreshToken(ctx, current.ID, next, now); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			// Another request rotated the token first: treat as reuse.
+			if err := s.store.RevokeSession(ctx, session.ID, now); err != nil {
+				return users.User{}, TokenPair{}, err
+			}
+			return users.User{}, TokenPair{}, ErrRefreshTokenReused
+		}
+		return users.User{}, TokenPair{}, err
+	}
+
+	accessToken, err := s.jwtManager.GenerateAccessToken(user.ID, session.ID)
+	if err != nil {
+		return users.User{}, TokenPair{}, err
+	}
+
+	return user, TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawToken,
+		ExpiresAt:    now.Add(s.jwtManager.TTL()),
+	}, nil
+}
+
+// Logout revokes the session and every refresh token issued for it.
+func (s Service) Logout(ctx context.Context, sessionID uuid.UUID) error {
+	return s.store.RevokeSession(ctx, sessionID, time.Now().UTC())
+}
+
+// JWKS returns the public keys access tokens can be verified with.
+func (s Service) JWKS() JWKSet {
+	return s.jwtManager.JWKS()
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+// Sessions whose refresh token has expired are left out.
+func (s Service) ListSessions(ctx context.Context, userID uuid.UUID) ([]Session, error) {
+	return s.store.ListActiveSessions(ctx, userID, time.Now().UTC())
+}
+
+// RevokeSession signs the user out of one of their sessions, e.g. a lost
+// device. Sessions of other users are reported as not found.
+func (s Service) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	err := s.store.RevokeUserSession(ctx, userID, sessionID, time.Now().UTC())
+	if errors.Is(err, ErrNotFound) {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
+// ForgotPassword emails a single-use reset link when the address belongs to an
+// account. It reports success for unknown addresses and silently drops
+// requests above the per-address limit so callers cannot probe for accounts.
+func (s Service) ForgotPassword(ctx context.Context, emailAddress string) error {
+	if err := validateEmail(emailAddress); err != nil {
+		return err
+	}
+
+	emailAddress = strings.ToLower(strings.TrimSpace(emailAddress))
+
+	user, err := s.users.GetByEmail(ctx, emailAddress)
+	if err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	recent, err := s.store.CountPasswordResetTokensSince(ctx, user.ID, now.Add(-passwordResetWindow))
+	if err != nil {
+		return err
+	}
+	if recent >= passwordResetLimit {
+		log.Printf("password reset throttled for user %s", user.ID)
+		return nil
+	}
+
+	rawToken, err := generateToken()
+	if err != nil {
+		return err
+	}
+
+	token := PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hashToken(rawToken),
+		ExpiresAt: now.Add(passwordResetTTL),
+		CreatedAt: now,
+	}
+
+	if err := s.store.CreatePasswordResetToken(ctx, token); err != nil {
+		return err
+	}
+
+	if s.emailSender != nil {
+		go func() {
+			if err := s.emailSender.SendPasswordReset(user.Email, user.Name, rawToken, passwordResetTTL); err != nil {
+				log.Printf("failed to send password reset email to %s: %v", user.Email, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// ResetPassword sets a new password using a reset token and revokes every
+// existing session of the account.
+func (s Service) ResetPassword(ctx context.Context, rawToken, newPassword string) error {
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	token, err := s.store.GetPasswordResetTokenByHash(ctx, hashToken(rawToken))
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	if token.UsedAt != nil || now.After(token.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.ResetPassword(ctx, token, string(hash), now); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+	return nil
+}
+
+// VerifyEmail marks the address carried by a verification token as verified.
+// The token is rejected when the account address changed since it was issued.
+func (s Service) VerifyEmail(ctx context.Context, token string) (users.User, error) {
+	claims, err := s.jwtManager.ParseActionToken(emailVerificationAudience, token)
+	if err != nil {
+		return users.User{}, ErrInvalidVerifyToken
+	}
+
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			return users.User{}, ErrInvalidVerifyToken
+		}
+		return users.User{}, err
+	}
+
+	if user.Email != claims.Email {
+		return users.User{}, ErrInvalidVerifyToken
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return user, nil
+	}
+
+	return s.MarkEmailVerified(ctx, user)
+}
+
+// MarkEmailVerified records that the user proved ownership of their current
+// address, e.g. by following an invitation sent to it.
+func (s Service) MarkEmailVerified(ctx context.Context, user users.User) (users.User, error) {
+	now := time.Now().UTC()
+	if err := s.users.MarkEmailVerified(ctx, user.ID, user.Email, now); err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			return users.User{}, ErrInvalidVerifyToken
+		}
+		return users.User{}, err
+	}
+
+	user.EmailVerifiedAt = &now
+	user.UpdatedAt = now
+	return user, nil
+}
+
+// ResendEmailVerification sends a new verification link to the user.
+func (s Service) ResendEmailVerification(ctx context.Context, user users.User) error {
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	return s.sendEmailVerification(user)
+}
+
+func (s Service) sendEmailVerification(user users.User) error {
+	token, err := s.jwtManager.GenerateActionToken(emailVerificationAudience, user.ID, user.Email, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	if s.emailSender != nil {
+		go func() {
+			if err := s.emailSender.SendEmailVerification(user.Email, user.Name, token, emailVerificationTTL); err != nil {
+				log.Printf("failed to send verification email to %s: %v", user.Email, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// UpdateName changes the display name of the user.
+func (s Service) UpdateName(ctx context.Context, user users.User, name string) (users.User, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return users.User{}, ErrNameRequired
+	}
+
+	now := time.Now().UTC()
+	if err := s.users.UpdateName(ctx, user.ID, name, now); err != nil {
+		return users.User{}, err
+	}
+
+	user.Name = name
+	user.UpdatedAt = now
+	return user, nil
+}
+
+// ChangePassword replaces the password after checking the current one. Every
+// other session of the user is signed out and their personal access tokens
+// are deleted.
+func (s Service) ChangePassword(ctx context.Context, user users.User, currentSessionID uuid.UUID, currentPassword, newPassword string) error {
+	if err := confirmPassword(ctx, user, currentPassword); err != nil {
+		return err
+	}
+
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if err := s.users.UpdatePassword(ctx, user.ID, string(hash), now); err != nil {
+		return err
+	}
+
+	if err := s.store.RevokeOtherUserSessions(ctx, user.ID, currentSessionID, now); err != nil {
+		return err
+	}
+
+	// Personal access tokens go too, as on a reset: a password change is how a
+	// user cuts off whoever may have obtained access to the account.
+	return s.store.DeleteUserPersonalAccessTokens(ctx, user.ID)
+}
+
+// RequestEmailChange emails a confirmation link to the new address. The
+// account keeps its current address until the link is followed.
+func (s Service) RequestEmailChange(ctx context.Context, user users.User, password, newEmail string) error {
+	if err := confirmPassword(ctx, user, password); err != nil {
+		return err
+	}
+
+	if err := validateEmail(newEmail); err != nil {
+		return err
+	}
+
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if newEmail == user.Email {
+		return ErrSameEmail
+	}
+
+	if _, err := s.users.GetByEmail(ctx, newEmail); err == nil {
+		return ErrEmailAlreadyRegistered
+	} else if !errors.Is(err, users.ErrNotFound) {
+		return err
+	}
+
+	token, err := s.jwtManager.GenerateStampedActionToken(emailChangeAudience, user.ID, newEmail, emailChangeStamp(user), emailChangeTTL)
+	if err != nil {
+		return err
+	}
+
+	if s.emailSender != nil {
+		go func() {
+			if err := s.emailSender.SendEmailChangeConfirmation(newEmail, user.Name, token, emailChangeTTL); err != nil {
+				log.Printf("failed to send email change confirmation to %s: %v", newEmail, err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies the address carried by an email change token.
+// The token is only valid while the account keeps the address, password and
+// verification it was requested with, so it is spent once the change is
+// applied and revoked by any later change of address or password.
+func (s Service) ConfirmEmailChange(ctx context.Context, token string) (users.User, error) {
+	claims, err := s.jwtManager.ParseActionToken(emailChangeAudience, token)
+	if err != nil {
+		return users.User{}, ErrInvalidEmailChange
+	}
+
+	user, err := s.users.GetByID(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, users.ErrNotFound) {
+			return users.User{}, ErrInvalidEmailChange
+		}
+		return users.User{}, err
+	}
+
+	if claims.Stamp == "" || claims.Stamp != emailChangeStamp(user) {
+		return users.User{}, ErrInvalidEmailChange
+	}
+
+	now := time.Now().UTC()
+	if err := s.users.UpdateEmail(ctx, user.ID, claims.Email, now); err != nil {
+		if errors.Is(err, users.ErrEmailTaken) {
+			return users.User{}, ErrEmailAlreadyRegistered
+		}
+		return users.User{}, err
+	}
+
+	user.Email = claims.Email
+	user.EmailVerifiedAt = &now
+	user.UpdatedAt = now
+	return user, nil
+}
+
+// emailChangeStamp digests the account state an email change token is bound
+// to. Applying a change sets a new verification time, so the stamp never
+// repeats even when the account returns to an earlier address.
+func emailChangeStamp(user users.User) string {
+	verifiedAt := ""
+	if user.EmailVerifiedAt != nil {
+		verifiedAt = user.EmailVerifiedAt.UTC().Format(time.RFC3339Nano)
+	}
+	return hashToken(user.Email + "\x00" + user.PasswordHash + "\x00" + verifiedAt)
+}
+
+// EnrollTOTP generates a new authenticator secret and recovery codes. The
+// secret only protects logins after ConfirmTOTP succeeds.
+func (s Service) EnrollTOTP(ctx context.Context, user users.User) (TOTPEnrollment, error) {
+	enabled, err := s.twoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+	if enabled {
+		return TOTPEnrollment{}, ErrTwoFactorEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	now := time.Now().UTC()
+	recovery := make([]RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		recovery = append(recovery, RecoveryCode{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			CodeHash:  hashToken(normalizeRecoveryCode(code)),
+			CreatedAt: now,
+		})
+	}
+
+	totp := TOTPSecret{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: now,
+	}
+	if err := s.store.SaveTOTP(ctx, totp, recovery); err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	return TOTPEnrollment{
+		Secret:        secret,
+		URI:           totpURI(secret, user.Email),
+		RecoveryCodes: codes,
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication with a first valid code.
+func (s Service) ConfirmTOTP(ctx context.Context, user users.User, code string) error {
+	totp, err := s.store.GetTOTP(ctx, user.ID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrTwoFactorNotEnrolled
+		}
+		return err
+	}
+	if totp.ConfirmedAt != nil {
+		return ErrTwoFactorEnabled
+	}
+
+	now := time.Now().UTC()
+	step, ok := matchTOTP(totp.Secret, code, now, totp.LastUsedStep)
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	if err := s.store.UseTOTPStep(ctx, user.ID, step); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+
+	return s.store.ConfirmTOTP(ctx, user.ID, now)
+}
+
+// DisableTOTP turns two-factor authentication off. Both the password and a
+// current TOTP or recovery code are required.
+func (s Service) DisableTOTP(ctx context.Context, user users.User, password, code string) error {
+	if err := confirmPassword(ctx, user, password); err != nil {
+		return err
+	}
+
+	enabled, err := s.twoFactorEnabled(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifySecondFactor(ctx, user.ID, code); err != nil {
+		return err
+	}
+
+	return s.store.DeleteTOTP(ctx, user.ID)
+}
+
+// confirmPassword checks the password guarding a sensitive account change. It
+// may be left empty when the session signed in recently, which is the only way
+// for accounts created through a magic link or an identity provider, whose
+// password nobody knows, to confirm such changes.
+func confirmPassword(ctx context.Context, user users.User, password string) error {
+	if password == "" && RecentlyAuthenticated(ctx) {
+		return nil
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return ErrInvalidPassword
+	}
+	return nil
+}
+
+func (s Service) twoFactorEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := s.store.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return totp.ConfirmedAt != nil, nil
+}
+
+// verifySecondFactor accepts either a TOTP code or an unused recovery code.
+func (s Service) verifySecondFactor(ctx context.Context, userID uuid.UUID, code string) error {
+	totp, err := s.store.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrTwoFactorNotEnabled
+		}
+		return err
+	}
+	if totp.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	now := time.Now().UTC()
+	if step, ok := matchTOTP(totp.Secret, code, now, totp.LastUsedStep); ok {
+		if err := s.store.UseTOTPStep(ctx, userID, step); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ErrInvalidTwoFactorCode
+			}
+			return err
+		}
+		return nil
+	}
+
+	if err := s.store.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)), now); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrInvalidTwoFactorCode
+		}
+		return err
+	}
+	return nil
+}
+
+// CreatePersonalAccessToken issues a named, scoped token for scripts and
+// integrations. The raw token is only returned here.
+func (s Service) CreatePersonalAccessToken(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (PersonalAccessToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return PersonalAccessToken{}, "", ErrTokenNameRequired
+	}
+	if len(name) > personalAccessTokenNameMax {
+		name = name[:personalAccessTokenNameMax]
+	}
+
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return PersonalAccessToken{}, "", err
+	}
+
+	now := time.Now().UTC()
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return PersonalAccessToken{}, "", ErrInvalidTokenExpiry
+		}
+		utc := expiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	raw, err := generateToken()
+	if err != nil {
+		return PersonalAccessToken{}, "", err
+	}
+	raw = personalAccessTokenPrefix + raw
+
+	token := PersonalAccessToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(raw),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+
+	if err := s.store.CreatePersonalAccessToken(ctx, token); err != nil {
+		return PersonalAccessToken{}, "", err
+	}
+
+	return token, raw, nil
+}
+
+// ListPersonalAccessTokens returns the user's tokens, newest first.
+func (s Service) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]PersonalAccessToken, error) {
+	return s.store.ListPersonalAccessTokens(ctx, userID)
+}
+
+// RevokePersonalAccessToken deletes one of the user's tokens.
+func (s Service) RevokePersonalAccessToken(ctx context.Context, userID, tokenID uuid.UUID) error {
+	err := s.store.DeletePersonalAccessToken(ctx, userID, tokenID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrTokenNotFound
+	}
+	return err
+}
+
+// startSession opens a new session for the user and issues its first token pair.
+func (s Service) startSession(ctx context.Context, userID uuid.UUID, client ClientInfo) (TokenPair, error) {
+	now := time.Now().UTC()
+	session := Session{
+		ID:          uuid.New(),
+		UserID:      userID,
+		DeviceLabel: client.DeviceLabel,
+		UserAgent:   client.UserAgent,
+		IPAddress:   client.IPAddress,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+	}
+
+	rawToken, refresh, err := s.newRefreshToken(session.ID, now)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	if err := s.store.CreateSession(ctx, session, refresh); err != nil {
+		return TokenPair{}, err
+	}
+
+	accessToken, err := s.jwtManager.GenerateAccessToken(userID, session.ID)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: rawToken,
+		ExpiresAt:    now.Add(s.jwtManager.TTL()),
+	}, nil
+}
+
+func (s Service) newRefreshToken(sessionID uuid.UUID, now time.Time) (string, RefreshToken, error) {
+	raw, err := generateToken()
 	if err != nil {
-		return users.User{}, "", err
+		return "", RefreshToken{}, err
 	}
 
-	return user, token, nil
+	return raw, RefreshToken{
+		ID:        uuid.New(),
+		SessionID: sessionID,
+		TokenHash: hashToken(raw),
+		ExpiresAt: now.Add(s.refreshTTL),
+		CreatedAt: now,
+	}, nil
 }
 
 func validateEmail(email string) error {
@@ -0,0 +1,718 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Store persists sessions and refresh tokens.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a new auth store.
+func NewStore(pool *pgxpool.Pool) Store {
+	return Store{pool: pool}
+}
+
+func (s Store) CreateSession(ctx context.Context, session Session, token RefreshToken) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sessionQuery := `
+        INSERT INTO auth_sessions (id, user_id, device_label, user_agent, ip_address, created_at, last_seen_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+	if _, err := tx.Exec(ctx, sessionQuery, session.ID, session.UserID, session.DeviceLabel, session.UserAgent, session.IPAddress, session.CreatedAt, session.LastSeenAt); err != nil {
+		return err
+	}
+
+	if err := insertRefreshToken(ctx, tx, token); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s Store) GetSession(ctx context.Context, id uuid.UUID) (Session, error) {
+	query := `
+        SELECT id, user_id, COALESCE(device_label, ''), COALESCE(user_agent, ''), COALESCE(ip_address, ''), created_at, last_seen_at, revoked_at
+        FROM auth_sessions
+        WHERE id = $1
+        LIMIT 1
+    `
+	row := s.pool.QueryRow(ctx, query, id)
+	var session Session
+	if err := row.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Session{}, ErrNotFound
+		}
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// ListActiveSessions returns the user's sessions that can still be refreshed:
+// not revoked, and holding an unrotated refresh token that has not expired.
+func (s Store) ListActiveSessions(ctx context.Context, userID uuid.UUID, now time.Time) ([]Session, error) {
+	query := `
+        SELECT s.id, s.user_id, COALESCE(s.device_label, ''), COALESCE(s.user_agent, ''), COALESCE(s.ip_address, ''), s.created_at, s.last_seen_at, s.revoked_at
+        FROM auth_sessions s
+        WHERE s.user_id = $1 AND s.revoked_at IS NULL
+          AND EXISTS (
+              SELECT 1 FROM refresh_tokens t
+              WHERE t.session_id = s.id AND t.rotated_at IS NULL AND t.expires_at > $2
+          )
+        ORDER BY s.last_seen_at DESC
+    `
+	rows, err := s.pool.Query(ctx, query, userID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.UserAgent, &session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// TouchSession records activity on a session. The update is skipped when the
+// session was already seen after staleBefore, keeping the write rate low.
+func (s Store) TouchSession(ctx context.Context, id uuid.UUID, seenAt, staleBefore time.Time, ipAddress string) error {
+	query := `
+        UPDATE auth_sessions
+        SET last_seen_at = $2, ip_address = $4
+        WHERE id = $1 AND last_seen_at < $3
+    `
+	_, err := s.pool.Exec(ctx, query, id, seenAt, staleBefore, ipAddress)
+	return err
+}
+
+// RevokeUserSession revokes a session only if it belongs to the user. It
+// returns ErrNotFound otherwise.
+func (s Store) RevokeUserSession(ctx context.Context, userID, sessionID uuid.UUID, revokedAt time.Time) error {
+	query := `
+        UPDATE auth_sessions
+        SET revoked_at = $3
+        WHERE id = $2 AND user_id = $1 AND revoked_at IS NULL
+    `
+	tag, err := s.pool.Exec(ctx, query, userID, sessionID, revokedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s Store) RevokeSession(ctx context.Context, id uuid.UUID, revokedAt time.Time) error {
+	query := `
+        UPDATE auth_sessions
+        SET revoked_at = $2
+        WHERE id = $1 AND revoked_at IS NULL
+    `
+	_, err := s.pool.Exec(ctx, query, id, revokedAt)
+	return err
+}
+
+func (s Store) RevokeUserSessions(ctx context.Context, userID uuid.UUID, revokedAt time.Time) error {
+	query := `
+        UPDATE auth_sessions
+        SET revoked_at = $2
+        WHERE user_id = $1 AND revoked_at IS NULL
+    `
+	_, err := s.pool.Exec(ctx, query, userID, revokedAt)
+	return err
+}
+
+func (s Store) RevokeOtherUserSessions(ctx context.Context, userID, keepSessionID uuid.UUID, revokedAt time.Time) error {
+	query := `
+        UPDATE auth_sessions
+        SET revoked_at = $3
+        WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL
+    `
+	_, err := s.pool.Exec(ctx, query, userID, keepSessionID, revokedAt)
+	return err
+}
+
+func (s Store) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	query := `
+        SELECT id, session_id, token_hash, expires_at, created_at, rotated_at
+        FROM refresh_tokens
+        WHERE token_hash = $1
+        LIMIT 1
+    `
+	row := s.pool.QueryRow(ctx, query, tokenHash)
+	var token RefreshToken
+	if err := row.Scan(&token.ID, &token.SessionID, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.RotatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return RefreshToken{}, ErrNotFound
+		}
+		return RefreshToken{}, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken marks the current token as used and stores its successor.
+// It returns ErrNotFound when the current token was already rotated.
+func (s Store) RotateRefreshToken(ctx context.Context, currentID uuid.UUID, next RefreshToken, rotatedAt time.Time) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	updateQuery := `
+        UPDATE refresh_tokens
+        SET rotated_at = $2
+        WHERE id = $1 AND rotated_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, updateQuery, currentID, rotatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	if err := insertRefreshToken(ctx, tx, next); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func insertRefreshToken(ctx context.Context, tx pgx.Tx, token RefreshToken) error {
+	query := `
+        INSERT INTO refresh_tokens (id, session_id, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `
+	_, err := tx.Exec(ctx, query, token.ID, token.SessionID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (s Store) CreateMagicLinkToken(ctx context.Context, token MagicLinkToken) error {
+	query := `
+        INSERT INTO magic_link_tokens (id, email, user_id, name, invitation_token, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+    `
+	_, err := s.pool.Exec(ctx, query, token.ID, token.Email, token.UserID, token.Name, token.InvitationToken, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (s Store) CountMagicLinkTokensSince(ctx context.Context, email string, since time.Time) (int, error) {
+	query := `
+        SELECT COUNT(*)
+        FROM magic_link_tokens
+        WHERE email = $1 AND created_at >= $2
+    `
+	var count int
+	if err := s.pool.QueryRow(ctx, query, email, since).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s Store) GetMagicLinkTokenByHash(ctx context.Context, tokenHash string) (MagicLinkToken, error) {
+	query := `
+        SELECT id, email, user_id, name, invitation_token, token_hash, expires_at, created_at, used_at
+        FROM magic_link_tokens
+        WHERE token_hash = $1
+        LIMIT 1
+    `
+	row := s.pool.QueryRow(ctx, query, tokenHash)
+	var token MagicLinkToken
+	if err := row.Scan(&token.ID, &token.Email, &token.UserID, &token.Name, &token.InvitationToken, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return MagicLinkToken{}, ErrNotFound
+		}
+		return MagicLinkToken{}, err
+	}
+	return token, nil
+}
+
+// ConsumeMagicLinkToken marks the link as used together with every other
+// outstanding link of the same address. It returns ErrNotFound when the link
+// was already used.
+func (s Store) ConsumeMagicLinkToken(ctx context.Context, token MagicLinkToken, usedAt time.Time) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	consumeQuery := `
+        UPDATE magic_link_tokens
+        SET used_at = $2
+        WHERE id = $1 AND used_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, consumeQuery, token.ID, usedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	invalidateQuery := `
+        UPDATE magic_link_tokens
+        SET used_at = $2
+        WHERE email = $1 AND used_at IS NULL
+    `
+	if _, err := tx.Exec(ctx, invalidateQuery, token.Email, usedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s Store) CreatePasswordResetToken(ctx context.Context, token PasswordResetToken) error {
+	query := `
+        INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `
+	_, err := s.pool.Exec(ctx, query, token.ID, token.UserID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (s Store) CountPasswordResetTokensSince(ctx context.Context, userID uuid.UUID, since time.Time) (int, error) {
+	query := `
+        SELECT COUNT(*)
+        FROM password_reset_tokens
+        WHERE user_id = $1 AND created_at >= $2
+    `
+	var count int
+	if err := s.pool.QueryRow(ctx, query, userID, since).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s Store) GetPasswordResetTokenByHash(ctx context.Context, tokenHash string) (PasswordResetToken, error) {
+	query := `
+        SELECT id, user_id, token_hash, expires_at, created_at, used_at
+        FROM password_reset_tokens
+        WHERE token_hash = $1
+        LIMIT 1
+    `
+	row := s.pool.QueryRow(ctx, query, tokenHash)
+	var token PasswordResetToken
+	if err := row.Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PasswordResetToken{}, ErrNotFound
+		}
+		return PasswordResetToken{}, err
+	}
+	return token, nil
+}
+
+// ResetPassword consumes a password reset token, together with any other
+// outstanding token of the same user, and sets the new password hash in the
+// same transaction. Every session of the user is revoked and their personal
+// access tokens deleted. It returns ErrNotFound, changing nothing, when the
+// token was already used or the user no longer exists.
+func (s Store) ResetPassword(ctx context.Context, token PasswordResetToken, passwordHash string, usedAt time.Time) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	consumeQuery := `
+        UPDATE password_reset_tokens
+        SET used_at = $2
+        WHERE id = $1 AND used_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, consumeQuery, token.ID, usedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	invalidateQuery := `
+        UPDATE password_reset_tokens
+        SET used_at = $2
+        WHERE user_id = $1 AND used_at IS NULL
+    `
+	if _, err := tx.Exec(ctx, invalidateQuery, token.UserID, usedAt); err != nil {
+		return err
+	}
+
+	passwordQuery := `
+        UPDATE users
+        SET password_hash = $2, updated_at = $3
+        WHERE id = $1
+    `
+	tag, err = tx.Exec(ctx, passwordQuery, token.UserID, passwordHash, usedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE auth_sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`, token.UserID, usedAt); err != nil {
+		return err
+	}
+	// Whoever knew the old password may have created tokens.
+	if _, err := tx.Exec(ctx, `DELETE FROM personal_access_tokens WHERE user_id = $1`, token.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SaveTOTP stores a new unconfirmed secret and its recovery codes, replacing
+// any previous enrolment of the user.
+func (s Store) SaveTOTP(ctx context.Context, secret TOTPSecret, codes []RecoveryCode) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	upsertQuery := `
+        INSERT INTO user_totp (user_id, secret, last_used_step, confirmed_at, created_at)
+        VALUES ($1, $2, 0, NULL, $3)
+        ON CONFLICT (user_id) DO UPDATE
+        SET secret = EXCLUDED.secret, last_used_step = 0, confirmed_at = NULL, created_at = EXCLUDED.created_at
+    `
+	if _, err := tx.Exec(ctx, upsertQuery, secret.UserID, secret.Secret, secret.CreatedAt); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, secret.UserID); err != nil {
+		return err
+	}
+
+	insertQuery := `
+        INSERT INTO totp_recovery_codes (id, user_id, code_hash, created_at)
+        VALUES ($1, $2, $3, $4)
+    `
+	for _, code := range codes {
+		if _, err := tx.Exec(ctx, insertQuery, code.ID, code.UserID, code.CodeHash, code.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s Store) GetTOTP(ctx context.Context, userID uuid.UUID) (TOTPSecret, error) {
+	query := `
+        SELECT user_id, secret, last_used_step, confirmed_at, created_at
+        FROM user_totp
+        WHERE user_id = $1
+        LIMIT 1
+    `
+	row := s.pool.QueryRow(ctx, query, userID)
+	var secret TOTPSecret
+	if err := row.Scan(&secret.UserID, &secret.Secret, &secret.LastUsedStep, &secret.ConfirmedAt, &secret.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return TOTPSecret{}, ErrNotFound
+		}
+		return TOTPSecret{}, err
+	}
+	return secret, nil
+}
+
+// UseTOTPStep records the step of an accepted code. It returns ErrNotFound
+// when a code of the same or a later step was already used.
+func (s Store) UseTOTPStep(ctx context.Context, userID uuid.UUID, step int64) error {
+	query := `
+        UPDATE user_totp
+        SET last_used_step = $2
+        WHERE user_id = $1 AND last_used_step < $2
+    `
+	tag, err := s.pool.Exec(ctx, query, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s Store) ConfirmTOTP(ctx context.Context, userID uuid.UUID, confirmedAt time.Time) error {
+	query := `
+        UPDATE user_totp
+        SET confirmed_at = $2
+        WHERE user_id = $1 AND confirmed_at IS NULL
+    `
+	_, err := s.pool.Exec(ctx, query, userID, confirmedAt)
+	return err
+}
+
+func (s Store) DeleteTOTP(ctx context.Context, userID uuid.UUID) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseRecoveryCode consumes an unused recovery code. It returns ErrNotFound
+// when no unused code matches.
+func (s Store) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string, usedAt time.Time) error {
+	query := `
+        UPDATE totp_recovery_codes
+        SET used_at = $3
+        WHERE id = (
+            SELECT id FROM totp_recovery_codes
+            WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+            LIMIT 1
+        ) AND used_at IS NULL
+    `
+	tag, err := s.pool.Exec(ctx, query, userID, codeHash, usedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s Store) CreateSecurityEvent(ctx context.Context, event SecurityEvent) error {
+	query := `
+        INSERT INTO security_events (id, user_id, event_type, email, ip_address, details, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+	_, err := s.pool.Exec(ctx, query, event.ID, event.UserID, event.EventType, event.Email, event.IPAddress, event.Details, event.CreatedAt)
+	return err
+}
+
+func (s Store) CreatePersonalAccessToken(ctx context.Context, token PersonalAccessToken) error {
+	query := `
+        INSERT INTO personal_access_tokens (id, user_id, name, token_hash, scopes, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+	_, err := s.pool.Exec(ctx, query, token.ID, token.UserID, token.Name, token.TokenHash, token.Scopes, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+func (s Store) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (PersonalAccessToken, error) {
+	query := `
+        SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at
+        FROM personal_access_tokens
+        WHERE token_hash = $1
+        LIMIT 1
+    `
+	row := s.pool.QueryRow(ctx, query, tokenHash)
+	var token PersonalAccessToken
+	if err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PersonalAccessToken{}, ErrNotFound
+		}
+		return PersonalAccessToken{}, err
+	}
+	return token, nil
+}
+
+func (s Store) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]PersonalAccessToken, error) {
+	query := `
+        SELECT id, user_id, name, token_hash, scopes, expires_at, last_used_at, created_at
+        FROM personal_access_tokens
+        WHERE user_id = $1
+        ORDER BY created_at DESC
+    `
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []PersonalAccessToken
+	for rows.Next() {
+		var token PersonalAccessToken
+		if err := rows.Scan(&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.Scopes, &token.ExpiresAt, &token.LastUsedAt, &token.CreatedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// TouchPersonalAccessToken records a use of the token, skipping the write when
+// it was already used after staleBefore.
+func (s Store) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID, usedAt, staleBefore time.Time) error {
+	query := `
+        UPDATE personal_access_tokens
+        SET last_used_at = $2
+        WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $3)
+    `
+	_, err := s.pool.Exec(ctx, query, id, usedAt, staleBefore)
+	return err
+}
+
+func (s Store) DeletePersonalAccessToken(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+        DELETE FROM personal_access_tokens
+        WHERE id = $2 AND user_id = $1
+    `
+	tag, err := s.pool.Exec(ctx, query, userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s Store) DeleteUserPersonalAccessTokens(ctx context.Context, userID uuid.UUID) error {
+	query := `
+        DELETE FROM personal_access_tokens
+        WHERE user_id = $1
+    `
+	_, err := s.pool.Exec(ctx, query, userID)
+	return err
+}
+
+func (s Store) CreateOIDCLoginState(ctx context.Context, state OIDCLoginState) error {
+	query := `
+        INSERT INTO oidc_login_states (state_hash, provider, user_id, nonce, code_verifier, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+	_, err := s.pool.Exec(ctx, query, state.StateHash, state.Provider, state.UserID, state.Nonce, state.CodeVerifier, state.ExpiresAt, state.CreatedAt)
+	return err
+}
+
+// ConsumeOIDCLoginState deletes and returns a login state so that it can only
+// be used once. Expired states are purged on the way.
+func (s Store) ConsumeOIDCLoginState(ctx context.Context, stateHash string, now time.Time) (OIDCLoginState, error) {
+	purgeQuery := `
+        DELETE FROM oidc_login_states
+        WHERE expires_at < $1
+    `
+	if _, err := s.pool.Exec(ctx, purgeQuery, now); err != nil {
+		return OIDCLoginState{}, err
+	}
+
+	query := `
+        DELETE FROM oidc_login_states
+        WHERE state_hash = $1
+        RETURNING state_hash, provider, user_id, nonce, code_verifier, expires_at, created_at
+    `
+	row := s.pool.QueryRow(ctx, query, stateHash)
+	var state OIDCLoginState
+	if err := row.Scan(&state.StateHash, &state.Provider, &state.UserID, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt, &state.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return OIDCLoginState{}, ErrNotFound
+		}
+		return OIDCLoginState{}, err
+	}
+	return state, nil
+}
+
+func (s Store) GetIdentity(ctx context.Context, provider, subject string) (Identity, error) {
+	query := `
+        SELECT id, user_id, provider, subject, email, created_at, last_login_at
+        FROM user_identities
+        WHERE provider = $1 AND subject = $2
+        LIMIT 1
+    `
+	row := s.pool.QueryRow(ctx, query, provider, subject)
+	var identity Identity
+	if err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Identity{}, ErrNotFound
+		}
+		return Identity{}, err
+	}
+	return identity, nil
+}
+
+func (s Store) ListIdentities(ctx context.Context, userID uuid.UUID) ([]Identity, error) {
+	query := `
+        SELECT id, user_id, provider, subject, email, created_at, last_login_at
+        FROM user_identities
+        WHERE user_id = $1
+        ORDER BY created_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []Identity
+	for rows.Next() {
+		var identity Identity
+		if err := rows.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// CreateIdentity links an external identity. It returns ErrIdentityLinked when
+// the subject or the provider is already linked.
+func (s Store) CreateIdentity(ctx context.Context, identity Identity) error {
+	query := `
+        INSERT INTO user_identities (id, user_id, provider, subject, email, created_at, last_login_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+    `
+	_, err := s.pool.Exec(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt, identity.LastLoginAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrIdentityLinked
+	}
+	return err
+}
+
+func (s Store) TouchIdentity(ctx context.Context, id uuid.UUID, email *string, loginAt time.Time) error {
+	query := `
+        UPDATE user_identities
+        SET email = $2, last_login_at = $3
+        WHERE id = $1
+    `
+	_, err := s.pool.Exec(ctx, query, id, email, loginAt)
+	return err
+}
+
+func (s Store) DeleteIdentity(ctx context.Context, userID, id uuid.UUID) error {
+	query := `
+        DELETE FROM user_identities
+        WHERE id = $2 AND user_id = $1
+    `
+	tag, err := s.pool.Exec(ctx, query, userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters follow the RFC 6238 defaults understood by every
+// authenticator app: HMAC-SHA1, 6 digits and a 30 second period.
+const (
+	totpIssuer  = "PiggyBank"
+	totpDigits  = 6
+	totpPeriod  = 30
+	totpSkew    = 1 // accepted steps before and after the current one
+	totpKeySize = 20
+
+	recoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTOTPSecret returns a random base32-encoded shared secret.
+func generateTOTPSecret() (string, error) {
+	key := make([]byte, totpKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// totpURI builds the otpauth:// URI rendered as a QR code by authenticator apps.
+func totpURI(secret, account string) string {
+	label := url.PathEscape(totpIssuer + ":" + account)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// totpStep returns the time step containing t.
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// totpCode computes the HOTP value (RFC 4226) of the secret for a time step.
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// matchTOTP checks the code against the steps around now and returns the
+// matching step. Steps at or before lastUsedStep are rejected to prevent replay.
+func matchTOTP(secret, code string, now time.Time, lastUsedStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastUsedStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// generateRecoveryCodes returns human friendly single-use codes such as
+// "K7QF-M2XA".
+func generateRecoveryCodes() ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := totpEncoding.EncodeToString(b)
+		codes = append(codes, raw[:4]+"-"+raw[4:])
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode makes recovery code comparison ignore case and dashes.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -3,7 +3,9 @@ package email
 import (
 	"bytes"
 	"fmt"
-	"text/template"
+	"html/template"
+	"net/url"
+	"time"
 
 	"github.com/wneessen/go-mail"
 )
@@ -34,9 +36,10 @@ func NewService(smtpHost, smtpPort, username, password, from, baseURL string) Se
 func (s Service) SendInvitation(toEmail, inviterName, invitationToken string) error {
 	subject := "PiggyBank Couple Invitation"
 
-	// Generate invitation URL that points to the frontend app
+	// Generate invitation URL that points to the frontend app. It opens the
+	// sign-up screen, the only one the app links to so far.
 	invitationURL := fmt.Sprintf("%s/register?invitationToken=%s&email=%s",
-		s.baseURL, invitationToken, toEmail)
+		s.baseURL, url.QueryEscape(invitationToken), url.QueryEscape(toEmail))
 
 	htmlBody := fmt.Sprintf(`
 <!DOCTYPE html>
@@ -109,6 +112,168 @@ func (s Service) SendInvitation(toEmail, inviterName, invitationToken string) er
 </body>
 </html>`, inviterName, invitationURL, invitationURL)
 
+	return s.send(toEmail, subject, htmlBody)
+}
+
+// SendPasswordReset sends a one-time link to choose a new password.
+func (s Service) SendPasswordReset(toEmail, name, token string, validFor time.Duration) error {
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", s.baseURL, url.QueryEscape(token))
+
+	htmlBody, err := s.renderLayout(passwordResetTemplate, actionEmailData{
+		Heading:   "Password Reset",
+		Name:      name,
+		ActionURL: resetURL,
+		ValidFor:  formatDuration(validFor),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return s.send(toEmail, "Reset your PiggyBank password", htmlBody)
+}
+
+// SendEmailVerification sends a link confirming ownership of the address.
+func (s Service) SendEmailVerification(toEmail, name, token string, validFor time.Duration) error {
+	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", s.baseURL, url.QueryEscape(token))
+
+	htmlBody, err := s.renderLayout(emailVerificationTemplate, actionEmailData{
+		Heading:   "Confirm your email",
+		Name:      name,
+		ActionURL: verifyURL,
+		ValidFor:  formatDuration(validFor),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return s.send(toEmail, "Confirm your PiggyBank email address", htmlBody)
+}
+
+// SendEmailChangeConfirmation sends a link to the new address confirming an
+// email change.
+func (s Service) SendEmailChangeConfirmation(toEmail, name, token string, validFor time.Duration) error {
+	confirmURL := fmt.Sprintf("%s/confirm-email-change?token=%s", s.baseURL, url.QueryEscape(token))
+
+	htmlBody, err := s.renderLayout(emailChangeTemplate, actionEmailData{
+		Heading:   "Confirm your new email",
+		Name:      name,
+		ActionURL: confirmURL,
+		ValidFor:  formatDuration(validFor),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return s.send(toEmail, "Confirm your new PiggyBank email address", htmlBody)
+}
+
+// SendMagicLink sends a single-use sign-in link.
+func (s Service) SendMagicLink(toEmail, name, token string, validFor time.Duration) error {
+	loginURL := fmt.Sprintf("%s/magic-link?token=%s", s.baseURL, url.QueryEscape(token))
+
+	htmlBody, err := s.renderLayout(magicLinkTemplate, actionEmailData{
+		Heading:   "Sign in to PiggyBank",
+		Name:      name,
+		ActionURL: loginURL,
+		ValidFor:  formatDuration(validFor),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return s.send(toEmail, "Your PiggyBank sign-in link", htmlBody)
+}
+
+// SendHouseholdInvitation invites someone to join a household. The expiry is
+// shown with the household's formatting.
+func (s Service) SendHouseholdInvitation(toEmail, inviterName, householdName, invitationToken string, validFor time.Duration, format Formatting) error {
+	invitationURL := fmt.Sprintf("%s/households/join/%s?email=%s",
+		s.baseURL, url.PathEscape(invitationToken), url.QueryEscape(toEmail))
+
+	htmlBody, err := s.renderLayout(householdInvitationTemplate, householdInvitationData{
+		actionEmailData: actionEmailData{
+			Heading:   "Household Invitation",
+			ActionURL: invitationURL,
+			ValidFor:  formatDuration(validFor),
+		},
+		InviterName:   inviterName,
+		HouseholdName: householdName,
+		ExpiresAt:     format.Time(time.Now().Add(validFor)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return s.send(toEmail, "PiggyBank Household Invitation", htmlBody)
+}
+
+// ClosingSummary is what a piggybank collected, as told in the email sent
+// once it has ended. Amounts are in minor units of the currency.
+type ClosingSummary struct {
+	Title        string
+	StartDate    time.Time
+	EndDate      time.Time
+	TotalActions int
+	TotalValue   int
+	Templates    []SummaryTotal
+	Partners     []SummaryTotal
+	TopActions   []SummaryAction
+}
+
+// SummaryTotal counts the actions of a voucher template or of a partner.
+type SummaryTotal struct {
+	Name    string
+	Actions int
+	Value   int
+}
+
+// SummaryAction is one of the largest actions of a piggybank.
+type SummaryAction struct {
+	Title       string
+	GiverName   string
+	AmountCents int
+	OccurredAt  time.Time
+}
+
+// SendClosingSummary tells a member what an ended piggybank collected. Dates
+// and amounts are shown with the piggybank's formatting.
+func (s Service) SendClosingSummary(toEmail, name string, summary ClosingSummary, format Formatting) error {
+	data := closingSummaryData{
+		actionEmailData: actionEmailData{
+			Heading: "Piggybank Closed",
+			Name:    name,
+		},
+		Title:        summary.Title,
+		StartDate:    format.Date(summary.StartDate),
+		EndDate:      format.Date(summary.EndDate),
+		TotalActions: summary.TotalActions,
+		TotalValue:   format.Amount(summary.TotalValue),
+	}
+	for _, t := range summary.Templates {
+		data.Templates = append(data.Templates, summaryTotalData{Name: t.Name, Actions: t.Actions, Value: format.Amount(t.Value)})
+	}
+	for _, p := range summary.Partners {
+		data.Partners = append(data.Partners, summaryTotalData{Name: p.Name, Actions: p.Actions, Value: format.Amount(p.Value)})
+	}
+	for _, a := range summary.TopActions {
+		data.TopActions = append(data.TopActions, summaryActionData{
+			Title:      a.Title,
+			GiverName:  a.GiverName,
+			Amount:     format.Amount(a.AmountCents),
+			OccurredAt: format.Date(a.OccurredAt),
+		})
+	}
+
+	htmlBody, err := s.renderLayout(closingSummaryTemplate, data)
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return s.send(toEmail, fmt.Sprintf("Your PiggyBank %q has closed", summary.Title), htmlBody)
+}
+
+// send delivers an HTML email through the configured SMTP server.
+func (s Service) send(toEmail, subject, htmlBody string) error {
 	m := mail.NewMsg()
 	if err := m.From(s.from); err != nil {
 		return fmt.Errorf("failed to set from address: %w", err)
@@ -168,6 +333,91 @@ func (s Service) renderTemplate(templateStr string, data interface{}) (string, e
 	return buf.String(), nil
 }
 
+// renderLayout renders a content template inside the shared email layout. The
+// content template must define the "content" and "footer" blocks.
+func (s Service) renderLayout(contentTemplate string, data interface{}) (string, error) {
+	tmpl, err := template.New("layout").Parse(layoutTemplate)
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmpl.Parse(contentTemplate); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// actionEmailData feeds templates that ask the recipient to follow a link.
+type actionEmailData struct {
+	Heading   string
+	Name      string
+	ActionURL string
+	ValidFor  string
+}
+
+// householdInvitationData feeds the household invitation template.
+type householdInvitationData struct {
+	actionEmailData
+	InviterName   string
+	HouseholdName string
+	ExpiresAt     string
+}
+
+// closingSummaryData feeds the closing summary template.
+type closingSummaryData struct {
+	actionEmailData
+	Title        string
+	StartDate    string
+	EndDate      string
+	TotalActions int
+	TotalValue   string
+	Templates    []summaryTotalData
+	Partners     []summaryTotalData
+	TopActions   []summaryActionData
+}
+
+type summaryTotalData struct {
+	Name    string
+	Actions int
+	Value   string
+}
+
+type summaryActionData struct {
+	Title      string
+	GiverName  string
+	Amount     string
+	OccurredAt string
+}
+
+// formatDuration renders a validity period in a human friendly way.
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		days := int(d / (24 * time.Hour))
+		if days == 1 {
+			return "1 day"
+		}
+		return fmt.Sprintf("%d days", days)
+	case d >= time.Hour && d%time.Hour == 0:
+		hours := int(d / time.Hour)
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", hours)
+	default:
+		minutes := int(d / time.Minute)
+		if minutes == 1 {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+}
+
 const invitationTemplate = `
 <!DOCTYPE html>
 <html>
@@ -239,3 +489,166 @@ const invitationTemplate = `
 </body>
 </html>
 `
+
+const layoutTemplate = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <title>PiggyBank {{.Heading}}</title>
+    <style>
+        body {
+            font-family: Arial, sans-serif;
+            line-height: 1.6;
+            color: #333;
+            max-width: 600px;
+            margin: 0 auto;
+            padding: 20px;
+        }
+        .header {
+            background-color: #2f80ed;
+            color: white;
+            padding: 20px;
+            text-align: center;
+            border-radius: 8px 8px 0 0;
+        }
+        .content {
+            background-color: #f9fafb;
+            padding: 30px;
+            border-radius: 0 0 8px 8px;
+        }
+        .button {
+            display: inline-block;
+            background-color: #10b981;
+            color: white;
+            padding: 12px 24px;
+            text-decoration: none;
+            border-radius: 6px;
+            margin: 20px 0;
+            font-weight: bold;
+        }
+        .footer {
+            margin-top: 30px;
+            font-size: 12px;
+            color: #666;
+            text-align: center;
+        }
+    </style>
+</head>
+<body>
+    <div class="header">
+        <h1>🐷 PiggyBank</h1>
+        <h2>{{.Heading}}</h2>
+    </div>
+    <div class="content">
+        {{template "content" .}}
+    </div>
+    <div class="footer">
+        {{template "footer" .}}
+    </div>
+</body>
+</html>
+`
+
+const passwordResetTemplate = `
+{{define "content"}}
+        <p>Hello {{.Name}},</p>
+        <p>We received a request to reset the password of your PiggyBank account.</p>
+        <p>Click the button below to choose a new password:</p>
+        <a href="{{.ActionURL}}" class="button">Reset Password</a>
+        <p>If the button doesn't work, copy and paste this link into your browser:</p>
+        <p>{{.ActionURL}}</p>
+{{end}}
+{{define "footer"}}
+        <p>This link will expire in {{.ValidFor}} and can only be used once.</p>
+        <p>If you didn't request a password reset, you can safely ignore this email.</p>
+{{end}}
+`
+
+const emailVerificationTemplate = `
+{{define "content"}}
+        <p>Hello {{.Name}},</p>
+        <p>Please confirm that this is your email address so your partner can find you on PiggyBank.</p>
+        <a href="{{.ActionURL}}" class="button">Confirm Email</a>
+        <p>If the button doesn't work, copy and paste this link into your browser:</p>
+        <p>{{.ActionURL}}</p>
+{{end}}
+{{define "footer"}}
+        <p>This link will expire in {{.ValidFor}}.</p>
+        <p>If you didn't create a PiggyBank account, you can safely ignore this email.</p>
+{{end}}
+`
+
+const emailChangeTemplate = `
+{{define "content"}}
+        <p>Hello {{.Name}},</p>
+        <p>You asked to use this address for your PiggyBank account. Confirm the change with the button below:</p>
+        <a href="{{.ActionURL}}" class="button">Confirm New Email</a>
+        <p>If the button doesn't work, copy and paste this link into your browser:</p>
+        <p>{{.ActionURL}}</p>
+{{end}}
+{{define "footer"}}
+        <p>This link will expire in {{.ValidFor}}. Until then your account keeps using its current address.</p>
+        <p>If you didn't request this change, you can safely ignore this email.</p>
+{{end}}
+`
+
+const magicLinkTemplate = `
+{{define "content"}}
+        <p>Hello {{.Name}},</p>
+        <p>Use the button below to sign in to PiggyBank without a password:</p>
+        <a href="{{.ActionURL}}" class="button">Sign In</a>
+        <p>If the button doesn't work, copy and paste this link into your browser:</p>
+        <p>{{.ActionURL}}</p>
+{{end}}
+{{define "footer"}}
+        <p>This link will expire in {{.ValidFor}} and can only be used once.</p>
+        <p>If you didn't ask to sign in, you can safely ignore this email.</p>
+{{end}}
+`
+
+const householdInvitationTemplate = `
+{{define "content"}}
+        <p>Hello!</p>
+        <p><strong>{{.InviterName}}</strong> has invited you to join {{if .HouseholdName}}the household <strong>{{.HouseholdName}}</strong>{{else}}their household{{end}} on PiggyBank.</p>
+        <p>Click the button below to see the invitation and join:</p>
+        <a href="{{.ActionURL}}" class="button">View Invitation</a>
+        <p>If the button doesn't work, copy and paste this link into your browser:</p>
+        <p>{{.ActionURL}}</p>
+{{end}}
+{{define "footer"}}
+        <p>This invitation will expire in {{.ValidFor}}, on {{.ExpiresAt}}.</p>
+        <p>If you didn't expect this invitation, you can safely ignore this email.</p>
+{{end}}
+`
+
+const closingSummaryTemplate = `
+{{define "content"}}
+        <p>Hello {{.Name}},</p>
+        <p>The piggybank <strong>{{.Title}}</strong> ran from {{.StartDate}} to {{.EndDate}} and is now closed.</p>
+        <p>You logged <strong>{{.TotalActions}}</strong> actions worth <strong>{{.TotalValue}}</strong>.</p>
+        {{if .Partners}}
+        <h3>By member</h3>
+        <ul>
+            {{range .Partners}}<li>{{.Name}}: {{.Actions}} actions, {{.Value}}</li>
+            {{end}}
+        </ul>
+        {{end}}
+        {{if .Templates}}
+        <h3>By voucher</h3>
+        <ul>
+            {{range .Templates}}<li>{{.Name}}: {{.Actions}} actions, {{.Value}}</li>
+            {{end}}
+        </ul>
+        {{end}}
+        {{if .TopActions}}
+        <h3>Top actions</h3>
+        <ol>
+            {{range .TopActions}}<li>{{.Title}} by {{.GiverName}} on {{.OccurredAt}}: {{.Amount}}</li>
+            {{end}}
+        </ol>
+        {{end}}
+{{end}}
+{{define "footer"}}
+        <p>You receive this email because you are a member of this piggybank.</p>
+{{end}}
+`
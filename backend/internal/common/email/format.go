@@ -0,0 +1,54 @@
+package email
+
+import (
+	"math"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Formatting renders amounts and times for the readers of an email.
+type Formatting struct {
+	Currency string
+	Locale   string
+	Location *time.Location
+}
+
+// DefaultFormatting is used when no settings apply.
+var DefaultFormatting = Formatting{Currency: "EUR", Locale: "en", Location: time.UTC}
+
+// Amount renders an amount given in minor units of the currency, e.g. cents.
+func (f Formatting) Amount(minorUnits int) string {
+	unit, err := currency.ParseISO(f.Currency)
+	if err != nil {
+		unit = currency.EUR
+	}
+	tag, err := language.Parse(f.Locale)
+	if err != nil {
+		tag = language.English
+	}
+
+	scale, _ := currency.Standard.Rounding(unit)
+	value := float64(minorUnits) / math.Pow10(scale)
+	return message.NewPrinter(tag).Sprint(currency.Symbol(unit.Amount(value)))
+}
+
+// Time renders t in the reader's timezone.
+func (f Formatting) Time(t time.Time) string {
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format("Mon 2 Jan 2006 15:04 MST")
+}
+
+// Date renders the calendar date of t in the reader's timezone.
+func (f Formatting) Date(t time.Time) string {
+	loc := f.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format("Mon 2 Jan 2006")
+}
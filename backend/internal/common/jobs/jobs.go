@@ -0,0 +1,32 @@
+// Package jobs runs the periodic background work of the services.
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every calls run right away and then every interval until ctx is done. run
+// returns how many records it processed; a non-zero count is logged, and so is
+// an error unless it comes from ctx being cancelled.
+func Every(ctx context.Context, interval time.Duration, name string, run func(context.Context) (int, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if processed, err := run(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("%s failed: %v", name, err)
+			}
+		} else if processed > 0 {
+			log.Printf("%s processed %d records", name, processed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
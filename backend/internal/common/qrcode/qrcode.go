@@ -0,0 +1,495 @@
+// Package qrcode renders short payloads as QR codes (ISO/IEC 18004) using
+// byte mode, error correction level M and versions 1 to 10.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+var ErrTooLong = errors.New("payload too long for a QR code")
+
+// quietZone is the light border required around the symbol, in modules.
+const quietZone = 4
+
+// versionInfo holds the level M block structure of a version.
+type versionInfo struct {
+	rawCodewords int
+	blocks       int
+	eccPerBlock  int
+	alignment    []int
+}
+
+var versions = []versionInfo{
+	1:  {26, 1, 10, nil},
+	2:  {44, 1, 16, []int{6, 18}},
+	3:  {70, 1, 26, []int{6, 22}},
+	4:  {100, 2, 18, []int{6, 26}},
+	5:  {134, 2, 24, []int{6, 30}},
+	6:  {172, 4, 16, []int{6, 34}},
+	7:  {196, 4, 18, []int{6, 22, 38}},
+	8:  {242, 4, 22, []int{6, 24, 42}},
+	9:  {292, 5, 22, []int{6, 26, 46}},
+	10: {346, 5, 26, []int{6, 28, 50}},
+}
+
+// Code is an encoded QR symbol.
+type Code struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode builds the smallest QR code holding data.
+func Encode(data []byte) (Code, error) {
+	version := 0
+	for v := 1; v < len(versions); v++ {
+		info := versions[v]
+		capacity := (info.rawCodewords - info.blocks*info.eccPerBlock) * 8
+		if 4+countBits(v)+len(data)*8 <= capacity {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return Code{}, ErrTooLong
+	}
+
+	info := versions[version]
+	dataCodewords := info.rawCodewords - info.blocks*info.eccPerBlock
+
+	var bits bitBuffer
+	bits.append(0b0100, 4)
+	bits.append(len(data), countBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	capacity := dataCodewords * 8
+	if remaining := capacity - len(bits); remaining < 4 {
+		bits.append(0, remaining)
+	} else {
+		bits.append(0, 4)
+	}
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	codewords := interleave(bits.bytes(), info)
+
+	size := version*4 + 17
+	c := Code{size: size, modules: grid(size), function: grid(size)}
+	c.drawFunctionPatterns(version, info)
+	c.drawCodewords(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if penalty := c.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		c.applyMask(mask)
+	}
+	c.applyMask(best)
+	c.drawFormatBits(best)
+
+	return c, nil
+}
+
+// Size returns the width of the symbol in modules, without the quiet zone.
+func (c Code) Size() int {
+	return c.size
+}
+
+// Dark reports whether the module at column x and row y is dark.
+func (c Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.size && y < c.size && c.modules[y][x]
+}
+
+// PNG renders the code with scale pixels per module and a quiet zone.
+func (c Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (c.size + 2*quietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG renders the code as a scalable SVG document with a quiet zone.
+func (c Code) SVG() string {
+	width := c.size + 2*quietZone
+	var path strings.Builder
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+
+		`<rect width="100%%" height="100%%" fill="#FFFFFF"/><path d="%s" fill="#000000"/></svg>`,
+		width, width, path.String())
+}
+
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func grid(size int) [][]bool {
+	rows := make([][]bool, size)
+	for i := range rows {
+		rows[i] = make([]bool, size)
+	}
+	return rows
+}
+
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns(version int, info versionInfo) {
+	for i := 0; i < c.size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.size-4, 3)
+	c.drawFinder(3, c.size-4)
+
+	last := len(info.alignment) - 1
+	for i, x := range info.alignment {
+		for j, y := range info.alignment {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format areas; the real bits are drawn once the mask is chosen.
+	c.drawFormatBits(0)
+
+	if version >= 7 {
+		rem := version
+		for i := 0; i < 12; i++ {
+			rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+		}
+		bits := version<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 == 1
+			a, b := c.size-11+i%3, i/3
+			c.set(a, b, dark)
+			c.set(b, a, dark)
+		}
+	}
+}
+
+// drawFinder draws a finder pattern and its separator centred on (x, y).
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.size || yy >= c.size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.set(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the format information for level M.
+func (c *Code) drawFormatBits(mask int) {
+	data := 0b00<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 == 1 }
+
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.set(c.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.size-15+i, bit(i))
+	}
+	c.set(8, c.size-8, true)
+}
+
+// drawCodewords places the data in the zigzag order of the standard. Modules
+// left over at the end are remainder bits and stay light.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.size; vert++ {
+			y := vert
+			if upward {
+				y = c.size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.function[y][x] || i >= len(data)*8 {
+					continue
+				}
+				c.modules[y][x] = (data[i>>3]>>(7-i&7))&1 == 1
+				i++
+			}
+		}
+	}
+}
+
+// applyMask XORs the data modules with a mask pattern; applying it twice
+// restores the original.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the symbol with the four rules used to pick a mask.
+func (c Code) penalty() int {
+	score := 0
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	for _, horizontal := range []bool{true, false} {
+		at := func(line, i int) bool {
+			if horizontal {
+				return c.modules[line][i]
+			}
+			return c.modules[i][line]
+		}
+		for line := 0; line < c.size; line++ {
+			run := 1
+			for i := 1; i <= c.size; i++ {
+				if i < c.size && at(line, i) == at(line, i-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+
+			for i := 0; i+len(finderLike) <= c.size; i++ {
+				match := true
+				for k, dark := range finderLike {
+					if at(line, i+k) != dark {
+						match = false
+						break
+					}
+				}
+				if !match {
+					continue
+				}
+				lightBefore, lightAfter := true, true
+				for k := 1; k <= 4; k++ {
+					if i-k >= 0 && at(line, i-k) {
+						lightBefore = false
+					}
+					if j := i + len(finderLike) - 1 + k; j < c.size && at(line, j) {
+						lightAfter = false
+					}
+				}
+				if lightBefore || lightAfter {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < c.size; y++ {
+		for x := 0; x < c.size; x++ {
+			if c.modules[y][x] {
+				dark++
+			}
+			if x+1 < c.size && y+1 < c.size {
+				m := c.modules[y][x]
+				if m == c.modules[y][x+1] && m == c.modules[y+1][x] && m == c.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	total := c.size * c.size
+	score += ((abs(dark*20-total*10)+total-1)/total - 1) * 10
+
+	return score
+}
+
+// interleave splits data into blocks, appends the error correction codewords
+// of each block and interleaves the result.
+func interleave(data []byte, info versionInfo) []byte {
+	shortBlocks := info.blocks - info.rawCodewords%info.blocks
+	shortLen := info.rawCodewords/info.blocks - info.eccPerBlock
+	divisor := rsDivisor(info.eccPerBlock)
+
+	dataBlocks := make([][]byte, info.blocks)
+	eccBlocks := make([][]byte, info.blocks)
+	offset := 0
+	for i := range dataBlocks {
+		n := shortLen
+		if i >= shortBlocks {
+			n++
+		}
+		dataBlocks[i] = data[offset : offset+n]
+		eccBlocks[i] = rsRemainder(dataBlocks[i], divisor)
+		offset += n
+	}
+
+	result := make([]byte, 0, info.rawCodewords)
+	for i := 0; i <= shortLen; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.eccPerBlock; i++ {
+		for _, block := range eccBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// rsDivisor returns the Reed-Solomon generator polynomial of the given degree
+// over GF(2^8/0x11D), highest coefficient omitted.
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>i)&1) * int(x)
+	}
+	return byte(z)
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		*b = append(*b, (value>>i)&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			result[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return result
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
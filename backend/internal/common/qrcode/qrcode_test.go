@@ -0,0 +1,390 @@
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// The tests decode symbols with a reader written from the standard rather
+// than from the encoder: it checks the format and version information against
+// the tables of ISO/IEC 18004, verifies each block with Reed-Solomon syndromes
+// and parses the byte mode segment back.
+
+// formatStrings are the level M format information strings, by mask.
+var formatStrings = [8]int{
+	0b101010000010010,
+	0b101000100100101,
+	0b101111001111100,
+	0b101101101001011,
+	0b100010111111001,
+	0b100000011001110,
+	0b100111110010111,
+	0b100101010100000,
+}
+
+// versionStrings are the version information strings of versions 7 to 10.
+var versionStrings = map[int]int{
+	7:  0x07C94,
+	8:  0x085BC,
+	9:  0x09A99,
+	10: 0x0A4D3,
+}
+
+// byteCapacities is the number of bytes versions 1 to 10 hold at level M.
+var byteCapacities = []int{1: 14, 26, 42, 62, 84, 106, 122, 152, 180, 213}
+
+func TestRSRemainderKnownVector(t *testing.T) {
+	// Version 1-M "HELLO WORLD", the worked example of the standard.
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Fatalf("ecc = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	payloads := []string{
+		"",
+		"A",
+		"https://piggybank.zenith.ovh/pair/7F3K-9QXZ",
+		strings.Repeat("piggybank", 20),
+	}
+	for version := 1; version < len(byteCapacities); version++ {
+		payloads = append(payloads, strings.Repeat("x", byteCapacities[version]))
+	}
+
+	for _, payload := range payloads {
+		code, err := Encode([]byte(payload))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes): %v", len(payload), err)
+		}
+		decoded, err := decode(code)
+		if err != nil {
+			t.Fatalf("decode(%d bytes): %v", len(payload), err)
+		}
+		if decoded != payload {
+			t.Fatalf("decoded %q, want %q", decoded, payload)
+		}
+	}
+}
+
+func TestEncodePicksSmallestVersion(t *testing.T) {
+	for version := 1; version < len(byteCapacities); version++ {
+		code, err := Encode(make([]byte, byteCapacities[version]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := version*4 + 17; code.Size() != want {
+			t.Fatalf("%d bytes: size %d, want %d", byteCapacities[version], code.Size(), want)
+		}
+		if version+1 < len(byteCapacities) {
+			code, err = Encode(make([]byte, byteCapacities[version]+1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (version+1)*4 + 17; code.Size() != want {
+				t.Fatalf("%d bytes: size %d, want %d", byteCapacities[version]+1, code.Size(), want)
+			}
+		}
+	}
+
+	if _, err := Encode(make([]byte, byteCapacities[10]+1)); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("err = %v, want %v", err, ErrTooLong)
+	}
+}
+
+// decode reads the payload of a byte mode, level M symbol.
+func decode(code Code) (string, error) {
+	size := code.Size()
+	version := (size - 17) / 4
+	if version < 1 || version >= len(versions) || version*4+17 != size {
+		return "", fmt.Errorf("unexpected size %d", size)
+	}
+
+	mask, err := readFormat(code)
+	if err != nil {
+		return "", err
+	}
+	if version >= 7 {
+		if err := checkVersion(code, version); err != nil {
+			return "", err
+		}
+	}
+	for i := 8; i < size-8; i++ {
+		if code.Dark(i, 6) != (i%2 == 0) || code.Dark(6, i) != (i%2 == 0) {
+			return "", fmt.Errorf("broken timing pattern at %d", i)
+		}
+	}
+	if !code.Dark(8, size-8) {
+		return "", fmt.Errorf("dark module missing")
+	}
+
+	reserved := functionModules(version)
+	var bits []bool
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < size; vert++ {
+			y := vert
+			if (right+1)&2 == 0 {
+				y = size - 1 - vert
+			}
+			for x := right; x >= right-1; x-- {
+				if reserved[y][x] {
+					continue
+				}
+				bits = append(bits, code.Dark(x, y) != masked(mask, x, y))
+			}
+		}
+	}
+
+	info := versions[version]
+	if len(bits)/8 != info.rawCodewords {
+		return "", fmt.Errorf("%d codewords, want %d", len(bits)/8, info.rawCodewords)
+	}
+	codewords := make([]byte, info.rawCodewords)
+	for i := range codewords {
+		for _, bit := range bits[i*8 : i*8+8] {
+			codewords[i] <<= 1
+			if bit {
+				codewords[i] |= 1
+			}
+		}
+	}
+
+	data, err := deinterleave(codewords, info)
+	if err != nil {
+		return "", err
+	}
+	return parseByteSegment(data, version)
+}
+
+// readFormat checks that both copies of the format information agree and
+// name level M, and returns the mask.
+func readFormat(code Code) (int, error) {
+	size := code.Size()
+	var first, second int
+	for i := 0; i < 15; i++ {
+		var x1, y1, x2, y2 int
+		switch {
+		case i < 6:
+			x1, y1 = 8, i
+		case i < 8:
+			x1, y1 = 8, i+1
+		case i == 8:
+			x1, y1 = 7, 8
+		default:
+			x1, y1 = 14-i, 8
+		}
+		if i < 8 {
+			x2, y2 = size-1-i, 8
+		} else {
+			x2, y2 = 8, size-15+i
+		}
+		if code.Dark(x1, y1) {
+			first |= 1 << i
+		}
+		if code.Dark(x2, y2) {
+			second |= 1 << i
+		}
+	}
+	if first != second {
+		return 0, fmt.Errorf("format copies differ: %015b and %015b", first, second)
+	}
+	for mask, format := range formatStrings {
+		if format == first {
+			return mask, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid format information %015b", first)
+}
+
+// checkVersion checks both copies of the version information.
+func checkVersion(code Code, version int) error {
+	size := code.Size()
+	var first, second int
+	for i := 0; i < 18; i++ {
+		a, b := size-11+i%3, i/3
+		if code.Dark(a, b) {
+			first |= 1 << i
+		}
+		if code.Dark(b, a) {
+			second |= 1 << i
+		}
+	}
+	if first != versionStrings[version] || second != versionStrings[version] {
+		return fmt.Errorf("version information %018b and %018b, want %018b", first, second, versionStrings[version])
+	}
+	return nil
+}
+
+// functionModules marks the modules that carry no data.
+func functionModules(version int) [][]bool {
+	size := version*4 + 17
+	reserved := grid(size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// Finders with their separators and the format areas.
+			reserved[y][x] = (x < 9 && y < 9) || (x >= size-8 && y < 9) || (x < 9 && y >= size-8) || x == 6 || y == 6
+			if version >= 7 {
+				reserved[y][x] = reserved[y][x] || (x >= size-11 && x < size-8 && y < 6) || (y >= size-11 && y < size-8 && x < 6)
+			}
+		}
+	}
+
+	centres := versions[version].alignment
+	for _, cx := range centres {
+		for _, cy := range centres {
+			if (cx < 9 && cy < 9) || (cx >= size-8 && cy < 9) || (cx < 9 && cy >= size-8) {
+				continue // would overlap a finder
+			}
+			for y := cy - 2; y <= cy+2; y++ {
+				for x := cx - 2; x <= cx+2; x++ {
+					reserved[y][x] = true
+				}
+			}
+		}
+	}
+	return reserved
+}
+
+// masked reports whether the mask pattern inverts the module in row y,
+// column x.
+func masked(mask, x, y int) bool {
+	i, j := y, x
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// deinterleave splits the codewords into blocks, checks each block's
+// Reed-Solomon syndromes and returns the data codewords in order.
+func deinterleave(codewords []byte, info versionInfo) ([]byte, error) {
+	shortBlocks := info.blocks - info.rawCodewords%info.blocks
+	shortData := info.rawCodewords/info.blocks - info.eccPerBlock
+
+	blocks := make([][]byte, info.blocks)
+	k := 0
+	for i := 0; i <= shortData; i++ {
+		for b := range blocks {
+			if i < shortData || b >= shortBlocks {
+				blocks[b] = append(blocks[b], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < info.eccPerBlock; i++ {
+		for b := range blocks {
+			blocks[b] = append(blocks[b], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for b, block := range blocks {
+		for i := 0; i < info.eccPerBlock; i++ {
+			if syndrome(block, i) != 0 {
+				return nil, fmt.Errorf("block %d fails Reed-Solomon check %d", b, i)
+			}
+		}
+		data = append(data, block[:len(block)-info.eccPerBlock]...)
+	}
+	return data, nil
+}
+
+// syndrome evaluates the block, read as a polynomial with its first codeword
+// as the highest coefficient, at alpha^i.
+func syndrome(block []byte, i int) byte {
+	point := byte(1)
+	for n := 0; n < i; n++ {
+		point = gfDouble(point)
+	}
+	var result byte
+	for _, c := range block {
+		result = gfProduct(result, point) ^ c
+	}
+	return result
+}
+
+func gfDouble(x byte) byte {
+	if x&0x80 != 0 {
+		return x<<1 ^ 0x1D
+	}
+	return x << 1
+}
+
+func gfProduct(x, y byte) byte {
+	var result byte
+	for ; y != 0; y >>= 1 {
+		if y&1 != 0 {
+			result ^= x
+		}
+		x = gfDouble(x)
+	}
+	return result
+}
+
+// parseByteSegment reads a single byte mode segment followed by the
+// terminator and the alternating pad codewords.
+func parseByteSegment(data []byte, version int) (string, error) {
+	pos := 0
+	read := func(n int) int {
+		value := 0
+		for i := 0; i < n; i++ {
+			value <<= 1
+			if pos < len(data)*8 && data[pos/8]>>(7-pos%8)&1 == 1 {
+				value |= 1
+			}
+			pos++
+		}
+		return value
+	}
+
+	if mode := read(4); mode != 0b0100 {
+		return "", fmt.Errorf("mode %04b, want byte mode", mode)
+	}
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	length := read(countBits)
+	if pos+length*8 > len(data)*8 {
+		return "", fmt.Errorf("length %d overflows the symbol", length)
+	}
+	payload := make([]byte, length)
+	for i := range payload {
+		payload[i] = byte(read(8))
+	}
+
+	if terminator := min(4, len(data)*8-pos); read(terminator) != 0 {
+		return "", fmt.Errorf("missing terminator")
+	}
+	if pos%8 != 0 && read(8-pos%8) != 0 {
+		return "", fmt.Errorf("non-zero padding bits")
+	}
+	for i, pad := 0, byte(0xEC); pos/8+i < len(data); i, pad = i+1, pad^0xEC^0x11 {
+		if data[pos/8+i] != pad {
+			return "", fmt.Errorf("pad codeword %d is %#x, want %#x", i, data[pos/8+i], pad)
+		}
+	}
+	return string(payload), nil
+}
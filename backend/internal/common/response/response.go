@@ -3,7 +3,10 @@ package response
 import (
 	"encoding/json"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 type errorResponse struct {
@@ -50,6 +53,16 @@ func Conflict(w http.ResponseWriter, message string) {
 	Error(w, http.StatusConflict, message)
 }
 
+// TooManyRequests writes a 429 response with a Retry-After header in seconds.
+func TooManyRequests(w http.ResponseWriter, message string, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	Error(w, http.StatusTooManyRequests, message)
+}
+
 // InternalError writes a 500 response with a generic message and logs the error.
 func InternalError(w http.ResponseWriter, err error) {
 	log.Printf("internal error: %v", err)
@@ -2,22 +2,37 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
 // Config aggregates all runtime configuration values for the application.
 type Config struct {
 	App struct {
-		Port string
+		Port           string
+		TrustedProxies []string
 	}
 	Database struct {
 		URL string
 	}
 	Auth struct {
-		AccessTokenSecret string
-		AccessTokenTTL    time.Duration
+		AccessTokenSecret      string
+		AccessTokenSecretKeyID string
+		SigningKeysDir         string
+		ActiveSigningKeyID     string
+		AccessTokenTTL         time.Duration
+		RefreshTokenTTL        time.Duration
+		AttemptStore           string
+	}
+	OIDC struct {
+		Providers []OIDCProvider
+	}
+	Couples struct {
+		RequireVerifiedEmail bool
 	}
 	Email struct {
 		SMTPHost string
@@ -31,11 +46,29 @@ type Config struct {
 	}
 }
 
+// OIDCProvider configures an OpenID Connect provider users can sign in with.
+type OIDCProvider struct {
+	Name         string
+	DisplayName  string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
 // Load reads configuration from the environment and applies sane defaults.
 func Load() (Config, error) {
 	var cfg Config
 
 	cfg.App.Port = getenvDefault("APP_PORT", "8080")
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			cfg.App.TrustedProxies = append(cfg.App.TrustedProxies, proxy)
+		}
+	}
 
 	cfg.Database.URL = os.Getenv("DATABASE_URL")
 	if cfg.Database.URL == "" {
@@ -43,17 +76,45 @@ func Load() (Config, error) {
 	}
 
 	cfg.Auth.AccessTokenSecret = os.Getenv("JWT_ACCESS_SECRET")
-	if cfg.Auth.AccessTokenSecret == "" {
-		return Config{}, errors.New("JWT_ACCESS_SECRET is required")
+	cfg.Auth.AccessTokenSecretKeyID = getenvDefault("JWT_ACCESS_SECRET_KID", "default")
+	cfg.Auth.SigningKeysDir = os.Getenv("JWT_KEYS_DIR")
+	cfg.Auth.ActiveSigningKeyID = os.Getenv("JWT_ACTIVE_KID")
+	if cfg.Auth.AccessTokenSecret == "" && cfg.Auth.SigningKeysDir == "" {
+		return Config{}, errors.New("JWT_ACCESS_SECRET or JWT_KEYS_DIR is required")
+	}
+	if cfg.Auth.SigningKeysDir != "" && cfg.Auth.ActiveSigningKeyID == "" && cfg.Auth.AccessTokenSecret == "" {
+		return Config{}, errors.New("JWT_ACTIVE_KID is required when signing keys are loaded from JWT_KEYS_DIR")
 	}
 
-    ttlString := getenvDefault("JWT_ACCESS_TTL", "604800")
+	ttlString := getenvDefault("JWT_ACCESS_TTL", "604800")
 	ttlSeconds, err := strconv.Atoi(ttlString)
 	if err != nil {
 		return Config{}, errors.New("JWT_ACCESS_TTL must be an integer representing seconds")
 	}
 	cfg.Auth.AccessTokenTTL = time.Duration(ttlSeconds) * time.Second
 
+	refreshTTLSeconds, err := strconv.Atoi(getenvDefault("JWT_REFRESH_TTL", "2592000"))
+	if err != nil {
+		return Config{}, errors.New("JWT_REFRESH_TTL must be an integer representing seconds")
+	}
+	cfg.Auth.RefreshTokenTTL = time.Duration(refreshTTLSeconds) * time.Second
+
+	cfg.Auth.AttemptStore = getenvDefault("AUTH_ATTEMPT_STORE", "memory")
+	if cfg.Auth.AttemptStore != "memory" && cfg.Auth.AttemptStore != "postgres" {
+		return Config{}, errors.New("AUTH_ATTEMPT_STORE must be memory or postgres")
+	}
+
+	cfg.OIDC.Providers, err = loadOIDCProviders()
+	if err != nil {
+		return Config{}, err
+	}
+
+	requireVerified, err := strconv.ParseBool(getenvDefault("COUPLES_REQUIRE_VERIFIED_EMAIL", "false"))
+	if err != nil {
+		return Config{}, errors.New("COUPLES_REQUIRE_VERIFIED_EMAIL must be a boolean")
+	}
+	cfg.Couples.RequireVerifiedEmail = requireVerified
+
 	cfg.Email.SMTPHost = getenvDefault("SMTP_HOST", "")
 	cfg.Email.SMTPPort = getenvDefault("SMTP_PORT", "587")
 	cfg.Email.Username = getenvDefault("SMTP_USERNAME", "")
@@ -65,6 +126,38 @@ func Load() (Config, error) {
 	return cfg, nil
 }
 
+// loadOIDCProviders reads the providers listed in OIDC_PROVIDERS. Each name is
+// configured through OIDC_<NAME>_* variables, with dashes turned into
+// underscores.
+func loadOIDCProviders() ([]OIDCProvider, error) {
+	var providers []OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !providerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProvider{
+			Name:         name,
+			DisplayName:  getenvDefault(prefix+"DISPLAY_NAME", name),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       strings.Fields(getenvDefault(prefix+"SCOPES", "openid email profile")),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" || provider.RedirectURL == "" {
+			return nil, fmt.Errorf("%sISSUER, %sCLIENT_ID and %sREDIRECT_URL are required", prefix, prefix, prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
 func getenvDefault(key, fallback string) string {
 	value := os.Getenv(key)
 	if value == "" {
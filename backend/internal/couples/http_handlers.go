@@ -1,6 +1,7 @@
 package couples
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -28,13 +29,52 @@ type requestCouplePayload struct {
 }
 
 type acceptCouplePayload struct {
-	RequestID string `json:"requestId"`
+	RequestID  string `json:"requestId"`
+	PromoteAll bool   `json:"promoteAll"`
+}
+
+type acceptInvitationPayload struct {
+	PromoteAll bool `json:"promoteAll"`
 }
 
 type resendCouplePayload struct {
 	RequestID string `json:"requestId"`
 }
 
+type closeRequestPayload struct {
+	RequestID string `json:"requestId"`
+}
+
+type leaveCouplePayload struct {
+	Fate        string            `json:"fate"`
+	Assignments map[string]string `json:"assignments"`
+}
+
+type pastCoupleResponse struct {
+	ID        string      `json:"id"`
+	Partner   userSummary `json:"partner"`
+	CreatedAt string      `json:"createdAt"`
+	EndedAt   string      `json:"endedAt"`
+	EndedBy   *string     `json:"endedBy"`
+}
+
+type invitationPreviewResponse struct {
+	InviterName string `json:"inviterName"`
+	Status      string `json:"status"`
+	ExpiresAt   string `json:"expiresAt"`
+}
+
+type redeemPairingCodePayload struct {
+	Code       string `json:"code"`
+	PromoteAll bool   `json:"promoteAll"`
+}
+
+type pairingCodeResponse struct {
+	Code      string `json:"code"`
+	ExpiresAt string `json:"expiresAt"`
+	QRCodeURL string `json:"qrCodeUrl"`
+}
+
 type coupleResponse struct {
 	ID        string      `json:"id"`
 	Partner   userSummary `json:"partner"`
@@ -47,6 +87,7 @@ type requestResponse struct {
 	Status    string      `json:"status"`
 	Partner   userSummary `json:"partner"`
 	CreatedAt string      `json:"createdAt"`
+	ExpiresAt string      `json:"expiresAt"`
 }
 
 type statusResponse struct {
@@ -80,6 +121,8 @@ func (h Handler) Request(w http.ResponseWriter, r *http.Request) {
 		switch {
 		case errors.Is(err, ErrPartnerRequired), errors.Is(err, ErrInvalidPartnerEmail), errors.Is(err, ErrCannotInviteSelf):
 			response.BadRequest(w, err.Error())
+		case errors.Is(err, ErrEmailNotVerified):
+			response.Forbidden(w, err.Error())
 		case errors.Is(err, ErrAlreadyCoupled), errors.Is(err, ErrPendingRequestExists):
 			response.Conflict(w, err.Error())
 		default:
@@ -94,6 +137,7 @@ func (h Handler) Request(w http.ResponseWriter, r *http.Request) {
 		Status:    view.Request.Status,
 		Partner:   mapUserSummary(partner),
 		CreatedAt: view.Request.CreatedAt.Format(time.RFC3339),
+		ExpiresAt: view.Request.ExpiresAt.Format(time.RFC3339),
 	}
 
 	response.JSON(w, http.StatusCreated, resp)
@@ -119,15 +163,17 @@ func (h Handler) Accept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	view, requester, target, err := h.service.AcceptCouple(r.Context(), requestID, user.ID)
+	view, requester, target, err := h.service.AcceptCouple(r.Context(), requestID, user.ID, payload.PromoteAll)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrRequestNotFound):
 			response.NotFound(w, err.Error())
-		case errors.Is(err, ErrRequestNotAuthorized):
+		case errors.Is(err, ErrRequestNotAuthorized), errors.Is(err, ErrEmailNotVerified):
 			response.Forbidden(w, err.Error())
 		case errors.Is(err, ErrAlreadyCoupled), errors.Is(err, ErrRequestNotPending):
 			response.Conflict(w, err.Error())
+		case errors.Is(err, ErrRequestExpired):
+			response.Error(w, http.StatusGone, err.Error())
 		default:
 			response.InternalError(w, err)
 		}
@@ -177,6 +223,8 @@ func (h Handler) Resend(w http.ResponseWriter, r *http.Request) {
 			response.Forbidden(w, err.Error())
 		case errors.Is(err, ErrRequestNotPending):
 			response.Conflict(w, err.Error())
+		case errors.Is(err, ErrRequestExpired):
+			response.Error(w, http.StatusGone, err.Error())
 		default:
 			response.InternalError(w, err)
 		}
@@ -186,6 +234,309 @@ func (h Handler) Resend(w http.ResponseWriter, r *http.Request) {
 	response.JSON(w, http.StatusOK, map[string]string{"message": "invitation resent"})
 }
 
+// Reject handles POST /couples/reject.
+func (h Handler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.closeRequest(w, r, h.service.RejectCouple, "request rejected")
+}
+
+// Cancel handles POST /couples/cancel.
+func (h Handler) Cancel(w http.ResponseWriter, r *http.Request) {
+	h.closeRequest(w, r, h.service.CancelCouple, "request cancelled")
+}
+
+func (h Handler) closeRequest(w http.ResponseWriter, r *http.Request, update func(context.Context, uuid.UUID, uuid.UUID) error, message string) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var payload closeRequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	requestID, err := uuid.Parse(payload.RequestID)
+	if err != nil {
+		response.BadRequest(w, "invalid requestId")
+		return
+	}
+
+	if err := update(r.Context(), requestID, user.ID); err != nil {
+		switch {
+		case errors.Is(err, ErrRequestNotFound):
+			response.NotFound(w, err.Error())
+		case errors.Is(err, ErrRequestNotAuthorized):
+			response.Forbidden(w, err.Error())
+		case errors.Is(err, ErrRequestNotPending):
+			response.Conflict(w, err.Error())
+		case errors.Is(err, ErrRequestExpired):
+			response.Error(w, http.StatusGone, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": message})
+}
+
+// PreviewInvitation handles GET /couples/invitations/{token}. It is public:
+// holding the token proves the invitation email was received.
+func (h Handler) PreviewInvitation(w http.ResponseWriter, r *http.Request) {
+	preview, err := h.service.PreviewInvitation(r.Context(), r.PathValue("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidInvitation):
+			response.NotFound(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusOK, invitationPreviewResponse{
+		InviterName: preview.InviterName,
+		Status:      preview.Status,
+		ExpiresAt:   preview.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// AcceptInvitation handles POST /couples/invitations/{token}/accept.
+func (h Handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var payload acceptInvitationPayload
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			response.BadRequest(w, "invalid payload")
+			return
+		}
+	}
+
+	view, requester, target, err := h.service.AcceptInvitation(r.Context(), r.PathValue("token"), user, payload.PromoteAll)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidInvitation), errors.Is(err, ErrRequestNotFound):
+			response.NotFound(w, err.Error())
+		case errors.Is(err, ErrRequestNotAuthorized), errors.Is(err, ErrEmailNotVerified):
+			response.Forbidden(w, err.Error())
+		case errors.Is(err, ErrAlreadyCoupled), errors.Is(err, ErrRequestNotPending):
+			response.Conflict(w, err.Error())
+		case errors.Is(err, ErrRequestExpired):
+			response.Error(w, http.StatusGone, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	partner := requester
+	if requester.ID == user.ID {
+		partner = target
+	}
+
+	response.JSON(w, http.StatusOK, coupleResponse{
+		ID:        view.Couple.ID.String(),
+		Partner:   mapUserSummary(partner),
+		CreatedAt: view.Couple.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// CreatePairingCode handles POST /couples/pairing-codes.
+func (h Handler) CreatePairingCode(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	code, expiresAt, err := h.service.CreatePairingCode(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrEmailNotVerified):
+			response.Forbidden(w, err.Error())
+		case errors.Is(err, ErrAlreadyCoupled):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, pairingCodeResponse{
+		Code:      code,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+		QRCodeURL: "/couples/pairing-codes/" + code + "/qr",
+	})
+}
+
+// PairingQRCode handles GET /couples/pairing-codes/{code}/qr. The image is a
+// PNG unless format=svg is requested.
+func (h Handler) PairingQRCode(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	code, err := h.service.PairingQRCode(r.Context(), user.ID, r.PathValue("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidPairingCode):
+			response.NotFound(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	switch r.URL.Query().Get("format") {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(code.SVG()))
+	case "", "png":
+		image, err := code.PNG(8)
+		if err != nil {
+			response.InternalError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(image)
+	default:
+		response.BadRequest(w, "format must be png or svg")
+	}
+}
+
+// RedeemPairingCode handles POST /couples/pairing-codes/redeem.
+func (h Handler) RedeemPairingCode(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var payload redeemPairingCodePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	view, partner, err := h.service.RedeemPairingCode(r.Context(), user, payload.Code, auth.ClientInfoFromRequest(r).IPAddress, payload.PromoteAll)
+	if err != nil {
+		var limited *auth.RateLimitError
+		switch {
+		case errors.As(err, &limited):
+			response.TooManyRequests(w, auth.ErrTooManyAttempts.Error(), limited.RetryAfter)
+		case errors.Is(err, ErrInvalidPairingCode), errors.Is(err, ErrCannotInviteSelf):
+			response.BadRequest(w, err.Error())
+		case errors.Is(err, ErrEmailNotVerified):
+			response.Forbidden(w, err.Error())
+		case errors.Is(err, ErrAlreadyCoupled):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, coupleResponse{
+		ID:        view.Couple.ID.String(),
+		Partner:   mapUserSummary(partner),
+		CreatedAt: view.Couple.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// Leave handles POST /couples/leave.
+func (h Handler) Leave(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var payload leaveCouplePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	assignments := make(map[uuid.UUID]uuid.UUID, len(payload.Assignments))
+	for piggyBankID, ownerID := range payload.Assignments {
+		pbID, err := uuid.Parse(piggyBankID)
+		if err != nil {
+			response.BadRequest(w, "invalid piggybank id in assignments")
+			return
+		}
+		userID, err := uuid.Parse(ownerID)
+		if err != nil {
+			response.BadRequest(w, "invalid user id in assignments")
+			return
+		}
+		assignments[pbID] = userID
+	}
+
+	couple, err := h.service.LeaveCouple(r.Context(), user.ID, PiggyBankFate(payload.Fate), assignments)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotCoupled):
+			response.NotFound(w, err.Error())
+		case errors.Is(err, ErrInvalidFate), errors.Is(err, ErrInvalidAssignment):
+			response.BadRequest(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	partner, err := h.service.users.GetByID(r.Context(), couple.PartnerOf(user.ID))
+	if err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, mapPastCouple(couple, partner))
+}
+
+// History handles GET /couples/history.
+func (h Handler) History(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	views, err := h.service.History(r.Context(), user.ID)
+	if err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	resp := make([]pastCoupleResponse, 0, len(views))
+	for _, view := range views {
+		partner, err := h.service.users.GetByID(r.Context(), view.PartnerID)
+		if err != nil {
+			if !errors.Is(err, users.ErrNotFound) {
+				response.InternalError(w, err)
+				return
+			}
+			// The former partner deleted their account.
+			partner = users.User{ID: view.PartnerID}
+		}
+		resp = append(resp, mapPastCouple(view.Couple, partner))
+	}
+
+	response.JSON(w, http.StatusOK, resp)
+}
+
 // Status handles GET /couples/me.
 func (h Handler) Status(w http.ResponseWriter, r *http.Request) {
 	user, ok := auth.UserFromContext(r.Context())
@@ -255,6 +606,7 @@ func (h Handler) Status(w http.ResponseWriter, r *http.Request) {
 			Status:    view.Request.Status,
 			Partner:   summary,
 			CreatedAt: view.Request.CreatedAt.Format(time.RFC3339),
+			ExpiresAt: view.Request.ExpiresAt.Format(time.RFC3339),
 		}, nil
 	}
 
@@ -294,3 +646,19 @@ func mapUserSummary(user users.User) userSummary {
 		Name:  user.Name,
 	}
 }
+
+func mapPastCouple(couple Couple, partner users.User) pastCoupleResponse {
+	resp := pastCoupleResponse{
+		ID:        couple.ID.String(),
+		Partner:   mapUserSummary(partner),
+		CreatedAt: couple.CreatedAt.Format(time.RFC3339),
+	}
+	if couple.EndedAt != nil {
+		resp.EndedAt = couple.EndedAt.Format(time.RFC3339)
+	}
+	if couple.EndedByUserID != nil {
+		endedBy := couple.EndedByUserID.String()
+		resp.EndedBy = &endedBy
+	}
+	return resp
+}
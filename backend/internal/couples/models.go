@@ -7,19 +7,51 @@ import (
 )
 
 const (
-	StatusPending  = "pending"
-	StatusAccepted = "accepted"
-	StatusRejected = "rejected"
+	StatusPending   = "pending"
+	StatusAccepted  = "accepted"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
 )
 
-// Couple represents a committed pair of partners.
+// RequestTTL is how long an invitation can be accepted, as promised in the
+// invitation email.
+const RequestTTL = 7 * 24 * time.Hour
+
+// Couple represents a committed pair of partners. A dissolved couple keeps
+// its row as history with EndedAt set.
 type Couple struct {
 	ID             uuid.UUID
 	Partner1UserID uuid.UUID
 	Partner2UserID uuid.UUID
 	CreatedAt      time.Time
+	EndedAt        *time.Time
+	EndedByUserID  *uuid.UUID
+}
+
+// PartnerOf returns the other partner of userID.
+func (c Couple) PartnerOf(userID uuid.UUID) uuid.UUID {
+	if c.Partner1UserID == userID {
+		return c.Partner2UserID
+	}
+	return c.Partner1UserID
 }
 
+// PiggyBankFate decides what happens to shared piggybanks when a couple is
+// dissolved.
+type PiggyBankFate string
+
+const (
+	// FateArchive keeps the piggybanks on the ended couple, read-only for
+	// both former partners.
+	FateArchive PiggyBankFate = "archive"
+	// FateDuplicate gives each partner a solo copy with its templates and
+	// action entries.
+	FateDuplicate PiggyBankFate = "duplicate"
+	// FateAssign hands each piggybank to the partner chosen for it.
+	FateAssign PiggyBankFate = "assign"
+)
+
 // CoupleRequest captures the invitation workflow between two partners.
 type CoupleRequest struct {
 	ID              uuid.UUID
@@ -29,9 +61,39 @@ type CoupleRequest struct {
 	InvitationToken *string
 	Status          string
 	CreatedAt       time.Time
+	ExpiresAt       time.Time
 	RespondedAt     *time.Time
 }
 
+// Expired reports whether a pending request can no longer be answered.
+func (r CoupleRequest) Expired(now time.Time) bool {
+	return r.Status == StatusPending && !now.Before(r.ExpiresAt)
+}
+
+// InvitationPreview is the public summary of an invitation shown to whoever
+// holds its token.
+type InvitationPreview struct {
+	InviterName string
+	Status      string
+	ExpiresAt   time.Time
+}
+
+// PairingCodeTTL is how long a pairing code can be redeemed. Codes are meant
+// to be exchanged by partners sitting together.
+const PairingCodeTTL = 10 * time.Minute
+
+// PairingCode is a short code that lets another user pair with its creator
+// without an invitation email. Only a hash of the code is stored.
+type PairingCode struct {
+	ID           uuid.UUID
+	UserID       uuid.UUID
+	CodeHash     string
+	ExpiresAt    time.Time
+	CreatedAt    time.Time
+	UsedAt       *time.Time
+	UsedByUserID *uuid.UUID
+}
+
 // Direction indicates whether a request is incoming or outgoing relative to a user.
 type Direction string
 
@@ -0,0 +1,71 @@
+package couples
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// pairingAlphabet is Crockford's base32: no I, L, O or U, so codes survive
+// being read aloud or typed from a screen.
+const pairingAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+const pairingCodeLength = 8
+
+// generatePairingCode returns a random code formatted as XXXX-XXXX.
+func generatePairingCode() (string, error) {
+	raw := make([]byte, pairingCodeLength)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for i, v := range raw {
+		if i == pairingCodeLength/2 {
+			b.WriteByte('-')
+		}
+		b.WriteByte(pairingAlphabet[v&31])
+	}
+	return b.String(), nil
+}
+
+// normalizePairingCode canonicalises user input: case, separators and the
+// letters commonly mistaken for digits are ignored. It reports false when the
+// input cannot be a pairing code.
+func normalizePairingCode(code string) (string, bool) {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(code) {
+		switch r {
+		case '-', ' ':
+			continue
+		case 'O':
+			r = '0'
+		case 'I', 'L':
+			r = '1'
+		}
+		if !strings.ContainsRune(pairingAlphabet, r) {
+			return "", false
+		}
+		b.WriteRune(r)
+	}
+
+	normalized := b.String()
+	if len(normalized) != pairingCodeLength {
+		return "", false
+	}
+	return normalized[:pairingCodeLength/2] + "-" + normalized[pairingCodeLength/2:], true
+}
+
+func hashPairingCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func pairingUserAttemptKey(userID string) string {
+	return "pairing:user:" + userID
+}
+
+func pairingIPAttemptKey(ip string) string {
+	return "pairing:ip:" + ip
+}
@@ -6,13 +6,17 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log"
 	"net/mail"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
+	"github.com/piggybank/backend/internal/auth"
 	"github.com/piggybank/backend/internal/common/email"
+	"github.com/piggybank/backend/internal/common/jobs"
+	"github.com/piggybank/backend/internal/common/qrcode"
 	"github.com/piggybank/backend/internal/users"
 )
 
@@ -20,33 +24,59 @@ var (
 	ErrPartnerRequired      = errors.New("partner email is required")
 	ErrInvalidPartnerEmail  = errors.New("invalid partner email")
 	ErrCannotInviteSelf     = errors.New("cannot invite yourself")
-	ErrAlreadyCoupled       = errors.New("user already belongs to a couple")
+	ErrAlreadyCoupled       = errors.New("user already belongs to a couple or household")
 	ErrPendingRequestExists = errors.New("pending request already exists")
 	ErrRequestNotFound      = errors.New("couple request not found")
 	ErrRequestNotAuthorized = errors.New("not authorized to act on this request")
 	ErrRequestNotPending    = errors.New("request is no longer pending")
+	ErrEmailNotVerified     = errors.New("email address must be verified first")
+	ErrInvalidInvitation    = errors.New("invalid invitation token")
+	ErrRequestExpired       = errors.New("request has expired")
+	ErrNotCoupled           = errors.New("user does not belong to a couple")
+	ErrInvalidFate          = errors.New("fate must be archive, duplicate or assign")
+	ErrInvalidAssignment    = errors.New("every shared piggybank must be assigned to one of the partners")
+	ErrInvalidPairingCode   = errors.New("invalid or expired pairing code")
+)
+
+// Failed pairing code redemptions are limited per user and per client IP.
+// With 32^8 possible codes and codes living PairingCodeTTL, guessing an active
+// code within these limits is impractical.
+const (
+	pairingUserAttempts  = 5
+	pairingIPAttempts    = 20
+	pairingAttemptWindow = 15 * time.Minute
 )
 
 // Service coordinates couple workflows across repositories.
 type Service struct {
-	store       Store
-	users       users.Repository
-	emailSender *email.Service
-	baseURL     string
+	store                Store
+	users                users.Repository
+	emailSender          *email.Service
+	baseURL              string
+	requireVerifiedEmail bool
+	attempts             auth.AttemptStore
 }
 
-// NewService constructs a Service.
-func NewService(store Store, usersRepo users.Repository, emailSender *email.Service, baseURL string) Service {
+// NewService constructs a Service. When requireVerifiedEmail is set, users must
+// verify their address before requesting or accepting a couple. attempts
+// throttles pairing code guesses.
+func NewService(store Store, usersRepo users.Repository, emailSender *email.Service, baseURL string, requireVerifiedEmail bool, attempts auth.AttemptStore) Service {
 	return Service{
-		store:       store,
-		users:       usersRepo,
-		emailSender: emailSender,
-		baseURL:     baseURL,
+		store:                store,
+		users:                usersRepo,
+		emailSender:          emailSender,
+		baseURL:              baseURL,
+		requireVerifiedEmail: requireVerifiedEmail,
+		attempts:             attempts,
 	}
 }
 
 // RequestCouple sends a couple invitation to the specified partner email.
 func (s Service) RequestCouple(ctx context.Context, requester users.User, partnerEmail string) (RequestView, users.User, error) {
+	if s.requireVerifiedEmail && requester.EmailVerifiedAt == nil {
+		return RequestView{}, users.User{}, ErrEmailNotVerified
+	}
+
 	email := strings.TrimSpace(strings.ToLower(partnerEmail))
 	if email == "" {
 		return RequestView{}, users.User{}, ErrPartnerRequired
@@ -65,16 +95,12 @@ func (s Service) RequestCouple(ctx context.Context, requester users.User, partne
 		return RequestView{}, users.User{}, ErrCannotInviteSelf
 	}
 
-	if _, err := s.store.GetCoupleByUserID(ctx, requester.ID); err == nil {
-		return RequestView{}, users.User{}, ErrAlreadyCoupled
-	} else if !errors.Is(err, ErrNotFound) {
+	if err := s.ensureNotInHousehold(ctx, requester.ID); err != nil {
 		return RequestView{}, users.User{}, err
 	}
 
 	if targetExists {
-		if _, err := s.store.GetCoupleByUserID(ctx, target.ID); err == nil {
-			return RequestView{}, users.User{}, ErrAlreadyCoupled
-		} else if !errors.Is(err, ErrNotFound) {
+		if err := s.ensureNotInHousehold(ctx, target.ID); err != nil {
 			return RequestView{}, users.User{}, err
 		}
 
@@ -111,6 +137,7 @@ func (s Service) RequestCouple(ctx context.Context, requester users.User, partne
 		RequesterUserID: requester.ID,
 		Status:          StatusPending,
 		CreatedAt:       now,
+		ExpiresAt:       now.Add(RequestTTL),
 		InvitationToken: &token,
 	}
 
@@ -157,8 +184,10 @@ func (s Service) RequestCouple(ctx context.Context, requester users.User, partne
 	}
 }
 
-// AcceptCouple finalises a pending request and creates a couple.
-func (s Service) AcceptCouple(ctx context.Context, requestID uuid.UUID, currentUserID uuid.UUID) (CoupleView, users.User, users.User, error) {
+// AcceptCouple finalises a pending request and creates a couple. With
+// promoteAll, the solo piggybanks of the accepting partner move into the
+// couple.
+func (s Service) AcceptCouple(ctx context.Context, requestID uuid.UUID, currentUserID uuid.UUID, promoteAll bool) (CoupleView, users.User, users.User, error) {
 	req, err := s.store.GetRequestByID(ctx, requestID)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
@@ -171,6 +200,10 @@ func (s Service) AcceptCouple(ctx context.Context, requestID uuid.UUID, currentU
 		return CoupleView{}, users.User{}, users.User{}, ErrRequestNotPending
 	}
 
+	if req.Expired(time.Now().UTC()) {
+		return CoupleView{}, users.User{}, users.User{}, ErrRequestExpired
+	}
+
 	// Only allow accepting requests where the target user exists
 	if req.TargetUserID == nil {
 		return CoupleView{}, users.User{}, users.User{}, ErrRequestNotAuthorized
@@ -180,15 +213,21 @@ func (s Service) AcceptCouple(ctx context.Context, requestID uuid.UUID, currentU
 		return CoupleView{}, users.User{}, users.User{}, ErrRequestNotAuthorized
 	}
 
-	if _, err := s.store.GetCoupleByUserID(ctx, req.RequesterUserID); err == nil {
-		return CoupleView{}, users.User{}, users.User{}, ErrAlreadyCoupled
-	} else if !errors.Is(err, ErrNotFound) {
+	if s.requireVerifiedEmail {
+		current, err := s.users.GetByID(ctx, currentUserID)
+		if err != nil {
+			return CoupleView{}, users.User{}, users.User{}, err
+		}
+		if current.EmailVerifiedAt == nil {
+			return CoupleView{}, users.User{}, users.User{}, ErrEmailNotVerified
+		}
+	}
+
+	if err := s.ensureNotInHousehold(ctx, req.RequesterUserID); err != nil {
 		return CoupleView{}, users.User{}, users.User{}, err
 	}
 
-	if _, err := s.store.GetCoupleByUserID(ctx, *req.TargetUserID); err == nil {
-		return CoupleView{}, users.User{}, users.User{}, ErrAlreadyCoupled
-	} else if !errors.Is(err, ErrNotFound) {
+	if err := s.ensureNotInHousehold(ctx, *req.TargetUserID); err != nil {
 		return CoupleView{}, users.User{}, users.User{}, err
 	}
 
@@ -200,8 +239,14 @@ func (s Service) AcceptCouple(ctx context.Context, requestID uuid.UUID, currentU
 		CreatedAt:      now,
 	}
 
-	if err := s.store.AcceptRequestWithCouple(ctx, req.ID, couple, now); err != nil {
+	var promoteUserID *uuid.UUID
+	if promoteAll {
+		promoteUserID = &currentUserID
+	}
+
+	if err := s.store.AcceptRequestWithCouple(ctx, req.ID, couple, now, promoteUserID); err != nil {
 		if errors.Is(err, ErrNotFound) {
+			// Answered or expired since it was read.
 			return CoupleView{}, users.User{}, users.User{}, ErrRequestNotPending
 		}
 		return CoupleView{}, users.User{}, users.User{}, err
@@ -269,6 +314,230 @@ func (s Service) GetStatus(ctx context.Context, userID uuid.UUID) (StatusView, e
 	return status, nil
 }
 
+// CreatePairingCode issues a short code that another user can redeem to pair
+// with user immediately. Creating a code invalidates the previous one.
+func (s Service) CreatePairingCode(ctx context.Context, user users.User) (string, time.Time, error) {
+	if s.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return "", time.Time{}, ErrEmailNotVerified
+	}
+
+	if err := s.ensureNotInHousehold(ctx, user.ID); err != nil {
+		return "", time.Time{}, err
+	}
+
+	code, err := generatePairingCode()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now().UTC()
+	pairing := PairingCode{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		CodeHash:  hashPairingCode(code),
+		ExpiresAt: now.Add(PairingCodeTTL),
+		CreatedAt: now,
+	}
+	if err := s.store.CreatePairingCode(ctx, pairing); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return code, pairing.ExpiresAt, nil
+}
+
+// PairingQRCode renders one of userID's active pairing codes as a QR code
+// whose payload is the code itself.
+func (s Service) PairingQRCode(ctx context.Context, userID uuid.UUID, code string) (qrcode.Code, error) {
+	pairing, err := s.activePairingCode(ctx, code, time.Now().UTC())
+	if err != nil {
+		return qrcode.Code{}, err
+	}
+	if pairing.UserID != userID {
+		return qrcode.Code{}, ErrInvalidPairingCode
+	}
+
+	normalized, _ := normalizePairingCode(code)
+	return qrcode.Encode([]byte(normalized))
+}
+
+// RedeemPairingCode pairs user with the creator of code, moving the user's
+// solo piggybanks into the couple with promoteAll. Failed attempts are
+// counted per user and per clientIP, and a RateLimitError is returned once
+// either exceeds its limit.
+func (s Service) RedeemPairingCode(ctx context.Context, user users.User, code, clientIP string, promoteAll bool) (CoupleView, users.User, error) {
+	if s.requireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return CoupleView{}, users.User{}, ErrEmailNotVerified
+	}
+
+	now := time.Now().UTC()
+	userKey := pairingUserAttemptKey(user.ID.String())
+	ipKey := pairingIPAttemptKey(clientIP)
+	if err := s.checkPairingAttempts(ctx, now, userKey, ipKey); err != nil {
+		return CoupleView{}, users.User{}, err
+	}
+
+	pairing, err := s.activePairingCode(ctx, code, now)
+	if errors.Is(err, ErrInvalidPairingCode) {
+		if err := s.recordPairingFailure(ctx, now, userKey, pairingUserAttempts); err != nil {
+			return CoupleView{}, users.User{}, err
+		}
+		if err := s.recordPairingFailure(ctx, now, ipKey, pairingIPAttempts); err != nil {
+			return CoupleView{}, users.User{}, err
+		}
+		return CoupleView{}, users.User{}, ErrInvalidPairingCode
+	}
+	if err != nil {
+		return CoupleView{}, users.User{}, err
+	}
+
+	if pairing.UserID == user.ID {
+		return CoupleView{}, users.User{}, ErrCannotInviteSelf
+	}
+
+	for _, id := range []uuid.UUID{user.ID, pairing.UserID} {
+		if err := s.ensureNotInHousehold(ctx, id); err != nil {
+			return CoupleView{}, users.User{}, err
+		}
+	}
+
+	partner, err := s.users.GetByID(ctx, pairing.UserID)
+	if err != nil {
+		return CoupleView{}, users.User{}, err
+	}
+
+	couple := Couple{
+		ID:             uuid.New(),
+		Partner1UserID: pairing.UserID,
+		Partner2UserID: user.ID,
+		CreatedAt:      now,
+	}
+	var promoteUserID *uuid.UUID
+	if promoteAll {
+		promoteUserID = &user.ID
+	}
+	if err := s.store.RedeemPairingCodeWithCouple(ctx, pairing.ID, couple, user.ID, promoteUserID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return CoupleView{}, users.User{}, ErrInvalidPairingCode
+		}
+		return CoupleView{}, users.User{}, err
+	}
+
+	if err := s.attempts.Reset(ctx, userKey); err != nil {
+		log.Printf("failed to reset pairing attempts: %v", err)
+	}
+
+	return CoupleView{Couple: couple, PartnerID: partner.ID}, partner, nil
+}
+
+func (s Service) activePairingCode(ctx context.Context, code string, now time.Time) (PairingCode, error) {
+	normalized, ok := normalizePairingCode(code)
+	if !ok {
+		return PairingCode{}, ErrInvalidPairingCode
+	}
+
+	pairing, err := s.store.GetActivePairingCode(ctx, hashPairingCode(normalized), now)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return PairingCode{}, ErrInvalidPairingCode
+		}
+		return PairingCode{}, err
+	}
+	return pairing, nil
+}
+
+// checkPairingAttempts returns a RateLimitError when any of the keys is blocked.
+func (s Service) checkPairingAttempts(ctx context.Context, now time.Time, keys ...string) error {
+	var retryAfter time.Duration
+	for _, key := range keys {
+		record, err := s.attempts.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if record.BlockedUntil != nil && record.BlockedUntil.After(now) {
+			if wait := record.BlockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		return &auth.RateLimitError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// recordPairingFailure counts a failed redemption for key and blocks the key
+// for the rest of the window once limit is reached.
+func (s Service) recordPairingFailure(ctx context.Context, now time.Time, key string, limit int) error {
+	record, err := s.attempts.RegisterFailure(ctx, key, now, pairingAttemptWindow)
+	if err != nil {
+		return err
+	}
+	if record.Failures < limit {
+		return nil
+	}
+	return s.attempts.Block(ctx, key, now.Add(pairingAttemptWindow))
+}
+
+// LeaveCouple dissolves the couple of userID. The couple is kept as history
+// and its piggybanks are archived, duplicated or assigned according to fate.
+func (s Service) LeaveCouple(ctx context.Context, userID uuid.UUID, fate PiggyBankFate, assignments map[uuid.UUID]uuid.UUID) (Couple, error) {
+	couple, err := s.store.GetCoupleByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Couple{}, ErrNotCoupled
+		}
+		return Couple{}, err
+	}
+
+	switch fate {
+	case FateArchive, FateDuplicate:
+		assignments = nil
+	case FateAssign:
+		ids, err := s.store.ListPiggyBankIDs(ctx, couple.ID)
+		if err != nil {
+			return Couple{}, err
+		}
+		if len(assignments) != len(ids) {
+			return Couple{}, ErrInvalidAssignment
+		}
+		for _, id := range ids {
+			ownerID, ok := assignments[id]
+			if !ok || (ownerID != couple.Partner1UserID && ownerID != couple.Partner2UserID) {
+				return Couple{}, ErrInvalidAssignment
+			}
+		}
+	default:
+		return Couple{}, ErrInvalidFate
+	}
+
+	now := time.Now().UTC()
+	if err := s.store.EndCouple(ctx, couple, userID, now, fate, assignments); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Couple{}, ErrNotCoupled
+		}
+		return Couple{}, err
+	}
+
+	couple.EndedAt = &now
+	couple.EndedByUserID = &userID
+	return couple, nil
+}
+
+// History returns the dissolved couples of a user, most recent first.
+func (s Service) History(ctx context.Context, userID uuid.UUID) ([]CoupleView, error) {
+	couples, err := s.store.ListEndedCouples(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	views := make([]CoupleView, 0, len(couples))
+	for _, couple := range couples {
+		views = append(views, CoupleView{Couple: couple, PartnerID: couple.PartnerOf(userID)})
+	}
+	return views, nil
+}
+
 // UpdateRequestTargetUser updates the target_user_id of a pending request.
 func (s Service) UpdateRequestTargetUser(ctx context.Context, requestID uuid.UUID, targetUserID uuid.UUID) error {
 	return s.store.UpdateRequestTargetUser(ctx, requestID, targetUserID)
@@ -292,6 +561,11 @@ func (s Service) ResendCouple(ctx context.Context, requestID uuid.UUID, currentU
 		return ErrRequestNotAuthorized
 	}
 
+	now := time.Now().UTC()
+	if req.Expired(now) {
+		return ErrRequestExpired
+	}
+
 	if req.InvitationToken == nil {
 		return errors.New("no invitation token available")
 	}
@@ -316,6 +590,14 @@ func (s Service) ResendCouple(ctx context.Context, requestID uuid.UUID, currentU
 		return err
 	}
 
+	// A resent invitation is valid for another full period.
+	if err := s.store.ExtendRequest(ctx, req.ID, now.Add(RequestTTL)); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrRequestNotPending
+		}
+		return err
+	}
+
 	// Send invitation email if email service is available
 	if s.emailSender != nil {
 		go func() {
@@ -332,7 +614,184 @@ func (s Service) ResendCouple(ctx context.Context, requestID uuid.UUID, currentU
 	return nil
 }
 
-// GetRequestByInvitationToken retrieves a couple request by its invitation token.
+// GetRequestByInvitationToken retrieves a pending couple request by its
+// invitation token.
 func (s Service) GetRequestByInvitationToken(ctx context.Context, token string) (CoupleRequest, error) {
-	return s.store.GetRequestByInvitationToken(ctx, token)
+	req, err := s.store.GetRequestByInvitationToken(ctx, token)
+	if err != nil {
+		return CoupleRequest{}, err
+	}
+
+	if req.Status != StatusPending {
+		return CoupleRequest{}, ErrRequestNotPending
+	}
+	if req.Expired(time.Now().UTC()) {
+		return CoupleRequest{}, ErrRequestExpired
+	}
+	return req, nil
+}
+
+// PreviewInvitation describes the invitation behind token. A pending
+// invitation past its expiry is reported as expired.
+func (s Service) PreviewInvitation(ctx context.Context, token string) (InvitationPreview, error) {
+	req, err := s.store.GetRequestByInvitationToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return InvitationPreview{}, ErrInvalidInvitation
+		}
+		return InvitationPreview{}, err
+	}
+
+	requester, err := s.users.GetByID(ctx, req.RequesterUserID)
+	if err != nil {
+		return InvitationPreview{}, err
+	}
+
+	preview := InvitationPreview{
+		InviterName: requester.Name,
+		Status:      req.Status,
+		ExpiresAt:   req.ExpiresAt,
+	}
+	if req.Expired(time.Now().UTC()) {
+		preview.Status = StatusExpired
+	}
+
+	return preview, nil
+}
+
+// AcceptInvitation accepts the invitation behind token on behalf of user.
+// Invitations sent to an address that had no account yet are claimed first
+// when user signed up with that address. promoteAll is passed on to
+// AcceptCouple.
+func (s Service) AcceptInvitation(ctx context.Context, token string, user users.User, promoteAll bool) (CoupleView, users.User, users.User, error) {
+	req, err := s.store.GetRequestByInvitationToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return CoupleView{}, users.User{}, users.User{}, ErrInvalidInvitation
+		}
+		return CoupleView{}, users.User{}, users.User{}, err
+	}
+
+	if req.TargetUserID == nil && req.Status == StatusPending {
+		if req.TargetEmail == nil || !strings.EqualFold(*req.TargetEmail, user.Email) {
+			return CoupleView{}, users.User{}, users.User{}, ErrRequestNotAuthorized
+		}
+		if err := s.store.UpdateRequestTargetUser(ctx, req.ID, user.ID); err != nil && !errors.Is(err, ErrNotFound) {
+			return CoupleView{}, users.User{}, users.User{}, err
+		}
+	}
+
+	return s.AcceptCouple(ctx, req.ID, user.ID, promoteAll)
+}
+
+// RejectCouple declines an incoming request. Only the target may reject it.
+func (s Service) RejectCouple(ctx context.Context, requestID uuid.UUID, currentUserID uuid.UUID) error {
+	return s.closeRequest(ctx, requestID, StatusRejected, func(req CoupleRequest) bool {
+		return req.TargetUserID != nil && *req.TargetUserID == currentUserID
+	})
+}
+
+// CancelCouple withdraws an outgoing request. Only the requester may cancel it.
+func (s Service) CancelCouple(ctx context.Context, requestID uuid.UUID, currentUserID uuid.UUID) error {
+	return s.closeRequest(ctx, requestID, StatusCancelled, func(req CoupleRequest) bool {
+		return req.RequesterUserID == currentUserID
+	})
+}
+
+func (s Service) closeRequest(ctx context.Context, requestID uuid.UUID, status string, allowed func(CoupleRequest) bool) error {
+	req, err := s.store.GetRequestByID(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrRequestNotFound
+		}
+		return err
+	}
+
+	if !allowed(req) {
+		return ErrRequestNotAuthorized
+	}
+
+	if req.Status != StatusPending {
+		return ErrRequestNotPending
+	}
+
+	now := time.Now().UTC()
+	if req.Expired(now) {
+		return ErrRequestExpired
+	}
+
+	if err := s.store.UpdateRequestStatus(ctx, req.ID, status, now); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrRequestNotPending
+		}
+		return err
+	}
+	return nil
+}
+
+// ExpireStaleRequests marks pending requests past their expiry as expired.
+func (s Service) ExpireStaleRequests(ctx context.Context) (int64, error) {
+	return s.store.ExpireStaleRequests(ctx, time.Now().UTC())
+}
+
+// RunExpirySweeper expires stale requests every interval until ctx is done.
+// The update is idempotent, so every replica may run it.
+func (s Service) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	jobs.Every(ctx, interval, "couple request expiry", func(ctx context.Context) (int, error) {
+		n, err := s.ExpireStaleRequests(ctx)
+		return int(n), err
+	})
+}
+
+// CheckInvitation verifies that the invitation is pending and was sent to
+// emailAddress, which has no account yet.
+func (s Service) CheckInvitation(ctx context.Context, token, emailAddress string) error {
+	_, err := s.pendingInvitation(ctx, token, emailAddress)
+	return err
+}
+
+// ClaimInvitation attaches the account created for an invited address to the
+// invitation so that the new user can accept it.
+func (s Service) ClaimInvitation(ctx context.Context, token, emailAddress string, userID uuid.UUID) error {
+	req, err := s.pendingInvitation(ctx, token, emailAddress)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.UpdateRequestTargetUser(ctx, req.ID, userID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrInvalidInvitation
+		}
+		return err
+	}
+	return nil
+}
+
+func (s Service) pendingInvitation(ctx context.Context, token, emailAddress string) (CoupleRequest, error) {
+	req, err := s.store.GetRequestByInvitationToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return CoupleRequest{}, ErrInvalidInvitation
+		}
+		return CoupleRequest{}, err
+	}
+
+	if req.Status != StatusPending || req.Expired(time.Now().UTC()) || req.TargetUserID != nil || req.TargetEmail == nil ||
+		!strings.EqualFold(*req.TargetEmail, strings.TrimSpace(emailAddress)) {
+		return CoupleRequest{}, ErrInvalidInvitation
+	}
+	return req, nil
+}
+
+// ensureNotInHousehold returns ErrAlreadyCoupled when userID already belongs
+// to a couple or any other household.
+func (s Service) ensureNotInHousehold(ctx context.Context, userID uuid.UUID) error {
+	inHousehold, err := s.store.InHousehold(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if inHousehold {
+		return ErrAlreadyCoupled
+	}
+	return nil
 }
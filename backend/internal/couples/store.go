@@ -7,7 +7,10 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/piggybank/backend/internal/piggybanks"
 )
 
 var ErrNotFound = errors.New("record not found")
@@ -24,25 +27,25 @@ func NewStore(pool *pgxpool.Pool) Store {
 
 func (s Store) CreateRequest(ctx context.Context, req CoupleRequest) error {
 	query := `
-        INSERT INTO couple_requests (id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        INSERT INTO couple_requests (id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
     `
-	_, err := s.pool.Exec(ctx, query, req.ID, req.RequesterUserID, req.TargetUserID, req.TargetEmail, req.InvitationToken, req.Status, req.CreatedAt)
+	_, err := s.pool.Exec(ctx, query, req.ID, req.RequesterUserID, req.TargetUserID, req.TargetEmail, req.InvitationToken, req.Status, req.CreatedAt, req.ExpiresAt)
 	return err
 }
 
 func (s Store) FindPendingRequestBetween(ctx context.Context, a, b uuid.UUID) (CoupleRequest, error) {
 	query := `
-        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, responded_at
+        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, expires_at, responded_at
         FROM couple_requests
-        WHERE status = 'pending'
+        WHERE status = 'pending' AND expires_at > NOW()
           AND ((requester_user_id = $1 AND target_user_id = $2)
             OR (requester_user_id = $2 AND target_user_id = $1))
         LIMIT 1
     `
 	row := s.pool.QueryRow(ctx, query, a, b)
 	var req CoupleRequest
-	if err := row.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.RespondedAt); err != nil {
+	if err := row.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.ExpiresAt, &req.RespondedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return CoupleRequest{}, ErrNotFound
 		}
@@ -53,9 +56,9 @@ func (s Store) FindPendingRequestBetween(ctx context.Context, a, b uuid.UUID) (C
 
 func (s Store) ListPendingRequestsForUser(ctx context.Context, userID uuid.UUID) ([]CoupleRequest, error) {
 	query := `
-        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, responded_at
+        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, expires_at, responded_at
         FROM couple_requests
-        WHERE status = 'pending' AND (requester_user_id = $1 OR target_user_id = $1)
+        WHERE status = 'pending' AND expires_at > NOW() AND (requester_user_id = $1 OR target_user_id = $1)
         ORDER BY created_at ASC
     `
 	rows, err := s.pool.Query(ctx, query, userID)
@@ -67,7 +70,7 @@ func (s Store) ListPendingRequestsForUser(ctx context.Context, userID uuid.UUID)
 	var requests []CoupleRequest
 	for rows.Next() {
 		var req CoupleRequest
-		if err := rows.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.RespondedAt); err != nil {
+		if err := rows.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.ExpiresAt, &req.RespondedAt); err != nil {
 			return nil, err
 		}
 		requests = append(requests, req)
@@ -77,14 +80,14 @@ func (s Store) ListPendingRequestsForUser(ctx context.Context, userID uuid.UUID)
 
 func (s Store) GetRequestByID(ctx context.Context, id uuid.UUID) (CoupleRequest, error) {
 	query := `
-        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, responded_at
+        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, expires_at, responded_at
         FROM couple_requests
         WHERE id = $1
         LIMIT 1
     `
 	row := s.pool.QueryRow(ctx, query, id)
 	var req CoupleRequest
-	if err := row.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.RespondedAt); err != nil {
+	if err := row.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.ExpiresAt, &req.RespondedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return CoupleRequest{}, ErrNotFound
 		}
@@ -93,35 +96,97 @@ func (s Store) GetRequestByID(ctx context.Context, id uuid.UUID) (CoupleRequest,
 	return req, nil
 }
 
+// UpdateRequestStatus answers a pending request that has not expired. It
+// returns ErrNotFound when the request is no longer pending.
 func (s Store) UpdateRequestStatus(ctx context.Context, id uuid.UUID, status string, respondedAt time.Time) error {
 	query := `
         UPDATE couple_requests
         SET status = $2, responded_at = $3
-        WHERE id = $1
+        WHERE id = $1 AND status = 'pending' AND expires_at > $3
     `
-	_, err := s.pool.Exec(ctx, query, id, status, respondedAt)
-	return err
+	tag, err := s.pool.Exec(ctx, query, id, status, respondedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-func (s Store) CreateCouple(ctx context.Context, c Couple) error {
+// ExtendRequest moves the expiry of a pending request, e.g. when the
+// invitation is sent again.
+func (s Store) ExtendRequest(ctx context.Context, id uuid.UUID, expiresAt time.Time) error {
 	query := `
-        INSERT INTO couples (id, partner1_user_id, partner2_user_id, created_at)
-        VALUES ($1, $2, $3, $4)
+        UPDATE couple_requests
+        SET expires_at = $2
+        WHERE id = $1 AND status = 'pending'
     `
-	_, err := s.pool.Exec(ctx, query, c.ID, c.Partner1UserID, c.Partner2UserID, c.CreatedAt)
-	return err
+	tag, err := s.pool.Exec(ctx, query, id, expiresAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
 }
 
-func (s Store) GetCoupleByUserID(ctx context.Context, userID uuid.UUID) (Couple, error) {
+// ExpireStaleRequests marks pending requests past their expiry as expired and
+// returns how many were updated.
+func (s Store) ExpireStaleRequests(ctx context.Context, now time.Time) (int64, error) {
 	query := `
-        SELECT id, partner1_user_id, partner2_user_id, created_at
-        FROM couples
-        WHERE partner1_user_id = $1 OR partner2_user_id = $1
-        LIMIT 1
+        UPDATE couple_requests
+        SET status = 'expired', responded_at = $1
+        WHERE status = 'pending' AND expires_at <= $1
     `
-	row := s.pool.QueryRow(ctx, query, userID)
+	tag, err := s.pool.Exec(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// coupleQuery selects couples from households: a couple is a household whose
+// only members ever were an owner and an adult.
+const coupleQuery = `
+        SELECT h.id, p1.user_id, p2.user_id, h.created_at, h.ended_at, h.ended_by_user_id
+        FROM households h
+        INNER JOIN household_members p1 ON p1.household_id = h.id AND p1.role = 'owner'
+        INNER JOIN household_members p2 ON p2.household_id = h.id AND p2.role = 'adult'
+        WHERE (SELECT COUNT(*) FROM household_members m WHERE m.household_id = h.id) = 2
+    `
+
+func scanCouple(row pgx.Row) (Couple, error) {
 	var couple Couple
-	if err := row.Scan(&couple.ID, &couple.Partner1UserID, &couple.Partner2UserID, &couple.CreatedAt); err != nil {
+	err := row.Scan(&couple.ID, &couple.Partner1UserID, &couple.Partner2UserID, &couple.CreatedAt, &couple.EndedAt, &couple.EndedByUserID)
+	return couple, err
+}
+
+// CreateCouple stores a couple as a household with partner1 as owner and
+// partner2 as adult.
+func (s Store) CreateCouple(ctx context.Context, c Couple) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertCouple(ctx, tx, c); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s Store) GetCoupleByUserID(ctx context.Context, userID uuid.UUID) (Couple, error) {
+	query := coupleQuery + `
+          AND h.ended_at IS NULL AND p1.left_at IS NULL AND p2.left_at IS NULL
+          AND (p1.user_id = $1 OR p2.user_id = $1)
+        LIMIT 1
+    `
+	couple, err := scanCouple(s.pool.QueryRow(ctx, query, userID))
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return Couple{}, ErrNotFound
 		}
@@ -130,16 +195,271 @@ func (s Store) GetCoupleByUserID(ctx context.Context, userID uuid.UUID) (Couple,
 	return couple, nil
 }
 
+// InHousehold reports whether the user currently belongs to a household,
+// which includes being part of a couple.
+func (s Store) InHousehold(ctx context.Context, userID uuid.UUID) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1 FROM household_members WHERE user_id = $1 AND left_at IS NULL
+        )
+    `
+	var exists bool
+	if err := s.pool.QueryRow(ctx, query, userID).Scan(&exists); err != nil {
+		return false, err
+	}
+	return exists, nil
+}
+
+// ListEndedCouples returns the dissolved couples of a user, most recent first.
+func (s Store) ListEndedCouples(ctx context.Context, userID uuid.UUID) ([]Couple, error) {
+	query := coupleQuery + `
+          AND h.ended_at IS NOT NULL
+          AND (p1.user_id = $1 OR p2.user_id = $1)
+        ORDER BY h.ended_at DESC
+    `
+	rows, err := s.pool.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var couples []Couple
+	for rows.Next() {
+		couple, err := scanCouple(rows)
+		if err != nil {
+			return nil, err
+		}
+		couples = append(couples, couple)
+	}
+	return couples, rows.Err()
+}
+
+// ListPiggyBankIDs returns the piggybanks shared by a couple.
+func (s Store) ListPiggyBankIDs(ctx context.Context, coupleID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := s.pool.Query(ctx, `SELECT id FROM piggybanks WHERE couple_id = $1`, coupleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// EndCouple dissolves an active couple and applies fate to its piggybanks in
+// a single transaction. With FateAssign, assignments maps every piggybank to
+// the partner who keeps it.
+func (s Store) EndCouple(ctx context.Context, couple Couple, endedBy uuid.UUID, endedAt time.Time, fate PiggyBankFate, assignments map[uuid.UUID]uuid.UUID) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	endQuery := `
+        UPDATE households
+        SET ended_at = $2, ended_by_user_id = $3
+        WHERE id = $1 AND ended_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, endQuery, couple.ID, endedAt, endedBy)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	leaveQuery := `
+        UPDATE household_members
+        SET left_at = $2
+        WHERE household_id = $1 AND left_at IS NULL
+    `
+	if _, err := tx.Exec(ctx, leaveQuery, couple.ID, endedAt); err != nil {
+		return err
+	}
+
+	switch fate {
+	case FateArchive:
+		archiveQuery := `
+            UPDATE piggybanks
+            SET archived_at = $2, updated_at = $2
+            WHERE couple_id = $1 AND archived_at IS NULL
+        `
+		if _, err := tx.Exec(ctx, archiveQuery, couple.ID, endedAt); err != nil {
+			return err
+		}
+	case FateDuplicate:
+		rows, err := tx.Query(ctx, `SELECT id FROM piggybanks WHERE couple_id = $1`, couple.ID)
+		if err != nil {
+			return err
+		}
+		var ids []uuid.UUID
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// The first partner keeps the original, the second gets a copy.
+		// Copies of a recurring series form a new series of their own.
+		copies := map[uuid.UUID]uuid.UUID{}
+		previous := map[uuid.UUID]uuid.UUID{}
+		series := map[uuid.UUID]uuid.UUID{}
+		for _, id := range ids {
+			copyID, previousID, err := copyPiggyBank(ctx, tx, id, couple.Partner2UserID, endedAt, series)
+			if err != nil {
+				return err
+			}
+			copies[id] = copyID
+			if previousID != nil {
+				previous[copyID] = *previousID
+			}
+		}
+		for copyID, previousID := range previous {
+			copyPreviousID, ok := copies[previousID]
+			if !ok {
+				continue
+			}
+			if _, err := tx.Exec(ctx, `UPDATE piggybanks SET previous_id = $2 WHERE id = $1`, copyID, copyPreviousID); err != nil {
+				return err
+			}
+		}
+		if err := handOverPiggyBanks(ctx, tx, couple.ID, nil, couple.Partner1UserID, endedAt); err != nil {
+			return err
+		}
+	case FateAssign:
+		for id, ownerID := range assignments {
+			if err := handOverPiggyBanks(ctx, tx, couple.ID, &id, ownerID, endedAt); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// handOverPiggyBanks turns piggybanks of a couple into solo piggybanks of
+// ownerID. A nil id hands over every piggybank of the couple.
+func handOverPiggyBanks(ctx context.Context, tx pgx.Tx, coupleID uuid.UUID, id *uuid.UUID, ownerID uuid.UUID, at time.Time) error {
+	query := `
+        UPDATE piggybanks
+        SET couple_id = NULL, owner_user_id = $3, updated_at = $4
+        WHERE couple_id = $1 AND ($2::uuid IS NULL OR id = $2)
+    `
+	_, err := tx.Exec(ctx, query, coupleID, id, ownerID, at)
+	return err
+}
+
+// copyPiggyBank creates a solo copy of a piggybank for ownerID, including its
+// milestones, voucher templates and action entries, and returns the id of the
+// copy and the piggybank the original rolled over from, if any. A recurring
+// piggybank is copied into the series that series maps its own series to,
+// a new one the first time.
+func copyPiggyBank(ctx context.Context, tx pgx.Tx, id uuid.UUID, ownerID uuid.UUID, at time.Time, series map[uuid.UUID]uuid.UUID) (uuid.UUID, *uuid.UUID, error) {
+	var seriesID, previousID *uuid.UUID
+	if err := tx.QueryRow(ctx, `SELECT series_id, previous_id FROM piggybanks WHERE id = $1`, id).Scan(&seriesID, &previousID); err != nil {
+		return uuid.Nil, nil, err
+	}
+	var copySeriesID *uuid.UUID
+	if seriesID != nil {
+		if _, ok := series[*seriesID]; !ok {
+			series[*seriesID] = uuid.New()
+		}
+		newSeriesID := series[*seriesID]
+		copySeriesID = &newSeriesID
+	}
+
+	copyID := uuid.New()
+	pbQuery := `
+        INSERT INTO piggybanks (id, couple_id, owner_user_id, title, description, start_date, end_date,
+            target_cents, target_date, goal_reached_at, recurrence, period_ends_at, series_id,
+            finalised_at, deleted_at, created_at, updated_at)
+        SELECT $2, NULL, $3, title, description, start_date, end_date,
+            target_cents, target_date, goal_reached_at, recurrence, period_ends_at, $5,
+            finalised_at, deleted_at, created_at, $4
+        FROM piggybanks
+        WHERE id = $1
+    `
+	if _, err := tx.Exec(ctx, pbQuery, id, copyID, ownerID, at, copySeriesID); err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	milestonesQuery := `
+        INSERT INTO piggybank_milestones (id, piggybank_id, threshold_cents, reward, position, reached_at, created_at, updated_at)
+        SELECT gen_random_uuid(), $2, threshold_cents, reward, position, reached_at, created_at, updated_at
+        FROM piggybank_milestones
+        WHERE piggybank_id = $1
+    `
+	if _, err := tx.Exec(ctx, milestonesQuery, id, copyID); err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	rows, err := tx.Query(ctx, `SELECT id FROM voucher_templates WHERE piggybank_id = $1`, id)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	var templateIDs []uuid.UUID
+	for rows.Next() {
+		var templateID uuid.UUID
+		if err := rows.Scan(&templateID); err != nil {
+			rows.Close()
+			return uuid.Nil, nil, err
+		}
+		templateIDs = append(templateIDs, templateID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return uuid.Nil, nil, err
+	}
+
+	templateQuery := `
+        INSERT INTO voucher_templates (id, piggybank_id, title, description, amount_cents, created_at, updated_at)
+        SELECT $2, $3, title, description, amount_cents, created_at, updated_at
+        FROM voucher_templates
+        WHERE id = $1
+    `
+	entriesQuery := `
+        INSERT INTO action_entries (id, voucher_template_id, giver_user_id, occurred_at, notes, created_at, updated_at)
+        SELECT gen_random_uuid(), $2, giver_user_id, occurred_at, notes, created_at, updated_at
+        FROM action_entries
+        WHERE voucher_template_id = $1
+    `
+	for _, templateID := range templateIDs {
+		copyTemplateID := uuid.New()
+		if _, err := tx.Exec(ctx, templateQuery, templateID, copyTemplateID, copyID); err != nil {
+			return uuid.Nil, nil, err
+		}
+		if _, err := tx.Exec(ctx, entriesQuery, templateID, copyTemplateID); err != nil {
+			return uuid.Nil, nil, err
+		}
+	}
+	return copyID, previousID, nil
+}
+
 func (s Store) GetRequestByInvitationToken(ctx context.Context, token string) (CoupleRequest, error) {
 	query := `
-        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, responded_at
+        SELECT id, requester_user_id, target_user_id, target_email, invitation_token, status, created_at, expires_at, responded_at
         FROM couple_requests
         WHERE invitation_token = $1
         LIMIT 1
     `
 	row := s.pool.QueryRow(ctx, query, token)
 	var req CoupleRequest
-	if err := row.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.RespondedAt); err != nil {
+	if err := row.Scan(&req.ID, &req.RequesterUserID, &req.TargetUserID, &req.TargetEmail, &req.InvitationToken, &req.Status, &req.CreatedAt, &req.ExpiresAt, &req.RespondedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return CoupleRequest{}, ErrNotFound
 		}
@@ -164,7 +484,10 @@ func (s Store) UpdateRequestTargetUser(ctx context.Context, requestID uuid.UUID,
 	return nil
 }
 
-func (s Store) AcceptRequestWithCouple(ctx context.Context, requestID uuid.UUID, couple Couple, acceptedAt time.Time) error {
+// AcceptRequestWithCouple answers the request and creates the couple in a
+// single transaction. A non-nil promoteUserID moves that partner's solo
+// piggybanks into the couple as well.
+func (s Store) AcceptRequestWithCouple(ctx context.Context, requestID uuid.UUID, couple Couple, acceptedAt time.Time, promoteUserID *uuid.UUID) error {
 	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
 	if err != nil {
 		return err
@@ -174,7 +497,7 @@ func (s Store) AcceptRequestWithCouple(ctx context.Context, requestID uuid.UUID,
 	updateQuery := `
         UPDATE couple_requests
         SET status = $2, responded_at = $3
-        WHERE id = $1 AND status = 'pending'
+        WHERE id = $1 AND status = 'pending' AND expires_at > $3
     `
 	tag, err := tx.Exec(ctx, updateQuery, requestID, StatusAccepted, acceptedAt)
 	if err != nil {
@@ -184,13 +507,125 @@ func (s Store) AcceptRequestWithCouple(ctx context.Context, requestID uuid.UUID,
 		return ErrNotFound
 	}
 
+	if err := insertCouple(ctx, tx, couple); err != nil {
+		return err
+	}
+
+	if promoteUserID != nil {
+		if _, err := piggybanks.PromoteSolo(ctx, tx, *promoteUserID, couple.ID, nil, couple.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// CreatePairingCode stores a new pairing code and invalidates the unused codes
+// previously created by the same user.
+func (s Store) CreatePairingCode(ctx context.Context, code PairingCode) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	invalidateQuery := `
+        UPDATE pairing_codes
+        SET expires_at = $2
+        WHERE user_id = $1 AND used_at IS NULL AND expires_at > $2
+    `
+	if _, err := tx.Exec(ctx, invalidateQuery, code.UserID, code.CreatedAt); err != nil {
+		return err
+	}
+
 	insertQuery := `
-        INSERT INTO couples (id, partner1_user_id, partner2_user_id, created_at)
-        VALUES ($1, $2, $3, $4)
+        INSERT INTO pairing_codes (id, user_id, code_hash, expires_at, created_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `
+	if _, err := tx.Exec(ctx, insertQuery, code.ID, code.UserID, code.CodeHash, code.ExpiresAt, code.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetActivePairingCode returns the unused, unexpired code with the given hash.
+func (s Store) GetActivePairingCode(ctx context.Context, codeHash string, now time.Time) (PairingCode, error) {
+	query := `
+        SELECT id, user_id, code_hash, expires_at, created_at, used_at, used_by_user_id
+        FROM pairing_codes
+        WHERE code_hash = $1 AND used_at IS NULL AND expires_at > $2
+        ORDER BY created_at DESC
+        LIMIT 1
+    `
+	var code PairingCode
+	err := s.pool.QueryRow(ctx, query, codeHash, now).Scan(&code.ID, &code.UserID, &code.CodeHash, &code.ExpiresAt, &code.CreatedAt, &code.UsedAt, &code.UsedByUserID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PairingCode{}, ErrNotFound
+		}
+		return PairingCode{}, err
+	}
+	return code, nil
+}
+
+// RedeemPairingCodeWithCouple marks the code as used and creates the couple
+// in a single transaction, promoting the solo piggybanks of promoteUserID
+// unless it is nil. It returns ErrNotFound when the code was used or
+// expired in the meantime and ErrAlreadyCoupled when either partner paired
+// concurrently.
+func (s Store) RedeemPairingCodeWithCouple(ctx context.Context, codeID uuid.UUID, couple Couple, usedBy uuid.UUID, promoteUserID *uuid.UUID) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	updateQuery := `
+        UPDATE pairing_codes
+        SET used_at = $2, used_by_user_id = $3
+        WHERE id = $1 AND used_at IS NULL AND expires_at > $2
     `
-	if _, err := tx.Exec(ctx, insertQuery, couple.ID, couple.Partner1UserID, couple.Partner2UserID, couple.CreatedAt); err != nil {
+	tag, err := tx.Exec(ctx, updateQuery, codeID, couple.CreatedAt, usedBy)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	if err := insertCouple(ctx, tx, couple); err != nil {
 		return err
 	}
 
+	if promoteUserID != nil {
+		if _, err := piggybanks.PromoteSolo(ctx, tx, *promoteUserID, couple.ID, nil, couple.CreatedAt); err != nil {
+			return err
+		}
+	}
+
 	return tx.Commit(ctx)
 }
+
+// insertCouple creates the household backing a couple. It returns
+// ErrAlreadyCoupled when either partner joined a household concurrently.
+func insertCouple(ctx context.Context, tx pgx.Tx, c Couple) error {
+	householdQuery := `
+        INSERT INTO households (id, created_at)
+        VALUES ($1, $2)
+    `
+	if _, err := tx.Exec(ctx, householdQuery, c.ID, c.CreatedAt); err != nil {
+		return err
+	}
+
+	memberQuery := `
+        INSERT INTO household_members (id, household_id, user_id, role, joined_at)
+        VALUES ($1, $2, $3, 'owner', $5), ($6, $2, $4, 'adult', $5)
+    `
+	_, err := tx.Exec(ctx, memberQuery, uuid.New(), c.ID, c.Partner1UserID, c.Partner2UserID, c.CreatedAt, uuid.New())
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrAlreadyCoupled
+	}
+	return err
+}
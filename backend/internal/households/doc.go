@@ -0,0 +1,3 @@
+// Package households contains the domain logic for groups of members, such as
+// a family, sharing piggybanks. A couple is a household of two adults.
+package households
@@ -0,0 +1,473 @@
+package households
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/piggybank/backend/internal/auth"
+	"github.com/piggybank/backend/internal/common/response"
+	"github.com/piggybank/backend/internal/users"
+)
+
+// Handler exposes HTTP endpoints for households.
+type Handler struct {
+	service Service
+}
+
+// NewHandler constructs a handler instance.
+func NewHandler(service Service) Handler {
+	return Handler{service: service}
+}
+
+type createHouseholdPayload struct {
+	Name *string `json:"name"`
+}
+
+type invitePayload struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+type updateMemberPayload struct {
+	Role string `json:"role"`
+}
+
+type memberResponse struct {
+	User     userSummary `json:"user"`
+	Role     string      `json:"role"`
+	JoinedAt string      `json:"joinedAt"`
+}
+
+type householdResponse struct {
+	ID        string           `json:"id"`
+	Name      *string          `json:"name"`
+	Members   []memberResponse `json:"members"`
+	CreatedAt string           `json:"createdAt"`
+}
+
+type invitationResponse struct {
+	ID          string  `json:"id"`
+	HouseholdID string  `json:"householdId"`
+	InviterID   string  `json:"inviterId"`
+	TargetID    *string `json:"targetId"`
+	TargetEmail *string `json:"targetEmail"`
+	Role        string  `json:"role"`
+	Status      string  `json:"status"`
+	CreatedAt   string  `json:"createdAt"`
+	ExpiresAt   string  `json:"expiresAt"`
+}
+
+type invitationsResponse struct {
+	Incoming []invitationResponse `json:"incoming"`
+	Outgoing []invitationResponse `json:"outgoing"`
+}
+
+type invitationPreviewResponse struct {
+	InviterName   string  `json:"inviterName"`
+	HouseholdName *string `json:"householdName"`
+	Role          string  `json:"role"`
+	Status        string  `json:"status"`
+	ExpiresAt     string  `json:"expiresAt"`
+}
+
+type userSummary struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// Create handles POST /households.
+func (h Handler) Create(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var payload createHouseholdPayload
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			response.BadRequest(w, "invalid payload")
+			return
+		}
+	}
+
+	view, err := h.service.Create(r.Context(), user, payload.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAlreadyInHousehold):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	h.writeHousehold(w, r, http.StatusCreated, view)
+}
+
+// Me handles GET /households/me.
+func (h Handler) Me(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	view, err := h.service.Get(r.Context(), user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotInHousehold):
+			response.NotFound(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	h.writeHousehold(w, r, http.StatusOK, view)
+}
+
+// Invite handles POST /households/invitations.
+func (h Handler) Invite(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var payload invitePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	inv, err := h.service.Invite(r.Context(), user, payload.Email, payload.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidEmail), errors.Is(err, ErrCannotInviteSelf):
+			response.BadRequest(w, err.Error())
+		case errors.Is(err, ErrNotInHousehold):
+			response.NotFound(w, err.Error())
+		case errors.Is(err, ErrNotAllowed):
+			response.Forbidden(w, err.Error())
+		case errors.Is(err, ErrAlreadyInHousehold), errors.Is(err, ErrPendingInvitationExists):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusCreated, mapInvitation(inv))
+}
+
+// ListInvitations handles GET /households/invitations.
+func (h Handler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	view, err := h.service.ListInvitations(r.Context(), user)
+	if err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	resp := invitationsResponse{
+		Incoming: make([]invitationResponse, 0, len(view.Incoming)),
+		Outgoing: make([]invitationResponse, 0, len(view.Outgoing)),
+	}
+	for _, inv := range view.Incoming {
+		resp.Incoming = append(resp.Incoming, mapInvitation(inv))
+	}
+	for _, inv := range view.Outgoing {
+		resp.Outgoing = append(resp.Outgoing, mapInvitation(inv))
+	}
+
+	response.JSON(w, http.StatusOK, resp)
+}
+
+// AcceptInvitation handles POST /households/invitations/{id}/accept.
+func (h Handler) AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	invitationID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		response.BadRequest(w, "invalid invitation id")
+		return
+	}
+
+	view, err := h.service.AcceptInvitation(r.Context(), invitationID, user)
+	if err != nil {
+		writeAcceptError(w, err)
+		return
+	}
+
+	h.writeHousehold(w, r, http.StatusOK, view)
+}
+
+// RejectInvitation handles POST /households/invitations/{id}/reject.
+func (h Handler) RejectInvitation(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	invitationID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		response.BadRequest(w, "invalid invitation id")
+		return
+	}
+
+	if err := h.service.RejectInvitation(r.Context(), invitationID, user); err != nil {
+		writeAnswerError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "invitation rejected"})
+}
+
+// CancelInvitation handles DELETE /households/invitations/{id}.
+func (h Handler) CancelInvitation(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	invitationID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		response.BadRequest(w, "invalid invitation id")
+		return
+	}
+
+	if err := h.service.CancelInvitation(r.Context(), invitationID, user.ID); err != nil {
+		writeAnswerError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "invitation cancelled"})
+}
+
+// PreviewInvitation handles GET /households/join/{token}. It is public:
+// holding the token proves the invitation email was received.
+func (h Handler) PreviewInvitation(w http.ResponseWriter, r *http.Request) {
+	preview, err := h.service.PreviewInvitation(r.Context(), r.PathValue("token"))
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvitationNotFound):
+			response.NotFound(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusOK, invitationPreviewResponse{
+		InviterName:   preview.InviterName,
+		HouseholdName: preview.HouseholdName,
+		Role:          preview.Role,
+		Status:        preview.Status,
+		ExpiresAt:     preview.ExpiresAt.Format(time.RFC3339),
+	})
+}
+
+// Join handles POST /households/join/{token}.
+func (h Handler) Join(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	view, err := h.service.AcceptInvitationByToken(r.Context(), r.PathValue("token"), user)
+	if err != nil {
+		writeAcceptError(w, err)
+		return
+	}
+
+	h.writeHousehold(w, r, http.StatusOK, view)
+}
+
+// UpdateMember handles PATCH /households/members/{userId}.
+func (h Handler) UpdateMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	memberID, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		response.BadRequest(w, "invalid user id")
+		return
+	}
+
+	var payload updateMemberPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	view, err := h.service.UpdateMemberRole(r.Context(), user.ID, memberID, payload.Role)
+	if err != nil {
+		writeMemberError(w, err)
+		return
+	}
+
+	h.writeHousehold(w, r, http.StatusOK, view)
+}
+
+// RemoveMember handles DELETE /households/members/{userId}.
+func (h Handler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	memberID, err := uuid.Parse(r.PathValue("userId"))
+	if err != nil {
+		response.BadRequest(w, "invalid user id")
+		return
+	}
+
+	if err := h.service.RemoveMember(r.Context(), user.ID, memberID); err != nil {
+		writeMemberError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "member removed"})
+}
+
+// Leave handles POST /households/leave.
+func (h Handler) Leave(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	if err := h.service.Leave(r.Context(), user.ID); err != nil {
+		switch {
+		case errors.Is(err, ErrNotInHousehold):
+			response.NotFound(w, err.Error())
+		case errors.Is(err, ErrOwnerMustTransfer):
+			response.Conflict(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusOK, map[string]string{"message": "left household"})
+}
+
+func (h Handler) writeHousehold(w http.ResponseWriter, r *http.Request, status int, view HouseholdView) {
+	resp := householdResponse{
+		ID:        view.Household.ID.String(),
+		Name:      view.Household.Name,
+		Members:   make([]memberResponse, 0, len(view.Members)),
+		CreatedAt: view.Household.CreatedAt.Format(time.RFC3339),
+	}
+
+	for _, member := range view.Members {
+		user, err := h.service.users.GetByID(r.Context(), member.UserID)
+		if err != nil {
+			if errors.Is(err, users.ErrNotFound) {
+				response.InternalError(w, errors.New("member profile missing"))
+				return
+			}
+			response.InternalError(w, err)
+			return
+		}
+		resp.Members = append(resp.Members, memberResponse{
+			User:     mapUserSummary(user),
+			Role:     member.Role,
+			JoinedAt: member.JoinedAt.Format(time.RFC3339),
+		})
+	}
+
+	response.JSON(w, status, resp)
+}
+
+func writeAcceptError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvitationNotFound):
+		response.NotFound(w, err.Error())
+	case errors.Is(err, ErrNotAllowed):
+		response.Forbidden(w, err.Error())
+	case errors.Is(err, ErrAlreadyInHousehold), errors.Is(err, ErrInvitationNotPending):
+		response.Conflict(w, err.Error())
+	case errors.Is(err, ErrInvitationExpired):
+		response.Error(w, http.StatusGone, err.Error())
+	default:
+		response.InternalError(w, err)
+	}
+}
+
+func writeAnswerError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvitationNotFound):
+		response.NotFound(w, err.Error())
+	case errors.Is(err, ErrNotAllowed):
+		response.Forbidden(w, err.Error())
+	case errors.Is(err, ErrInvitationNotPending):
+		response.Conflict(w, err.Error())
+	case errors.Is(err, ErrInvitationExpired):
+		response.Error(w, http.StatusGone, err.Error())
+	default:
+		response.InternalError(w, err)
+	}
+}
+
+func writeMemberError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidRole):
+		response.BadRequest(w, err.Error())
+	case errors.Is(err, ErrNotInHousehold), errors.Is(err, ErrMemberNotFound):
+		response.NotFound(w, err.Error())
+	case errors.Is(err, ErrNotAllowed):
+		response.Forbidden(w, err.Error())
+	default:
+		response.InternalError(w, err)
+	}
+}
+
+func mapInvitation(inv Invitation) invitationResponse {
+	resp := invitationResponse{
+		ID:          inv.ID.String(),
+		HouseholdID: inv.HouseholdID.String(),
+		InviterID:   inv.InviterUserID.String(),
+		TargetEmail: inv.TargetEmail,
+		Role:        inv.Role,
+		Status:      inv.Status,
+		CreatedAt:   inv.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:   inv.ExpiresAt.Format(time.RFC3339),
+	}
+	if inv.TargetUserID != nil {
+		targetID := inv.TargetUserID.String()
+		resp.TargetID = &targetID
+	}
+	return resp
+}
+
+func mapUserSummary(user users.User) userSummary {
+	return userSummary{
+		ID:    user.ID.String(),
+		Email: user.Email,
+		Name:  user.Name,
+	}
+}
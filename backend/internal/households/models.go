@@ -0,0 +1,91 @@
+package households
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Member roles. The owner manages membership, adults may invite children and
+// manage piggybanks, children take part in piggybanks without managing them.
+const (
+	RoleOwner = "owner"
+	RoleAdult = "adult"
+	RoleChild = "child"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusAccepted  = "accepted"
+	StatusRejected  = "rejected"
+	StatusCancelled = "cancelled"
+	StatusExpired   = "expired"
+)
+
+// InvitationTTL is how long a household invitation can be accepted.
+const InvitationTTL = 7 * 24 * time.Hour
+
+// Household groups members sharing piggybanks. An ended household is kept as
+// history.
+type Household struct {
+	ID            uuid.UUID
+	Name          *string
+	CreatedAt     time.Time
+	EndedAt       *time.Time
+	EndedByUserID *uuid.UUID
+}
+
+// Member is a user's membership of a household. LeftAt is set once the user
+// left or was removed.
+type Member struct {
+	ID          uuid.UUID
+	HouseholdID uuid.UUID
+	UserID      uuid.UUID
+	Role        string
+	JoinedAt    time.Time
+	LeftAt      *time.Time
+}
+
+// Invitation asks a user, or an address without an account yet, to join a
+// household with the given role.
+type Invitation struct {
+	ID              uuid.UUID
+	HouseholdID     uuid.UUID
+	InviterUserID   uuid.UUID
+	TargetUserID    *uuid.UUID
+	TargetEmail     *string
+	Role            string
+	InvitationToken string
+	Status          string
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+	RespondedAt     *time.Time
+}
+
+// Expired reports whether a pending invitation can no longer be answered.
+func (i Invitation) Expired(now time.Time) bool {
+	return i.Status == StatusPending && !now.Before(i.ExpiresAt)
+}
+
+// HouseholdView is a household together with its current members.
+type HouseholdView struct {
+	Household Household
+	Members   []Member
+}
+
+// InvitationsView lists the pending invitations sent to a user and those sent
+// on behalf of the user's household.
+type InvitationsView struct {
+	Incoming []Invitation
+	Outgoing []Invitation
+}
+
+// InvitationPreview is the public summary of an invitation shown to whoever
+// holds its token.
+type InvitationPreview struct {
+	InviterName   string
+	HouseholdName *string
+	Role          string
+	Status        string
+	ExpiresAt     time.Time
+}
@@ -0,0 +1,494 @@
+package households
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/piggybank/backend/internal/common/email"
+	"github.com/piggybank/backend/internal/common/jobs"
+	"github.com/piggybank/backend/internal/settings"
+	"github.com/piggybank/backend/internal/users"
+)
+
+var (
+	ErrNotInHousehold          = errors.New("user does not belong to a household")
+	ErrAlreadyInHousehold      = errors.New("user already belongs to a household")
+	ErrNotAllowed              = errors.New("your role in the household does not allow this")
+	ErrInvalidRole             = errors.New("invalid role")
+	ErrInvalidEmail            = errors.New("invalid email address")
+	ErrCannotInviteSelf        = errors.New("cannot invite yourself")
+	ErrPendingInvitationExists = errors.New("an invitation is already pending for this person")
+	ErrInvitationNotFound      = errors.New("household invitation not found")
+	ErrInvitationNotPending    = errors.New("invitation is no longer pending")
+	ErrInvitationExpired       = errors.New("invitation has expired")
+	ErrMemberNotFound          = errors.New("household member not found")
+	ErrOwnerMustTransfer       = errors.New("transfer ownership before leaving the household")
+)
+
+// Service coordinates household membership and invitations.
+type Service struct {
+	store       Store
+	users       users.Repository
+	emailSender *email.Service
+	settings    settings.Service
+}
+
+// NewService constructs a Service.
+func NewService(store Store, usersRepo users.Repository, emailSender *email.Service, settingsService settings.Service) Service {
+	return Service{store: store, users: usersRepo, emailSender: emailSender, settings: settingsService}
+}
+
+// Create starts a household owned by user.
+func (s Service) Create(ctx context.Context, user users.User, name *string) (HouseholdView, error) {
+	if _, err := s.store.GetActiveMembership(ctx, user.ID); err == nil {
+		return HouseholdView{}, ErrAlreadyInHousehold
+	} else if !errors.Is(err, ErrNotFound) {
+		return HouseholdView{}, err
+	}
+
+	if name != nil {
+		trimmed := strings.TrimSpace(*name)
+		name = &trimmed
+		if trimmed == "" {
+			name = nil
+		}
+	}
+
+	now := time.Now().UTC()
+	household := Household{ID: uuid.New(), Name: name, CreatedAt: now}
+	owner := Member{
+		ID:          uuid.New(),
+		HouseholdID: household.ID,
+		UserID:      user.ID,
+		Role:        RoleOwner,
+		JoinedAt:    now,
+	}
+	if err := s.store.CreateHousehold(ctx, household, owner); err != nil {
+		return HouseholdView{}, err
+	}
+
+	return HouseholdView{Household: household, Members: []Member{owner}}, nil
+}
+
+// Get returns the current household of a user with its members.
+func (s Service) Get(ctx context.Context, userID uuid.UUID) (HouseholdView, error) {
+	membership, err := s.membership(ctx, userID)
+	if err != nil {
+		return HouseholdView{}, err
+	}
+	return s.view(ctx, membership.HouseholdID)
+}
+
+// Invite asks the person behind emailAddress to join the inviter's household.
+// The owner may invite adults and children, adults may invite children.
+func (s Service) Invite(ctx context.Context, inviter users.User, emailAddress, role string) (Invitation, error) {
+	membership, err := s.membership(ctx, inviter.ID)
+	if err != nil {
+		return Invitation{}, err
+	}
+
+	if role != RoleAdult && role != RoleChild {
+		return Invitation{}, ErrInvalidRole
+	}
+	if membership.Role == RoleChild || (role == RoleAdult && membership.Role != RoleOwner) {
+		return Invitation{}, ErrNotAllowed
+	}
+
+	address := strings.TrimSpace(strings.ToLower(emailAddress))
+	if _, err := mail.ParseAddress(address); err != nil || address == "" {
+		return Invitation{}, ErrInvalidEmail
+	}
+
+	var targetUserID *uuid.UUID
+	target, err := s.users.GetByEmail(ctx, address)
+	switch {
+	case err == nil:
+		if target.ID == inviter.ID {
+			return Invitation{}, ErrCannotInviteSelf
+		}
+		if _, err := s.store.GetActiveMembership(ctx, target.ID); err == nil {
+			return Invitation{}, ErrAlreadyInHousehold
+		} else if !errors.Is(err, ErrNotFound) {
+			return Invitation{}, err
+		}
+		targetUserID = &target.ID
+	case errors.Is(err, users.ErrNotFound):
+	default:
+		return Invitation{}, err
+	}
+
+	pending, err := s.store.HasPendingInvitation(ctx, membership.HouseholdID, targetUserID, address)
+	if err != nil {
+		return Invitation{}, err
+	}
+	if pending {
+		return Invitation{}, ErrPendingInvitationExists
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return Invitation{}, err
+	}
+
+	now := time.Now().UTC()
+	inv := Invitation{
+		ID:              uuid.New(),
+		HouseholdID:     membership.HouseholdID,
+		InviterUserID:   inviter.ID,
+		TargetUserID:    targetUserID,
+		Role:            role,
+		InvitationToken: hex.EncodeToString(tokenBytes),
+		Status:          StatusPending,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(InvitationTTL),
+	}
+	if targetUserID == nil {
+		inv.TargetEmail = &address
+	}
+
+	if err := s.store.CreateInvitation(ctx, inv); err != nil {
+		return Invitation{}, err
+	}
+
+	if s.emailSender != nil {
+		household, err := s.store.GetHousehold(ctx, membership.HouseholdID)
+		if err != nil {
+			return Invitation{}, err
+		}
+		householdName := ""
+		if household.Name != nil {
+			householdName = *household.Name
+		}
+		st, err := s.settings.ForHousehold(ctx, household.ID)
+		if err != nil {
+			return Invitation{}, err
+		}
+		go func() {
+			if err := s.emailSender.SendHouseholdInvitation(address, inviter.Name, householdName, inv.InvitationToken, InvitationTTL, st.Formatting()); err != nil {
+				log.Printf("failed to send household invitation to %s: %v", address, err)
+			}
+		}()
+	}
+
+	return inv, nil
+}
+
+// ListInvitations returns the pending invitations addressed to user and those
+// sent on behalf of user's household.
+func (s Service) ListInvitations(ctx context.Context, user users.User) (InvitationsView, error) {
+	view := InvitationsView{}
+
+	incoming, err := s.store.ListPendingInvitationsForUser(ctx, user.ID)
+	if err != nil {
+		return InvitationsView{}, err
+	}
+	view.Incoming = incoming
+
+	membership, err := s.store.GetActiveMembership(ctx, user.ID)
+	if err == nil {
+		outgoing, err := s.store.ListPendingInvitationsForHousehold(ctx, membership.HouseholdID)
+		if err != nil {
+			return InvitationsView{}, err
+		}
+		view.Outgoing = outgoing
+	} else if !errors.Is(err, ErrNotFound) {
+		return InvitationsView{}, err
+	}
+
+	return view, nil
+}
+
+// AcceptInvitation joins the household of an invitation addressed to user.
+func (s Service) AcceptInvitation(ctx context.Context, invitationID uuid.UUID, user users.User) (HouseholdView, error) {
+	inv, err := s.store.GetInvitationByID(ctx, invitationID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return HouseholdView{}, ErrInvitationNotFound
+		}
+		return HouseholdView{}, err
+	}
+	return s.accept(ctx, inv, user, false)
+}
+
+// AcceptInvitationByToken joins the household of the invitation behind the
+// token sent by email. Holding the token proves access to the invited
+// address, so it need not be verified.
+func (s Service) AcceptInvitationByToken(ctx context.Context, token string, user users.User) (HouseholdView, error) {
+	inv, err := s.store.GetInvitationByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return HouseholdView{}, ErrInvitationNotFound
+		}
+		return HouseholdView{}, err
+	}
+	return s.accept(ctx, inv, user, true)
+}
+
+func (s Service) accept(ctx context.Context, inv Invitation, user users.User, byToken bool) (HouseholdView, error) {
+	if !addressedTo(inv, user, byToken) {
+		return HouseholdView{}, ErrNotAllowed
+	}
+	if inv.Status != StatusPending {
+		return HouseholdView{}, ErrInvitationNotPending
+	}
+
+	now := time.Now().UTC()
+	if inv.Expired(now) {
+		return HouseholdView{}, ErrInvitationExpired
+	}
+
+	if _, err := s.store.GetActiveMembership(ctx, user.ID); err == nil {
+		return HouseholdView{}, ErrAlreadyInHousehold
+	} else if !errors.Is(err, ErrNotFound) {
+		return HouseholdView{}, err
+	}
+
+	member := Member{
+		ID:          uuid.New(),
+		HouseholdID: inv.HouseholdID,
+		UserID:      user.ID,
+		Role:        inv.Role,
+		JoinedAt:    now,
+	}
+	if err := s.store.AcceptInvitationWithMember(ctx, inv.ID, member); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return HouseholdView{}, ErrInvitationNotPending
+		}
+		return HouseholdView{}, err
+	}
+
+	return s.view(ctx, inv.HouseholdID)
+}
+
+// RejectInvitation declines an invitation addressed to user.
+func (s Service) RejectInvitation(ctx context.Context, invitationID uuid.UUID, user users.User) error {
+	inv, err := s.pendingInvitation(ctx, invitationID)
+	if err != nil {
+		return err
+	}
+	if !addressedTo(inv, user, false) {
+		return ErrNotAllowed
+	}
+	return s.answer(ctx, inv, StatusRejected)
+}
+
+// CancelInvitation withdraws an invitation. The inviter and the owner of the
+// household may cancel it.
+func (s Service) CancelInvitation(ctx context.Context, invitationID uuid.UUID, userID uuid.UUID) error {
+	inv, err := s.pendingInvitation(ctx, invitationID)
+	if err != nil {
+		return err
+	}
+
+	if inv.InviterUserID != userID {
+		membership, err := s.store.GetActiveMembership(ctx, userID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err != nil || membership.HouseholdID != inv.HouseholdID || membership.Role != RoleOwner {
+			return ErrNotAllowed
+		}
+	}
+	return s.answer(ctx, inv, StatusCancelled)
+}
+
+func (s Service) pendingInvitation(ctx context.Context, invitationID uuid.UUID) (Invitation, error) {
+	inv, err := s.store.GetInvitationByID(ctx, invitationID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Invitation{}, ErrInvitationNotFound
+		}
+		return Invitation{}, err
+	}
+	if inv.Status != StatusPending {
+		return Invitation{}, ErrInvitationNotPending
+	}
+	if inv.Expired(time.Now().UTC()) {
+		return Invitation{}, ErrInvitationExpired
+	}
+	return inv, nil
+}
+
+func (s Service) answer(ctx context.Context, inv Invitation, status string) error {
+	if err := s.store.UpdateInvitationStatus(ctx, inv.ID, status, time.Now().UTC()); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrInvitationNotPending
+		}
+		return err
+	}
+	return nil
+}
+
+// PreviewInvitation describes the invitation behind token. A pending
+// invitation past its expiry is reported as expired.
+func (s Service) PreviewInvitation(ctx context.Context, token string) (InvitationPreview, error) {
+	inv, err := s.store.GetInvitationByToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return InvitationPreview{}, ErrInvitationNotFound
+		}
+		return InvitationPreview{}, err
+	}
+
+	inviter, err := s.users.GetByID(ctx, inv.InviterUserID)
+	if err != nil {
+		return InvitationPreview{}, err
+	}
+
+	household, err := s.store.GetHousehold(ctx, inv.HouseholdID)
+	if err != nil {
+		return InvitationPreview{}, err
+	}
+
+	preview := InvitationPreview{
+		InviterName:   inviter.Name,
+		HouseholdName: household.Name,
+		Role:          inv.Role,
+		Status:        inv.Status,
+		ExpiresAt:     inv.ExpiresAt,
+	}
+	if inv.Expired(time.Now().UTC()) {
+		preview.Status = StatusExpired
+	}
+	return preview, nil
+}
+
+// UpdateMemberRole changes the role of a member. Only the owner may change
+// roles; making another member owner hands over ownership and the previous
+// owner becomes an adult.
+func (s Service) UpdateMemberRole(ctx context.Context, actorID, memberUserID uuid.UUID, role string) (HouseholdView, error) {
+	if role != RoleOwner && role != RoleAdult && role != RoleChild {
+		return HouseholdView{}, ErrInvalidRole
+	}
+
+	actor, err := s.membership(ctx, actorID)
+	if err != nil {
+		return HouseholdView{}, err
+	}
+	if actor.Role != RoleOwner || memberUserID == actorID {
+		return HouseholdView{}, ErrNotAllowed
+	}
+
+	if role == RoleOwner {
+		err = s.store.TransferOwnership(ctx, actor.HouseholdID, actorID, memberUserID)
+	} else {
+		err = s.store.UpdateMemberRole(ctx, actor.HouseholdID, memberUserID, role)
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return HouseholdView{}, ErrMemberNotFound
+		}
+		return HouseholdView{}, err
+	}
+
+	return s.view(ctx, actor.HouseholdID)
+}
+
+// RemoveMember removes another member from the owner's household.
+func (s Service) RemoveMember(ctx context.Context, actorID, memberUserID uuid.UUID) error {
+	actor, err := s.membership(ctx, actorID)
+	if err != nil {
+		return err
+	}
+	if actor.Role != RoleOwner || memberUserID == actorID {
+		return ErrNotAllowed
+	}
+
+	if err := s.store.RemoveMember(ctx, actor.HouseholdID, memberUserID, time.Now().UTC()); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrMemberNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Leave removes userID from their household. The owner must hand over
+// ownership first unless they are the last member, in which case the
+// household ends and its piggybanks become theirs.
+func (s Service) Leave(ctx context.Context, userID uuid.UUID) error {
+	membership, err := s.membership(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	members, err := s.store.ListActiveMembers(ctx, membership.HouseholdID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	switch {
+	case len(members) == 1:
+		err = s.store.EndHousehold(ctx, membership.HouseholdID, userID, now)
+	case membership.Role == RoleOwner:
+		return ErrOwnerMustTransfer
+	default:
+		err = s.store.RemoveMember(ctx, membership.HouseholdID, userID, now)
+	}
+	if errors.Is(err, ErrNotFound) {
+		return ErrNotInHousehold
+	}
+	return err
+}
+
+// ExpireStaleInvitations marks pending invitations past their expiry as expired.
+func (s Service) ExpireStaleInvitations(ctx context.Context) (int64, error) {
+	return s.store.ExpireStaleInvitations(ctx, time.Now().UTC())
+}
+
+// RunExpirySweeper expires stale invitations every interval until ctx is done.
+// The update is idempotent, so every replica may run it.
+func (s Service) RunExpirySweeper(ctx context.Context, interval time.Duration) {
+	jobs.Every(ctx, interval, "household invitation expiry", func(ctx context.Context) (int, error) {
+		n, err := s.ExpireStaleInvitations(ctx)
+		return int(n), err
+	})
+}
+
+func (s Service) membership(ctx context.Context, userID uuid.UUID) (Member, error) {
+	membership, err := s.store.GetActiveMembership(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return Member{}, ErrNotInHousehold
+		}
+		return Member{}, err
+	}
+	return membership, nil
+}
+
+func (s Service) view(ctx context.Context, householdID uuid.UUID) (HouseholdView, error) {
+	household, err := s.store.GetHousehold(ctx, householdID)
+	if err != nil {
+		return HouseholdView{}, err
+	}
+
+	members, err := s.store.ListActiveMembers(ctx, householdID)
+	if err != nil {
+		return HouseholdView{}, err
+	}
+
+	return HouseholdView{Household: household, Members: members}, nil
+}
+
+// addressedTo reports whether inv was sent to user, directly or to their
+// address before they had an account. An invitation sent to an address only
+// counts once the account has verified it, unless the emailed token was
+// presented, as anyone may register an account with someone else's address.
+func addressedTo(inv Invitation, user users.User, byToken bool) bool {
+	if inv.TargetUserID != nil {
+		return *inv.TargetUserID == user.ID
+	}
+	if user.EmailVerifiedAt == nil && !byToken {
+		return false
+	}
+	return inv.TargetEmail != nil && strings.EqualFold(*inv.TargetEmail, user.Email)
+}
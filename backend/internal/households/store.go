@@ -0,0 +1,390 @@
+package households
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Store encapsulates database persistence for households.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a new households store.
+func NewStore(pool *pgxpool.Pool) Store {
+	return Store{pool: pool}
+}
+
+// CreateHousehold inserts a household with its owner. It returns
+// ErrAlreadyInHousehold when the owner joined another household meanwhile.
+func (s Store) CreateHousehold(ctx context.Context, h Household, owner Member) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        INSERT INTO households (id, name, created_at)
+        VALUES ($1, $2, $3)
+    `
+	if _, err := tx.Exec(ctx, query, h.ID, h.Name, h.CreatedAt); err != nil {
+		return err
+	}
+
+	if err := insertMember(ctx, tx, owner); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s Store) GetHousehold(ctx context.Context, id uuid.UUID) (Household, error) {
+	query := `
+        SELECT id, name, created_at, ended_at, ended_by_user_id
+        FROM households
+        WHERE id = $1
+    `
+	var h Household
+	if err := s.pool.QueryRow(ctx, query, id).Scan(&h.ID, &h.Name, &h.CreatedAt, &h.EndedAt, &h.EndedByUserID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Household{}, ErrNotFound
+		}
+		return Household{}, err
+	}
+	return h, nil
+}
+
+// GetActiveMembership returns the current membership of a user.
+func (s Store) GetActiveMembership(ctx context.Context, userID uuid.UUID) (Member, error) {
+	query := `
+        SELECT id, household_id, user_id, role, joined_at, left_at
+        FROM household_members
+        WHERE user_id = $1 AND left_at IS NULL
+        LIMIT 1
+    `
+	var m Member
+	if err := s.pool.QueryRow(ctx, query, userID).Scan(&m.ID, &m.HouseholdID, &m.UserID, &m.Role, &m.JoinedAt, &m.LeftAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Member{}, ErrNotFound
+		}
+		return Member{}, err
+	}
+	return m, nil
+}
+
+// ListActiveMembers returns the current members of a household, owner first.
+func (s Store) ListActiveMembers(ctx context.Context, householdID uuid.UUID) ([]Member, error) {
+	query := `
+        SELECT id, household_id, user_id, role, joined_at, left_at
+        FROM household_members
+        WHERE household_id = $1 AND left_at IS NULL
+        ORDER BY role = 'owner' DESC, joined_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, householdID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []Member
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.ID, &m.HouseholdID, &m.UserID, &m.Role, &m.JoinedAt, &m.LeftAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// UpdateMemberRole changes the role of a current member. The owner role is
+// only handed over with TransferOwnership.
+func (s Store) UpdateMemberRole(ctx context.Context, householdID, userID uuid.UUID, role string) error {
+	query := `
+        UPDATE household_members
+        SET role = $3
+        WHERE household_id = $1 AND user_id = $2 AND left_at IS NULL AND role <> 'owner'
+    `
+	tag, err := s.pool.Exec(ctx, query, householdID, userID, role)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TransferOwnership makes toUserID the owner and fromUserID an adult.
+func (s Store) TransferOwnership(ctx context.Context, householdID, fromUserID, toUserID uuid.UUID) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        UPDATE household_members
+        SET role = $4
+        WHERE household_id = $1 AND user_id = $2 AND left_at IS NULL AND role = $3
+    `
+	tag, err := tx.Exec(ctx, query, householdID, fromUserID, RoleOwner, RoleAdult)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	promoteQuery := `
+        UPDATE household_members
+        SET role = $3
+        WHERE household_id = $1 AND user_id = $2 AND left_at IS NULL
+    `
+	tag, err = tx.Exec(ctx, promoteQuery, householdID, toUserID, RoleOwner)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RemoveMember records that a member left the household.
+func (s Store) RemoveMember(ctx context.Context, householdID, userID uuid.UUID, leftAt time.Time) error {
+	query := `
+        UPDATE household_members
+        SET left_at = $3
+        WHERE household_id = $1 AND user_id = $2 AND left_at IS NULL
+    `
+	tag, err := s.pool.Exec(ctx, query, householdID, userID, leftAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// EndHousehold ends a household whose last member, userID, leaves. Its
+// piggybanks become solo piggybanks of that member.
+func (s Store) EndHousehold(ctx context.Context, householdID, userID uuid.UUID, endedAt time.Time) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	endQuery := `
+        UPDATE households
+        SET ended_at = $2, ended_by_user_id = $3
+        WHERE id = $1 AND ended_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, endQuery, householdID, endedAt, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	leaveQuery := `
+        UPDATE household_members
+        SET left_at = $2
+        WHERE household_id = $1 AND left_at IS NULL
+    `
+	if _, err := tx.Exec(ctx, leaveQuery, householdID, endedAt); err != nil {
+		return err
+	}
+
+	handoverQuery := `
+        UPDATE piggybanks
+        SET couple_id = NULL, owner_user_id = $2, updated_at = $3
+        WHERE couple_id = $1 AND archived_at IS NULL
+    `
+	if _, err := tx.Exec(ctx, handoverQuery, householdID, userID, endedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s Store) CreateInvitation(ctx context.Context, inv Invitation) error {
+	query := `
+        INSERT INTO household_invitations (id, household_id, inviter_user_id, target_user_id, target_email, role, invitation_token, status, created_at, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+    `
+	_, err := s.pool.Exec(ctx, query, inv.ID, inv.HouseholdID, inv.InviterUserID, inv.TargetUserID, inv.TargetEmail, inv.Role, inv.InvitationToken, inv.Status, inv.CreatedAt, inv.ExpiresAt)
+	return err
+}
+
+const invitationColumns = `id, household_id, inviter_user_id, target_user_id, target_email, role, invitation_token, status, created_at, expires_at, responded_at`
+
+func scanInvitation(row pgx.Row) (Invitation, error) {
+	var inv Invitation
+	err := row.Scan(&inv.ID, &inv.HouseholdID, &inv.InviterUserID, &inv.TargetUserID, &inv.TargetEmail, &inv.Role, &inv.InvitationToken, &inv.Status, &inv.CreatedAt, &inv.ExpiresAt, &inv.RespondedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Invitation{}, ErrNotFound
+	}
+	return inv, err
+}
+
+func (s Store) GetInvitationByID(ctx context.Context, id uuid.UUID) (Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM household_invitations WHERE id = $1`
+	return scanInvitation(s.pool.QueryRow(ctx, query, id))
+}
+
+func (s Store) GetInvitationByToken(ctx context.Context, token string) (Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM household_invitations WHERE invitation_token = $1`
+	return scanInvitation(s.pool.QueryRow(ctx, query, token))
+}
+
+// ListPendingInvitationsForUser returns the invitations addressed to a user,
+// either directly or to their email address before they had an account. The
+// latter only once the user has verified that address.
+func (s Store) ListPendingInvitationsForUser(ctx context.Context, userID uuid.UUID) ([]Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+        FROM household_invitations
+        WHERE (target_user_id = $1 OR (target_user_id IS NULL AND LOWER(target_email) = (
+                  SELECT LOWER(email) FROM users WHERE id = $1 AND email_verified_at IS NOT NULL
+              )))
+          AND status = 'pending' AND expires_at > NOW()
+        ORDER BY created_at DESC
+    `
+	return s.listInvitations(ctx, query, userID)
+}
+
+// ListPendingInvitationsForHousehold returns the invitations sent on behalf of
+// a household.
+func (s Store) ListPendingInvitationsForHousehold(ctx context.Context, householdID uuid.UUID) ([]Invitation, error) {
+	query := `SELECT ` + invitationColumns + `
+        FROM household_invitations
+        WHERE household_id = $1 AND status = 'pending' AND expires_at > NOW()
+        ORDER BY created_at DESC
+    `
+	return s.listInvitations(ctx, query, householdID)
+}
+
+func (s Store) listInvitations(ctx context.Context, query string, args ...interface{}) ([]Invitation, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invitations []Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, inv)
+	}
+	return invitations, rows.Err()
+}
+
+// HasPendingInvitation reports whether the household already invited the
+// user or address.
+func (s Store) HasPendingInvitation(ctx context.Context, householdID uuid.UUID, targetUserID *uuid.UUID, email string) (bool, error) {
+	query := `
+        SELECT EXISTS (
+            SELECT 1
+            FROM household_invitations
+            WHERE household_id = $1 AND status = 'pending' AND expires_at > NOW()
+              AND (target_user_id = $2 OR LOWER(target_email) = LOWER($3))
+        )
+    `
+	var exists bool
+	err := s.pool.QueryRow(ctx, query, householdID, targetUserID, email).Scan(&exists)
+	return exists, err
+}
+
+// UpdateInvitationStatus answers a pending, unexpired invitation.
+func (s Store) UpdateInvitationStatus(ctx context.Context, id uuid.UUID, status string, respondedAt time.Time) error {
+	query := `
+        UPDATE household_invitations
+        SET status = $2, responded_at = $3
+        WHERE id = $1 AND status = 'pending' AND expires_at > $3
+    `
+	tag, err := s.pool.Exec(ctx, query, id, status, respondedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AcceptInvitationWithMember accepts an invitation and adds the member in a
+// single transaction. It returns ErrNotFound when the invitation is no longer
+// pending or the household has ended, and ErrAlreadyInHousehold when the user
+// joined another household meanwhile.
+func (s Store) AcceptInvitationWithMember(ctx context.Context, invitationID uuid.UUID, member Member) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	updateQuery := `
+        UPDATE household_invitations hi
+        SET status = $2, responded_at = $3, target_user_id = $4
+        FROM households h
+        WHERE hi.id = $1 AND hi.household_id = h.id AND h.ended_at IS NULL
+          AND hi.status = 'pending' AND hi.expires_at > $3
+    `
+	tag, err := tx.Exec(ctx, updateQuery, invitationID, StatusAccepted, member.JoinedAt, member.UserID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	if err := insertMember(ctx, tx, member); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ExpireStaleInvitations marks pending invitations past their expiry as
+// expired and returns how many were updated.
+func (s Store) ExpireStaleInvitations(ctx context.Context, now time.Time) (int64, error) {
+	query := `
+        UPDATE household_invitations
+        SET status = 'expired'
+        WHERE status = 'pending' AND expires_at <= $1
+    `
+	tag, err := s.pool.Exec(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func insertMember(ctx context.Context, tx pgx.Tx, m Member) error {
+	query := `
+        INSERT INTO household_members (id, household_id, user_id, role, joined_at)
+        VALUES ($1, $2, $3, $4, $5)
+    `
+	_, err := tx.Exec(ctx, query, m.ID, m.HouseholdID, m.UserID, m.Role, m.JoinedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrAlreadyInHousehold
+	}
+	return err
+}
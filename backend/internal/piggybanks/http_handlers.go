@@ -1,8 +1,11 @@
 package piggybanks
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,6 +27,71 @@ type createPiggyBankPayload struct {
 	Description *string `json:"description"`
 	StartDate   string  `json:"startDate"`
 	EndDate     *string `json:"endDate"`
+	TargetCents *int    `json:"targetCents"`
+	TargetDate  *string `json:"targetDate"`
+	Recurrence  *string `json:"recurrence"`
+}
+
+type updatePiggyBankPayload struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+	StartDate   *string `json:"startDate"`
+	EndDate     *string `json:"endDate"`
+	TargetCents *int    `json:"targetCents"`
+	TargetDate  *string `json:"targetDate"`
+	Recurrence  *string `json:"recurrence"`
+}
+
+type createMilestonePayload struct {
+	ThresholdCents int     `json:"thresholdCents"`
+	Reward         *string `json:"reward"`
+	Position       *int    `json:"position"`
+}
+
+type updateMilestonePayload struct {
+	ThresholdCents *int    `json:"thresholdCents"`
+	Reward         *string `json:"reward"`
+	Position       *int    `json:"position"`
+}
+
+type milestoneResponse struct {
+	ID             string  `json:"id"`
+	ThresholdCents int     `json:"thresholdCents"`
+	Reward         *string `json:"reward"`
+	Position       int     `json:"position"`
+	Reached        bool    `json:"reached"`
+	ReachedAt      *string `json:"reachedAt"`
+	RemainingCents *int    `json:"remainingCents,omitempty"`
+}
+
+type progressResponse struct {
+	TargetCents     int     `json:"targetCents"`
+	TotalValue      int     `json:"totalValue"`
+	Percent         int     `json:"percent"`
+	RemainingCents  int     `json:"remainingCents"`
+	Deadline        *string `json:"deadline"`
+	RequiredPerDay  *int    `json:"requiredPerDay"`
+	RequiredPerWeek *int    `json:"requiredPerWeek"`
+	Reached         bool    `json:"reached"`
+	ReachedAt       *string `json:"reachedAt"`
+}
+
+type deletionResponse struct {
+	Status          string   `json:"status"`
+	AwaitingUserIDs []string `json:"awaitingUserIds,omitempty"`
+	RestorableUntil *string  `json:"restorableUntil,omitempty"`
+}
+
+type promotePiggyBanksPayload struct {
+	PiggyBankIDs []string `json:"piggyBankIds"`
+}
+
+type eventResponse struct {
+	ID        string          `json:"id"`
+	UserID    *string         `json:"userId"`
+	EventType string          `json:"eventType"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt string          `json:"createdAt"`
 }
 
 type piggyBankResponse struct {
@@ -34,10 +102,21 @@ type piggyBankResponse struct {
 	Description            *string `json:"description"`
 	StartDate              string  `json:"startDate"`
 	EndDate                *string `json:"endDate"`
+	TargetCents            *int    `json:"targetCents"`
+	TargetDate             *string `json:"targetDate"`
+	Recurrence             *string `json:"recurrence"`
+	PeriodEndsAt           *string `json:"periodEndsAt"`
+	SeriesID               *string `json:"seriesId"`
+	PreviousID             *string `json:"previousId"`
+	FinalisedAt            *string `json:"finalisedAt"`
+	ArchivedAt             *string `json:"archivedAt"`
+	DeletedAt              *string `json:"deletedAt,omitempty"`
 	CreatedAt              string  `json:"createdAt"`
 	VoucherTemplatesCount  int     `json:"voucherTemplatesCount"`
 	TotalActions           int     `json:"totalActions"`
 	TotalValue             int     `json:"totalValue"`
+	Progress               *progressResponse `json:"progress,omitempty"`
+	Milestones             []milestoneResponse `json:"milestones,omitempty"`
 }
 
 func (h Handler) Create(c *gin.Context) {
@@ -69,63 +148,226 @@ func (h Handler) Create(c *gin.Context) {
 		endDate = &parsedEndDate
 	}
 
-	pb, err := h.service.Create(c.Request.Context(), user.ID, payload.Title, payload.Description, startDate, endDate)
+	var targetDate *time.Time
+	if payload.TargetDate != nil {
+		parsedTargetDate, err := time.Parse(time.RFC3339, *payload.TargetDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid targetDate format"})
+			return
+		}
+		targetDate = &parsedTargetDate
+	}
+
+	pb, err := h.service.Create(c.Request.Context(), user.ID, payload.Title, payload.Description, startDate, endDate, payload.TargetCents, targetDate, payload.Recurrence)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrNotAuthorized):
 			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrInvalidTarget), errors.Is(err, ErrInvalidRecurrence), errors.Is(err, ErrRecurringEndDate):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
 		return
 	}
 
-	resp := piggyBankResponse{
-		ID:          pb.ID.String(),
-		CoupleID:    formatUUIDPtr(pb.CoupleID),
-		OwnerUserID: formatUUIDPtr(pb.OwnerUserID),
-		Title:       pb.Title,
-		Description: pb.Description,
-		StartDate:   pb.StartDate.Format(time.RFC3339),
-		EndDate:     formatTimePtr(pb.EndDate),
-		CreatedAt:   pb.CreatedAt.Format(time.RFC3339),
+	c.JSON(http.StatusCreated, mapPiggyBank(pb))
+}
+
+func (h Handler) List(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
 	}
 
-	c.JSON(http.StatusCreated, resp)
+	filter := ListFilter{
+		Status: c.Query("status"),
+		Search: c.Query("q"),
+		Sort:   c.Query("sort"),
+		Order:  c.Query("order"),
+	}
+	for name, dest := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if raw := c.Query(name); raw != "" {
+			t, err := parseDate(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + " format"})
+				return
+			}
+			*dest = &t
+		}
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		filter.Limit = limit
+	}
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := DecodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		filter.After = &cursor
+	}
+
+	piggyBanks, next, err := h.service.ListByUser(c.Request.Context(), user.ID, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidStatus), errors.Is(err, ErrInvalidSort), errors.Is(err, ErrInvalidOrder),
+			errors.Is(err, ErrInvalidCursor):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	if next != "" {
+		nextURL := *c.Request.URL
+		query := nextURL.Query()
+		query.Set("cursor", next)
+		nextURL.RawQuery = query.Encode()
+		c.Header("Link", fmt.Sprintf("<%s>; rel=\"next\"", nextURL.RequestURI()))
+	}
+
+	c.JSON(http.StatusOK, mapPiggyBankViews(piggyBanks))
 }
 
-func (h Handler) List(c *gin.Context) {
+// ListSolo handles GET /piggybanks/solo.
+func (h Handler) ListSolo(c *gin.Context) {
 	user, ok := auth.UserFromContext(c.Request.Context())
 	if !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
 		return
 	}
 
-	piggyBanks, err := h.service.ListByUser(c.Request.Context(), user.ID)
+	piggyBanks, err := h.service.ListSolo(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
+	c.JSON(http.StatusOK, mapPiggyBankViews(piggyBanks))
+}
+
+// Promote handles POST /piggybanks/promote.
+func (h Handler) Promote(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	var payload promotePiggyBanksPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(payload.PiggyBankIDs))
+	for _, raw := range payload.PiggyBankIDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid piggybank id"})
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if err := h.service.Promote(c.Request.Context(), user.ID, ids); err != nil {
+		switch {
+		case errors.Is(err, ErrNoPiggyBanks):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNoHousehold):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNotAuthorized):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "solo piggybank not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListEvents handles GET /piggybanks/:id/events.
+func (h Handler) ListEvents(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	events, err := h.service.ListEvents(c.Request.Context(), id, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrNotAuthorized):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	resp := make([]eventResponse, 0, len(events))
+	for _, e := range events {
+		item := eventResponse{
+			ID:        e.ID.String(),
+			UserID:    formatUUIDPtr(e.UserID),
+			EventType: e.EventType,
+			CreatedAt: e.CreatedAt.Format(time.RFC3339),
+		}
+		if e.Details != nil {
+			item.Details = json.RawMessage(*e.Details)
+		}
+		resp = append(resp, item)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func mapPiggyBankViews(piggyBanks []PiggyBankView) []piggyBankResponse {
+	now := time.Now()
 	resp := make([]piggyBankResponse, 0, len(piggyBanks))
 	for _, pbv := range piggyBanks {
-		pb := pbv.PiggyBank
-		resp = append(resp, piggyBankResponse{
-			ID:                    pb.ID.String(),
-			CoupleID:              formatUUIDPtr(pb.CoupleID),
-			OwnerUserID:           formatUUIDPtr(pb.OwnerUserID),
-			Title:                 pb.Title,
-			Description:           pb.Description,
-			StartDate:             pb.StartDate.Format(time.RFC3339),
-			EndDate:               formatTimePtr(pb.EndDate),
-			CreatedAt:             pb.CreatedAt.Format(time.RFC3339),
-			VoucherTemplatesCount: pbv.VoucherTemplatesCount,
-			TotalActions:          pbv.TotalActions,
-			TotalValue:            pbv.TotalValue,
-		})
+		resp = append(resp, mapPiggyBankView(pbv, now))
 	}
+	return resp
+}
 
-	c.JSON(http.StatusOK, resp)
+func mapPiggyBankView(pbv PiggyBankView, now time.Time) piggyBankResponse {
+	resp := mapPiggyBank(pbv.PiggyBank)
+	resp.VoucherTemplatesCount = pbv.VoucherTemplatesCount
+	resp.TotalActions = pbv.TotalActions
+	resp.TotalValue = pbv.TotalValue
+
+	if p := pbv.Progress(now); p != nil {
+		resp.Progress = &progressResponse{
+			TargetCents:     p.TargetCents,
+			TotalValue:      p.TotalValue,
+			Percent:         p.Percent,
+			RemainingCents:  p.RemainingCents,
+			Deadline:        formatTimePtr(p.Deadline),
+			RequiredPerDay:  p.RequiredPerDay,
+			RequiredPerWeek: p.RequiredPerWeek,
+			Reached:         p.ReachedAt != nil,
+			ReachedAt:       formatTimePtr(p.ReachedAt),
+		}
+	}
+	return resp
 }
 
 func (h Handler) GetByID(c *gin.Context) {
@@ -142,7 +384,7 @@ func (h Handler) GetByID(c *gin.Context) {
 		return
 	}
 
-	pb, err := h.service.GetByID(c.Request.Context(), id, user.ID)
+	pbv, err := h.service.GetByID(c.Request.Context(), id, user.ID)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrNotFound):
@@ -155,20 +397,36 @@ func (h Handler) GetByID(c *gin.Context) {
 		return
 	}
 
-	resp := piggyBankResponse{
-		ID:          pb.ID.String(),
-		CoupleID:    formatUUIDPtr(pb.CoupleID),
-		OwnerUserID: formatUUIDPtr(pb.OwnerUserID),
-		Title:       pb.Title,
-		Description: pb.Description,
-		StartDate:   pb.StartDate.Format(time.RFC3339),
-		EndDate:     formatTimePtr(pb.EndDate),
-		CreatedAt:   pb.CreatedAt.Format(time.RFC3339),
+	milestones, err := h.service.ListMilestones(c.Request.Context(), id, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	resp := mapPiggyBankView(pbv, time.Now())
+	for _, m := range milestones {
+		item := mapMilestone(m)
+		if m.ReachedAt == nil {
+			remaining := m.ThresholdCents - pbv.TotalValue
+			if remaining < 0 {
+				remaining = 0
+			}
+			item.RemainingCents = &remaining
+		}
+		resp.Milestones = append(resp.Milestones, item)
 	}
 
 	c.JSON(http.StatusOK, resp)
 }
 
+// parseDate parses a date as YYYY-MM-DD or RFC3339.
+func parseDate(raw string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
 func formatTimePtr(t *time.Time) *string {
 	if t == nil {
 		return nil
@@ -205,6 +463,8 @@ func (h Handler) Close(c *gin.Context) {
 			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
 		case errors.Is(err, ErrNotFound):
 			c.JSON(http.StatusNotFound, gin.H{"error": "piggybank not found"})
+		case errors.Is(err, ErrArchived):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
@@ -213,3 +473,389 @@ func (h Handler) Close(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// Update handles PATCH /piggybanks/:id.
+func (h Handler) Update(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var payload updatePiggyBankPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	update := Update{
+		Title:       payload.Title,
+		Description: payload.Description,
+		TargetCents: payload.TargetCents,
+		Recurrence:  payload.Recurrence,
+	}
+	if payload.StartDate != nil {
+		startDate, err := time.Parse(time.RFC3339, *payload.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid startDate format"})
+			return
+		}
+		update.StartDate = &startDate
+	}
+	if payload.EndDate != nil {
+		endDate, err := time.Parse(time.RFC3339, *payload.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid endDate format"})
+			return
+		}
+		update.EndDate = &endDate
+	}
+	if payload.TargetDate != nil {
+		targetDate, err := time.Parse(time.RFC3339, *payload.TargetDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid targetDate format"})
+			return
+		}
+		update.TargetDate = &targetDate
+	}
+
+	pb, err := h.service.Update(c.Request.Context(), id, user.ID, update)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, mapPiggyBank(pb))
+}
+
+// Reopen handles POST /piggybanks/:id/reopen.
+func (h Handler) Reopen(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	pb, err := h.service.Reopen(c.Request.Context(), id, user.ID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, mapPiggyBank(pb))
+}
+
+// Delete handles DELETE /piggybanks/:id. It answers 202 while the deletion
+// awaits confirmation by other members.
+func (h Handler) Delete(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	deletion, err := h.service.Delete(c.Request.Context(), id, user.ID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	if !deletion.Deleted {
+		awaiting := make([]string, 0, len(deletion.Awaiting))
+		for _, userID := range deletion.Awaiting {
+			awaiting = append(awaiting, userID.String())
+		}
+		c.JSON(http.StatusAccepted, deletionResponse{Status: "pending_confirmation", AwaitingUserIDs: awaiting})
+		return
+	}
+
+	c.JSON(http.StatusOK, deletionResponse{Status: "deleted", RestorableUntil: formatTimePtr(deletion.RestorableUntil)})
+}
+
+// CancelDeletion handles DELETE /piggybanks/:id/deletion.
+func (h Handler) CancelDeletion(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.service.CancelDeletion(c.Request.Context(), id, user.ID); err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ListDeleted handles GET /piggybanks/deleted.
+func (h Handler) ListDeleted(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	piggyBanks, err := h.service.ListDeleted(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapPiggyBankViews(piggyBanks))
+}
+
+// Restore handles POST /piggybanks/:id/restore.
+func (h Handler) Restore(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.service.Restore(c.Request.Context(), id, user.ID); err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "deleted piggybank not found"})
+		default:
+			h.writeError(c, err)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h Handler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotAuthorized):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "piggybank not found"})
+	case errors.Is(err, ErrInvalidTitle), errors.Is(err, ErrInvalidDates), errors.Is(err, ErrInvalidTarget),
+		errors.Is(err, ErrInvalidMilestone), errors.Is(err, ErrInvalidRecurrence), errors.Is(err, ErrRecurringEndDate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrArchived), errors.Is(err, ErrNotClosed), errors.Is(err, ErrRolledOver):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrRestoreExpired):
+		c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
+
+func mapPiggyBank(pb PiggyBank) piggyBankResponse {
+	return piggyBankResponse{
+		ID:           pb.ID.String(),
+		CoupleID:     formatUUIDPtr(pb.CoupleID),
+		OwnerUserID:  formatUUIDPtr(pb.OwnerUserID),
+		Title:        pb.Title,
+		Description:  pb.Description,
+		StartDate:    pb.StartDate.Format(time.RFC3339),
+		EndDate:      formatTimePtr(pb.EndDate),
+		TargetCents:  pb.TargetCents,
+		TargetDate:   formatTimePtr(pb.TargetDate),
+		Recurrence:   pb.Recurrence,
+		PeriodEndsAt: formatTimePtr(pb.PeriodEndsAt),
+		SeriesID:     formatUUIDPtr(pb.SeriesID),
+		PreviousID:   formatUUIDPtr(pb.PreviousID),
+		FinalisedAt:  formatTimePtr(pb.FinalisedAt),
+		ArchivedAt:   formatTimePtr(pb.ArchivedAt),
+		DeletedAt:    formatTimePtr(pb.DeletedAt),
+		CreatedAt:    pb.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// ListSeries handles GET /piggybanks/:id/series.
+func (h Handler) ListSeries(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	piggyBanks, err := h.service.ListSeries(c.Request.Context(), id, user.ID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, mapPiggyBankViews(piggyBanks))
+}
+
+// ListMilestones handles GET /piggybanks/:id/milestones.
+func (h Handler) ListMilestones(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	milestones, err := h.service.ListMilestones(c.Request.Context(), id, user.ID)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	resp := make([]milestoneResponse, 0, len(milestones))
+	for _, m := range milestones {
+		resp = append(resp, mapMilestone(m))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// CreateMilestone handles POST /piggybanks/:id/milestones.
+func (h Handler) CreateMilestone(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var payload createMilestonePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	m, err := h.service.CreateMilestone(c.Request.Context(), id, user.ID, payload.ThresholdCents, payload.Reward, payload.Position)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, mapMilestone(m))
+}
+
+// UpdateMilestone handles PATCH /piggybanks/:id/milestones/:milestoneId.
+func (h Handler) UpdateMilestone(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	milestoneID, err := uuid.Parse(c.Param("milestoneId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid milestone id"})
+		return
+	}
+
+	var payload updateMilestonePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	m, err := h.service.UpdateMilestone(c.Request.Context(), id, milestoneID, user.ID, MilestoneUpdate{
+		ThresholdCents: payload.ThresholdCents,
+		Reward:         payload.Reward,
+		Position:       payload.Position,
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "milestone not found"})
+			return
+		}
+		h.writeError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, mapMilestone(m))
+}
+
+// DeleteMilestone handles DELETE /piggybanks/:id/milestones/:milestoneId.
+func (h Handler) DeleteMilestone(c *gin.Context) {
+	user, ok := auth.UserFromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthenticated"})
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	milestoneID, err := uuid.Parse(c.Param("milestoneId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid milestone id"})
+		return
+	}
+
+	if err := h.service.DeleteMilestone(c.Request.Context(), id, milestoneID, user.ID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "milestone not found"})
+			return
+		}
+		h.writeError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func mapMilestone(m Milestone) milestoneResponse {
+	return milestoneResponse{
+		ID:             m.ID.String(),
+		ThresholdCents: m.ThresholdCents,
+		Reward:         m.Reward,
+		Position:       m.Position,
+		Reached:        m.ReachedAt != nil,
+		ReachedAt:      formatTimePtr(m.ReachedAt),
+	}
+}
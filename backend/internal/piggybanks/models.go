@@ -1,6 +1,9 @@
 package piggybanks
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,8 +17,27 @@ type PiggyBank struct {
 	Description *string
 	StartDate   time.Time
 	EndDate     *time.Time
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
+
+	// TargetCents and TargetDate are the optional savings goal; GoalReachedAt
+	// is when the total first reached TargetCents.
+	TargetCents   *int
+	TargetDate    *time.Time
+	GoalReachedAt *time.Time
+
+	// Recurring piggybanks roll over into a new instance of their series
+	// when PeriodEndsAt passes. PreviousID links to the prior instance.
+	Recurrence   *string
+	PeriodEndsAt *time.Time
+	SeriesID     *uuid.UUID
+	PreviousID   *uuid.UUID
+
+	// FinalisedAt is when the closing summary was sent after the end date.
+	FinalisedAt *time.Time
+
+	ArchivedAt *time.Time
+	DeletedAt  *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
 }
 
 type PiggyBankView struct {
@@ -23,4 +45,355 @@ type PiggyBankView struct {
 	VoucherTemplatesCount int
 	TotalActions          int
 	TotalValue            int
+	// Location is the timezone of the piggybank's settings, in which
+	// Progress counts days. Nil means UTC.
+	Location              *time.Location
+}
+
+// Piggybank event types.
+const (
+	EventPromoted          = "promoted"
+	EventUpdated           = "updated"
+	EventClosed            = "closed"
+	EventReopened          = "reopened"
+	EventDeletionConfirmed = "deletion_confirmed"
+	EventDeletionCancelled = "deletion_cancelled"
+	EventDeleted           = "deleted"
+	EventRestored          = "restored"
+	EventGoalReached       = "goal_reached"
+	EventMilestoneReached  = "milestone_reached"
+	EventRolledOver        = "rolled_over"
+	EventFinalised         = "finalised"
+)
+
+// Event is an audit record of a change to a piggybank. UserID is the member
+// who made it, nil once their account is deleted. Details is a JSON object.
+type Event struct {
+	ID          uuid.UUID
+	PiggyBankID uuid.UUID
+	UserID      *uuid.UUID
+	EventType   string
+	Details     *string
+	CreatedAt   time.Time
+}
+
+// ClosingSummary is what a piggybank collected once it has ended: totals per
+// voucher template and per giver, and its largest action entries.
+type ClosingSummary struct {
+	TotalActions int
+	TotalValue   int
+	Templates    []TemplateTotal
+	Givers       []GiverTotal
+	TopActions   []TopAction
+}
+
+// TemplateTotal counts the action entries of a voucher template.
+type TemplateTotal struct {
+	VoucherTemplateID uuid.UUID
+	Title             string
+	Actions           int
+	Value             int
+}
+
+// GiverTotal counts the action entries given by a member; GiverUserID is nil
+// for deleted accounts.
+type GiverTotal struct {
+	GiverUserID *uuid.UUID
+	Actions     int
+	Value       int
+}
+
+// TopAction is one of the largest action entries of a piggybank.
+type TopAction struct {
+	ActionEntryID uuid.UUID
+	Title         string
+	GiverUserID   *uuid.UUID
+	AmountCents   int
+	OccurredAt    time.Time
+}
+
+// Statuses to list piggybanks by. A piggybank is closed once its end date
+// has passed, e.g. as soon as it is closed by hand.
+const (
+	StatusActive = "active"
+	StatusClosed = "closed"
+	StatusAll    = "all"
+)
+
+// Keys to sort piggybanks by. Piggybanks without an end date sort last by
+// end date.
+const (
+	SortCreatedAt = "createdAt"
+	SortStartDate = "startDate"
+	SortEndDate   = "endDate"
+	SortTitle     = "title"
+)
+
+// ListFilter selects, orders and pages the piggybanks of a user. From and To
+// keep piggybanks running at some point between them; Search matches the
+// title or description. Order is "asc" or "desc", by default descending by
+// creation and ascending by the other keys. After resumes the list past a
+// previous page.
+type ListFilter struct {
+	Status string
+	From   *time.Time
+	To     *time.Time
+	Search string
+	Sort   string
+	Order  string
+	After  *ListCursor
+	Limit  int
+
+	descending bool
+}
+
+// ListCursor is the position of a piggybank in a sorted list: the value of
+// its sort key, as text, and its id.
+type ListCursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d"`
+	Value      string    `json:"v"`
+	ID         uuid.UUID `json:"id"`
+}
+
+// Update holds the fields to change; nil fields are kept.
+type Update struct {
+	Title       *string
+	Description *string
+	StartDate   *time.Time
+	EndDate     *time.Time
+	TargetCents *int
+	TargetDate  *time.Time
+	// Recurrence set to "" stops the piggybank from recurring.
+	Recurrence *string
+}
+
+// Deletion is the outcome of a delete request. Until every member who must
+// confirm has done so, Deleted is false and Awaiting lists who is missing.
+type Deletion struct {
+	Deleted         bool
+	Awaiting        []uuid.UUID
+	RestorableUntil *time.Time
+}
+
+// Progress is how far a piggybank is from its target. RequiredPerDay and
+// RequiredPerWeek are what remains to be saved per day and per week to reach
+// the target by its deadline, the target date or else the end date; they are
+// nil without a deadline or once it has passed.
+type Progress struct {
+	TargetCents     int
+	TotalValue      int
+	Percent         int
+	RemainingCents  int
+	Deadline        *time.Time
+	RequiredPerDay  *int
+	RequiredPerWeek *int
+	ReachedAt       *time.Time
+}
+
+// Progress returns the progress of the piggybank towards its target as of
+// now, nil without a target. Percent is not capped at 100. Days are counted
+// in the piggybank's Location.
+func (v PiggyBankView) Progress(now time.Time) *Progress {
+	pb := v.PiggyBank
+	if pb.TargetCents == nil || *pb.TargetCents <= 0 {
+		return nil
+	}
+
+	p := &Progress{
+		TargetCents: *pb.TargetCents,
+		TotalValue:  v.TotalValue,
+		Percent:     v.TotalValue * 100 / *pb.TargetCents,
+		ReachedAt:   pb.GoalReachedAt,
+	}
+	if v.TotalValue < p.TargetCents {
+		p.RemainingCents = p.TargetCents - v.TotalValue
+	}
+
+	p.Deadline = pb.TargetDate
+	if p.Deadline == nil {
+		p.Deadline = pb.EndDate
+	}
+	if p.Deadline == nil {
+		return p
+	}
+
+	// Deadlines are dates: the deadline's day counts as a day left.
+	loc := v.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	days := int(localDay(*p.Deadline, loc).Sub(localDay(now, loc)).Hours()/24) + 1
+	if days <= 0 {
+		return p
+	}
+
+	perDay := ceilDiv(p.RemainingCents, days)
+	perWeek := ceilDiv(p.RemainingCents*7, days)
+	if perWeek > p.RemainingCents {
+		perWeek = p.RemainingCents
+	}
+	p.RequiredPerDay = &perDay
+	p.RequiredPerWeek = &perWeek
+	return p
+}
+
+// localDay returns the calendar day of t in loc, as midnight UTC so that days
+// can be subtracted without daylight saving changes getting in the way.
+func localDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func ceilDiv(a, b int) int {
+	return (a + b - 1) / b
+}
+
+// Milestone is an intermediate goal of a piggybank. ReachedAt is when the
+// action entry that brought the total to ThresholdCents occurred.
+type Milestone struct {
+	ID             uuid.UUID
+	PiggyBankID    uuid.UUID
+	ThresholdCents int
+	Reward         *string
+	Position       int
+	ReachedAt      *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// MilestoneUpdate holds the fields to change; nil fields are kept.
+type MilestoneUpdate struct {
+	ThresholdCents *int
+	Reward         *string
+	Position       *int
+}
+
+// Recurrence frequencies.
+const (
+	FreqDaily   = "DAILY"
+	FreqWeekly  = "WEEKLY"
+	FreqMonthly = "MONTHLY"
+)
+
+var rruleWeekdays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Recurrence is the subset of RFC 5545 rules piggybanks recur on: FREQ of
+// DAILY, WEEKLY or MONTHLY, INTERVAL, BYDAY with a single weekday for weekly
+// rules and BYMONTHDAY from 1 to 28 for monthly ones. Periods begin at local
+// midnight.
+type Recurrence struct {
+	Freq     string
+	Interval int
+	Weekday  time.Weekday
+	MonthDay int
+}
+
+// ParseRecurrence parses "daily", "weekly", "monthly" or an RRULE such as
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO". Weekly rules without BYDAY begin on
+// weekStart, monthly ones without BYMONTHDAY on the 1st.
+func ParseRecurrence(rule string, weekStart time.Weekday) (Recurrence, error) {
+	rule = strings.TrimSpace(rule)
+	switch strings.ToLower(rule) {
+	case "daily":
+		return Recurrence{Freq: FreqDaily, Interval: 1}, nil
+	case "weekly":
+		return Recurrence{Freq: FreqWeekly, Interval: 1, Weekday: weekStart}, nil
+	case "monthly":
+		return Recurrence{Freq: FreqMonthly, Interval: 1, MonthDay: 1}, nil
+	}
+
+	r := Recurrence{Interval: 1, Weekday: weekStart, MonthDay: 1}
+	byDay, byMonthDay := false, false
+	rule = strings.TrimPrefix(strings.ToUpper(rule), "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Recurrence{}, ErrInvalidRecurrence
+		}
+		switch key {
+		case "FREQ":
+			if value != FreqDaily && value != FreqWeekly && value != FreqMonthly {
+				return Recurrence{}, ErrInvalidRecurrence
+			}
+			r.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 52 {
+				return Recurrence{}, ErrInvalidRecurrence
+			}
+			r.Interval = n
+		case "BYDAY":
+			day := -1
+			for i, code := range rruleWeekdays {
+				if value == code {
+					day = i
+				}
+			}
+			if day < 0 {
+				return Recurrence{}, ErrInvalidRecurrence
+			}
+			r.Weekday = time.Weekday(day)
+			byDay = true
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 28 {
+				return Recurrence{}, ErrInvalidRecurrence
+			}
+			r.MonthDay = n
+			byMonthDay = true
+		default:
+			return Recurrence{}, ErrInvalidRecurrence
+		}
+	}
+	if r.Freq == "" || (byDay && r.Freq != FreqWeekly) || (byMonthDay && r.Freq != FreqMonthly) {
+		return Recurrence{}, ErrInvalidRecurrence
+	}
+	return r, nil
+}
+
+// String returns the rule in RRULE form.
+func (r Recurrence) String() string {
+	switch r.Freq {
+	case FreqWeekly:
+		return fmt.Sprintf("FREQ=WEEKLY;INTERVAL=%d;BYDAY=%s", r.Interval, rruleWeekdays[r.Weekday])
+	case FreqMonthly:
+		return fmt.Sprintf("FREQ=MONTHLY;INTERVAL=%d;BYMONTHDAY=%d", r.Interval, r.MonthDay)
+	default:
+		return fmt.Sprintf("FREQ=DAILY;INTERVAL=%d", r.Interval)
+	}
+}
+
+// Next returns the local midnight in loc on which the period containing t
+// ends and the next one begins.
+func (r Recurrence) Next(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	switch r.Freq {
+	case FreqWeekly:
+		ahead := (int(r.Weekday) - int(day.Weekday()) + 7) % 7
+		if ahead == 0 {
+			ahead = 7
+		}
+		return day.AddDate(0, 0, ahead+7*(r.Interval-1))
+	case FreqMonthly:
+		next := time.Date(day.Year(), day.Month(), r.MonthDay, 0, 0, 0, 0, loc)
+		if !next.After(day) {
+			next = next.AddDate(0, 1, 0)
+		}
+		return next.AddDate(0, r.Interval-1, 0)
+	default:
+		return day.AddDate(0, 0, r.Interval)
+	}
+}
+
+// periodEnd returns the end of the period of r containing now for a
+// piggybank starting on start.
+func (r Recurrence) periodEnd(start, now time.Time, loc *time.Location) time.Time {
+	end := r.Next(start, loc)
+	for !end.After(now) {
+		end = r.Next(end, loc)
+	}
+	return end
 }
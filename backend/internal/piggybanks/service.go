@@ -2,42 +2,94 @@ package piggybanks
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
-	"github.com/piggybank/backend/internal/couples"
+	"github.com/piggybank/backend/internal/common/email"
+	"github.com/piggybank/backend/internal/common/jobs"
+	"github.com/piggybank/backend/internal/households"
+	"github.com/piggybank/backend/internal/settings"
+	"github.com/piggybank/backend/internal/users"
 )
 
 var (
-	ErrNotAuthorized = errors.New("not authorized to access this piggybank")
+	ErrNotAuthorized     = errors.New("not authorized to access this piggybank")
+	ErrArchived          = errors.New("piggybank is archived and read-only")
+	ErrNoHousehold       = errors.New("join a couple or household before promoting piggybanks")
+	ErrNoPiggyBanks      = errors.New("no piggybanks given")
+	ErrInvalidTitle      = errors.New("title is required")
+	ErrInvalidDates      = errors.New("endDate must not be before startDate")
+	ErrInvalidTarget     = errors.New("targetCents must be positive")
+	ErrInvalidMilestone  = errors.New("thresholdCents must be positive and position not negative")
+	ErrInvalidRecurrence = errors.New("recurrence must be daily, weekly, monthly or an RRULE with FREQ, INTERVAL, BYDAY or BYMONTHDAY")
+	ErrRecurringEndDate  = errors.New("recurring piggybanks end with each period and take no endDate")
+	ErrNotClosed         = errors.New("piggybank is not closed")
+	ErrRolledOver        = errors.New("piggybank has rolled over to a new period")
+	ErrRestoreExpired    = errors.New("piggybank can no longer be restored")
+	ErrInvalidStatus     = errors.New("status must be active, closed or all")
+	ErrInvalidSort       = errors.New("sort must be createdAt, startDate, endDate or title")
+	ErrInvalidOrder      = errors.New("order must be asc or desc")
+	ErrInvalidCursor     = errors.New("cursor is invalid for this sort order")
+)
+
+const (
+	// DeletionConfirmationTTL is how long a member's confirmation of a
+	// deletion waits for the others.
+	DeletionConfirmationTTL = 7 * 24 * time.Hour
+	// RestoreWindow is how long a deleted piggybank can be restored before
+	// it is purged.
+	RestoreWindow = 30 * 24 * time.Hour
+
+	// Page sizes of ListByUser.
+	DefaultListLimit = 50
+	MaxListLimit     = 100
 )
 
 type Service struct {
-	store   Store
-	couples couples.Store
+	store       Store
+	households  households.Store
+	users       users.Repository
+	emailSender *email.Service
+	settings    settings.Service
 }
 
-func NewService(store Store, couplesStore couples.Store) Service {
-	return Service{store: store, couples: couplesStore}
+// NewService constructs a Service. Without an email sender piggybanks are
+// finalised without sending their closing summary.
+func NewService(store Store, householdsStore households.Store, usersRepo users.Repository, emailSender *email.Service, settingsService settings.Service) Service {
+	return Service{store: store, households: householdsStore, users: usersRepo, emailSender: emailSender, settings: settingsService}
 }
 
-func (s Service) Create(ctx context.Context, userID uuid.UUID, title string, description *string, startDate time.Time, endDate *time.Time) (PiggyBank, error) {
+func (s Service) Create(ctx context.Context, userID uuid.UUID, title string, description *string, startDate time.Time, endDate *time.Time, targetCents *int, targetDate *time.Time, recurrence *string) (PiggyBank, error) {
+	if targetCents != nil && *targetCents <= 0 {
+		return PiggyBank{}, ErrInvalidTarget
+	}
+	if recurrence != nil && endDate != nil {
+		return PiggyBank{}, ErrRecurringEndDate
+	}
+
 	var coupleID *uuid.UUID
 	var ownerUserID *uuid.UUID
 
-	couple, err := s.couples.GetCoupleByUserID(ctx, userID)
+	membership, err := s.households.GetActiveMembership(ctx, userID)
 	if err != nil {
-		if errors.Is(err, couples.ErrNotFound) {
+		if errors.Is(err, households.ErrNotFound) {
 			// Solo mode
 			ownerUserID = &userID
 		} else {
 			return PiggyBank{}, err
 		}
 	} else {
-		// Couple mode
-		coupleID = &couple.ID
+		// Household mode, couples included
+		if membership.Role == households.RoleChild {
+			return PiggyBank{}, ErrNotAuthorized
+		}
+		coupleID = &membership.HouseholdID
 	}
 
 	now := time.Now().UTC()
@@ -49,9 +101,16 @@ func (s Service) Create(ctx context.Context, userID uuid.UUID, title string, des
 		Description: description,
 		StartDate:   startDate,
 		EndDate:     endDate,
+		TargetCents: targetCents,
+		TargetDate:  targetDate,
 		CreatedAt:   now,
 		UpdatedAt:   now,
 	}
+	if recurrence != nil {
+		if err := s.setRecurrence(ctx, &pb, *recurrence, now); err != nil {
+			return PiggyBank{}, err
+		}
+	}
 
 	if err := s.store.Create(ctx, pb); err != nil {
 		return PiggyBank{}, err
@@ -60,26 +119,812 @@ func (s Service) Create(ctx context.Context, userID uuid.UUID, title string, des
 	return pb, nil
 }
 
-func (s Service) ListByUser(ctx context.Context, userID uuid.UUID) ([]PiggyBankView, error) {
-	return s.store.ListByUserID(ctx, userID)
+// ListByUser returns a page of the piggybanks a user can access, active ones
+// by default, newest first, and the cursor of the next page, "" on the last.
+func (s Service) ListByUser(ctx context.Context, userID uuid.UUID, filter ListFilter) ([]PiggyBankView, string, error) {
+	if filter.Status == "" {
+		filter.Status = StatusActive
+	}
+	if filter.Status != StatusActive && filter.Status != StatusClosed && filter.Status != StatusAll {
+		return nil, "", ErrInvalidStatus
+	}
+	if filter.Sort == "" {
+		filter.Sort = SortCreatedAt
+	}
+	if _, ok := sortKeys[filter.Sort]; !ok {
+		return nil, "", ErrInvalidSort
+	}
+	switch filter.Order {
+	case "":
+		filter.descending = filter.Sort == SortCreatedAt
+	case "asc":
+	case "desc":
+		filter.descending = true
+	default:
+		return nil, "", ErrInvalidOrder
+	}
+	if filter.After != nil && (filter.After.Sort != filter.Sort || filter.After.Descending != filter.descending) {
+		return nil, "", ErrInvalidCursor
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultListLimit
+	}
+	if filter.Limit > MaxListLimit {
+		filter.Limit = MaxListLimit
+	}
+	filter.Search = strings.TrimSpace(filter.Search)
+
+	limit := filter.Limit
+	filter.Limit++
+	piggyBanks, err := s.store.ListByUserID(ctx, userID, filter, time.Now().UTC())
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.localise(ctx, piggyBanks); err != nil {
+		return nil, "", err
+	}
+	if len(piggyBanks) <= limit {
+		return piggyBanks, "", nil
+	}
+
+	piggyBanks = piggyBanks[:limit]
+	last := piggyBanks[limit-1].PiggyBank
+	next, err := EncodeCursor(ListCursor{
+		Sort:       filter.Sort,
+		Descending: filter.descending,
+		Value:      sortValue(last, filter.Sort),
+		ID:         last.ID,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return piggyBanks, next, nil
+}
+
+// EncodeCursor returns the opaque form of a list cursor.
+func EncodeCursor(cursor ListCursor) (string, error) {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCursor parses a cursor returned by ListByUser. Its value must be a
+// timestamp when sorting by a date, as the store compares it as one.
+func DecodeCursor(encoded string) (ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ListCursor{}, ErrInvalidCursor
+	}
+	var cursor ListCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return ListCursor{}, ErrInvalidCursor
+	}
+	switch cursor.Sort {
+	case SortTitle:
+	case SortEndDate:
+		if cursor.Value == "infinity" {
+			break
+		}
+		fallthrough
+	case SortCreatedAt, SortStartDate:
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+			return ListCursor{}, ErrInvalidCursor
+		}
+	default:
+		return ListCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func sortValue(pb PiggyBank, sort string) string {
+	switch sort {
+	case SortStartDate:
+		return pb.StartDate.Format(time.RFC3339Nano)
+	case SortEndDate:
+		if pb.EndDate == nil {
+			return "infinity"
+		}
+		return pb.EndDate.Format(time.RFC3339Nano)
+	case SortTitle:
+		return pb.Title
+	default:
+		return pb.CreatedAt.Format(time.RFC3339Nano)
+	}
 }
 
-func (s Service) GetByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (PiggyBank, error) {
-	return s.store.GetByIDForUser(ctx, id, userID)
+func (s Service) GetByID(ctx context.Context, id uuid.UUID, userID uuid.UUID) (PiggyBankView, error) {
+	pbv, err := s.store.GetViewByIDForUser(ctx, id, userID)
+	if err != nil {
+		return PiggyBankView{}, err
+	}
+	views := []PiggyBankView{pbv}
+	if err := s.localise(ctx, views); err != nil {
+		return PiggyBankView{}, err
+	}
+	return views[0], nil
+}
+
+// localise sets the Location of each view to the timezone of the settings
+// applying to its piggybank.
+func (s Service) localise(ctx context.Context, views []PiggyBankView) error {
+	locations := map[string]*time.Location{}
+	for i := range views {
+		pb := views[i].PiggyBank
+		key := ""
+		switch {
+		case pb.CoupleID != nil:
+			key = "household:" + pb.CoupleID.String()
+		case pb.OwnerUserID != nil:
+			key = "user:" + pb.OwnerUserID.String()
+		}
+
+		loc, ok := locations[key]
+		if !ok {
+			st, err := s.settings.ForPiggyBank(ctx, pb.CoupleID, pb.OwnerUserID)
+			if err != nil {
+				return err
+			}
+			loc = st.Location()
+			locations[key] = loc
+		}
+		views[i].Location = loc
+	}
+	return nil
 }
 
 func (s Service) Close(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	pb, err := s.manageable(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	pb.EndDate = &now
+	pb.UpdatedAt = now
+
+	return s.store.Save(ctx, pb, userID, EventClosed, "")
+}
+
+// Update changes the title, description or dates of a piggybank.
+func (s Service) Update(ctx context.Context, id uuid.UUID, userID uuid.UUID, update Update) (PiggyBank, error) {
+	pb, err := s.manageable(ctx, id, userID)
+	if err != nil {
+		return PiggyBank{}, err
+	}
+
+	var fields []string
+	if update.Title != nil {
+		title := strings.TrimSpace(*update.Title)
+		if title == "" {
+			return PiggyBank{}, ErrInvalidTitle
+		}
+		pb.Title = title
+		fields = append(fields, "title")
+	}
+	if update.Description != nil {
+		pb.Description = update.Description
+		fields = append(fields, "description")
+	}
+	if update.StartDate != nil {
+		pb.StartDate = *update.StartDate
+		fields = append(fields, "startDate")
+	}
+	if update.EndDate != nil {
+		pb.EndDate = update.EndDate
+		fields = append(fields, "endDate")
+	}
+	if update.Recurrence != nil {
+		if *update.Recurrence == "" {
+			pb.Recurrence = nil
+			pb.PeriodEndsAt = nil
+		} else if err := s.setRecurrence(ctx, &pb, *update.Recurrence, time.Now().UTC()); err != nil {
+			return PiggyBank{}, err
+		}
+		fields = append(fields, "recurrence")
+	}
+	if update.TargetDate != nil {
+		pb.TargetDate = update.TargetDate
+		fields = append(fields, "targetDate")
+	}
+	previousTarget := pb.TargetCents
+	if update.TargetCents != nil {
+		switch {
+		case *update.TargetCents < 0:
+			return PiggyBank{}, ErrInvalidTarget
+		case *update.TargetCents == 0:
+			// Zero removes the target along with its date.
+			pb.TargetCents = nil
+			pb.TargetDate = nil
+		default:
+			pb.TargetCents = update.TargetCents
+		}
+		fields = append(fields, "targetCents")
+	}
+	if len(fields) == 0 {
+		return pb, nil
+	}
+	if pb.EndDate != nil && pb.EndDate.Before(pb.StartDate) {
+		return PiggyBank{}, ErrInvalidDates
+	}
+	if pb.EndDate != nil && pb.Recurrence != nil {
+		return PiggyBank{}, ErrRecurringEndDate
+	}
+
+	details, err := json.Marshal(map[string][]string{"fields": fields})
+	if err != nil {
+		return PiggyBank{}, err
+	}
+
+	pb.UpdatedAt = time.Now().UTC()
+	if err := s.store.Save(ctx, pb, userID, EventUpdated, string(details)); err != nil {
+		return PiggyBank{}, err
+	}
+
+	if !sameTarget(previousTarget, pb.TargetCents) {
+		// Save cleared when the goal was reached; the new target may
+		// already be met.
+		pb.GoalReachedAt = nil
+		reached, err := s.store.MarkGoalReached(ctx, pb.ID, userID, pb.UpdatedAt)
+		if err != nil {
+			return PiggyBank{}, err
+		}
+		if reached {
+			pb.GoalReachedAt = &pb.UpdatedAt
+		}
+	}
+	return pb, nil
+}
+
+// Reopen clears the end date of a closed piggybank. A period of a recurring
+// piggybank that rolled over stays closed, as its successor carries on.
+func (s Service) Reopen(ctx context.Context, id uuid.UUID, userID uuid.UUID) (PiggyBank, error) {
+	pb, err := s.manageable(ctx, id, userID)
+	if err != nil {
+		return PiggyBank{}, err
+	}
+	if pb.EndDate == nil {
+		return PiggyBank{}, ErrNotClosed
+	}
+	rolledOver, err := s.store.HasSuccessor(ctx, pb.ID)
+	if err != nil {
+		return PiggyBank{}, err
+	}
+	if rolledOver {
+		return PiggyBank{}, ErrRolledOver
+	}
+
+	pb.EndDate = nil
+	pb.UpdatedAt = time.Now().UTC()
+	if err := s.store.Save(ctx, pb, userID, EventReopened, ""); err != nil {
+		return PiggyBank{}, err
+	}
+	return pb, nil
+}
+
+// Delete confirms the deletion of a piggybank on behalf of userID. Solo
+// piggybanks are deleted at once; those of a household only once every owner
+// and adult, i.e. both partners of a couple, has confirmed within
+// DeletionConfirmationTTL. Deleted piggybanks can be restored during
+// RestoreWindow.
+func (s Service) Delete(ctx context.Context, id uuid.UUID, userID uuid.UUID) (Deletion, error) {
+	pb, err := s.manageable(ctx, id, userID)
+	if err != nil {
+		return Deletion{}, err
+	}
+
+	approvers := []uuid.UUID{userID}
+	if pb.CoupleID != nil {
+		members, err := s.households.ListActiveMembers(ctx, *pb.CoupleID)
+		if err != nil {
+			return Deletion{}, err
+		}
+		approvers = approvers[:0]
+		for _, m := range members {
+			if m.Role != households.RoleChild {
+				approvers = append(approvers, m.UserID)
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	awaiting, err := s.store.ConfirmDeletion(ctx, id, userID, approvers, now.Add(-DeletionConfirmationTTL), now)
+	if err != nil {
+		return Deletion{}, err
+	}
+	if len(awaiting) > 0 {
+		return Deletion{Awaiting: awaiting}, nil
+	}
+
+	restorableUntil := now.Add(RestoreWindow)
+	return Deletion{Deleted: true, RestorableUntil: &restorableUntil}, nil
+}
+
+// CancelDeletion withdraws a pending deletion, whoever confirmed it.
+func (s Service) CancelDeletion(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	if _, err := s.manageable(ctx, id, userID); err != nil {
+		return err
+	}
+	_, err := s.store.CancelDeletion(ctx, id, userID, time.Now().UTC())
+	return err
+}
+
+// ListDeleted returns the deleted piggybanks a user can still restore.
+func (s Service) ListDeleted(ctx context.Context, userID uuid.UUID) ([]PiggyBankView, error) {
+	views, err := s.store.ListDeletedByUserID(ctx, userID, time.Now().UTC().Add(-RestoreWindow))
+	if err != nil {
+		return nil, err
+	}
+	return views, s.localise(ctx, views)
+}
+
+// Restore undeletes a piggybank within RestoreWindow. Restoring needs no
+// confirmation.
+func (s Service) Restore(ctx context.Context, id uuid.UUID, userID uuid.UUID) error {
+	pb, err := s.store.GetDeletedByIDForUser(ctx, id, userID)
+	if err != nil {
+		return err
+	}
+
+	canManage, err := s.store.CanManage(ctx, pb, userID)
+	if err != nil {
+		return err
+	}
+	if !canManage {
+		return ErrNotAuthorized
+	}
+
+	now := time.Now().UTC()
+	since := now.Add(-RestoreWindow)
+	if pb.DeletedAt.Before(since) {
+		return ErrRestoreExpired
+	}
+
+	if err := s.store.Restore(ctx, id, userID, since, now); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ErrRestoreExpired
+		}
+		return err
+	}
+	return nil
+}
+
+// PurgeDeleted permanently removes piggybanks deleted more than RestoreWindow
+// ago.
+func (s Service) PurgeDeleted(ctx context.Context) (int64, error) {
+	return s.store.PurgeDeleted(ctx, time.Now().UTC().Add(-RestoreWindow))
+}
+
+// RunPurger purges deleted piggybanks every interval until ctx is done. The
+// delete is idempotent, so every replica may run it.
+func (s Service) RunPurger(ctx context.Context, interval time.Duration) {
+	jobs.Every(ctx, interval, "piggybank purge", func(ctx context.Context) (int, error) {
+		n, err := s.PurgeDeleted(ctx)
+		return int(n), err
+	})
+}
+
+// manageable returns a piggybank userID may change: accessible, neither
+// archived nor deleted, and not as a child of its household.
+func (s Service) manageable(ctx context.Context, id uuid.UUID, userID uuid.UUID) (PiggyBank, error) {
 	pb, err := s.store.GetByIDForUser(ctx, id, userID)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
-			return ErrNotAuthorized // Or ErrNotFound, but keeping consistent with GetByID
+			return PiggyBank{}, ErrNotAuthorized // Or ErrNotFound, but keeping consistent with GetByID
+		}
+		return PiggyBank{}, err
+	}
+
+	if pb.ArchivedAt != nil {
+		return PiggyBank{}, ErrArchived
+	}
+
+	canManage, err := s.store.CanManage(ctx, pb, userID)
+	if err != nil {
+		return PiggyBank{}, err
+	}
+	if !canManage {
+		return PiggyBank{}, ErrNotAuthorized
+	}
+	return pb, nil
+}
+
+// setRecurrence makes pb recur on rule, starting or continuing its series,
+// with the current period ending at the next boundary in the timezone of
+// its settings.
+func (s Service) setRecurrence(ctx context.Context, pb *PiggyBank, rule string, now time.Time) error {
+	st, err := s.settings.ForPiggyBank(ctx, pb.CoupleID, pb.OwnerUserID)
+	if err != nil {
+		return err
+	}
+	r, err := ParseRecurrence(rule, st.WeekStart)
+	if err != nil {
+		return err
+	}
+
+	normalized := r.String()
+	periodEnd := r.periodEnd(pb.StartDate, now, st.Location())
+	pb.Recurrence = &normalized
+	pb.PeriodEndsAt = &periodEnd
+	if pb.SeriesID == nil {
+		pb.SeriesID = &pb.ID
+	}
+	return nil
+}
+
+// ListSeries returns every period of the series a piggybank belongs to,
+// oldest first, with its totals. A piggybank that never recurred is a
+// series of its own.
+func (s Service) ListSeries(ctx context.Context, id uuid.UUID, userID uuid.UUID) ([]PiggyBankView, error) {
+	pbv, err := s.store.GetViewByIDForUser(ctx, id, userID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotAuthorized
+		}
+		return nil, err
+	}
+	views := []PiggyBankView{pbv}
+	if pbv.PiggyBank.SeriesID != nil {
+		views, err = s.store.ListSeries(ctx, *pbv.PiggyBank.SeriesID, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return views, s.localise(ctx, views)
+}
+
+// RollOverDue closes recurring piggybanks whose period has ended and opens
+// the next period of each with the same title, description, target and
+// voucher templates. Periods missed while the job was not running are
+// rolled over one after the other. It returns how many periods it closed.
+func (s Service) RollOverDue(ctx context.Context) (int, error) {
+	rolled := 0
+	for {
+		now := time.Now().UTC()
+		due, err := s.store.ListDueRecurring(ctx, now, 100)
+		if err != nil {
+			return rolled, err
+		}
+		if len(due) == 0 {
+			return rolled, nil
+		}
+
+		for _, pb := range due {
+			if err := s.rollOver(ctx, pb, now); err != nil {
+				if errors.Is(err, ErrNotFound) {
+					// Another replica got there first.
+					continue
+				}
+				return rolled, err
+			}
+			rolled++
+		}
+	}
+}
+
+func (s Service) rollOver(ctx context.Context, pb PiggyBank, now time.Time) error {
+	st, err := s.settings.ForPiggyBank(ctx, pb.CoupleID, pb.OwnerUserID)
+	if err != nil {
+		return err
+	}
+	r, err := ParseRecurrence(*pb.Recurrence, st.WeekStart)
+	if err != nil {
+		return err
+	}
+
+	loc := st.Location()
+	start := pb.PeriodEndsAt.In(loc)
+	periodEnd := r.Next(start, loc)
+	pb.EndDate = &start
+
+	next := PiggyBank{
+		ID:           uuid.New(),
+		CoupleID:     pb.CoupleID,
+		OwnerUserID:  pb.OwnerUserID,
+		Title:        pb.Title,
+		Description:  pb.Description,
+		StartDate:    start,
+		TargetCents:  pb.TargetCents,
+		Recurrence:   pb.Recurrence,
+		PeriodEndsAt: &periodEnd,
+		SeriesID:     pb.SeriesID,
+		PreviousID:   &pb.ID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return s.store.RollOver(ctx, pb, next)
+}
+
+// RunRollover rolls recurring piggybanks over every interval until ctx is
+// done. Each rollover is conditional on the period still being open, so
+// every replica may run it.
+func (s Service) RunRollover(ctx context.Context, interval time.Duration) {
+	jobs.Every(ctx, interval, "piggybank rollover", s.RollOverDue)
+}
+
+// FinaliseDue finalises the piggybanks whose end date has passed: each is
+// marked finalised and then its closing summary is emailed to its owner and
+// adults, i.e. both partners of a couple. Summaries are sent only once the
+// finalisation is committed, so that no member is sent one twice; one that
+// fails to send is logged and not retried. It returns how many piggybanks it
+// finalised.
+func (s Service) FinaliseDue(ctx context.Context) (int, error) {
+	finalised := 0
+	for {
+		pb, summary, ok, err := s.store.FinaliseNext(ctx, time.Now().UTC())
+		if err != nil {
+			return finalised, err
+		}
+		if !ok {
+			return finalised, nil
+		}
+		finalised++
+
+		if err := s.sendClosingSummary(ctx, pb, summary); err != nil {
+			log.Printf("failed to send closing summary of piggybank %s: %v", pb.ID, err)
+		}
+	}
+}
+
+// sendClosingSummary emails summary to the members of pb who manage it.
+func (s Service) sendClosingSummary(ctx context.Context, pb PiggyBank, summary ClosingSummary) error {
+	if s.emailSender == nil {
+		return nil
+	}
+
+	var recipients []uuid.UUID
+	if pb.CoupleID != nil {
+		members, err := s.households.ListActiveMembers(ctx, *pb.CoupleID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			if m.Role != households.RoleChild {
+				recipients = append(recipients, m.UserID)
+			}
 		}
+	} else if pb.OwnerUserID != nil {
+		recipients = append(recipients, *pb.OwnerUserID)
+	}
+
+	st, err := s.settings.ForPiggyBank(ctx, pb.CoupleID, pb.OwnerUserID)
+	if err != nil {
 		return err
 	}
 
+	names := map[uuid.UUID]string{}
+	name := func(id *uuid.UUID) string {
+		if id == nil {
+			return "A former member"
+		}
+		if n, ok := names[*id]; ok {
+			return n
+		}
+		n := "A former member"
+		if u, err := s.users.GetByID(ctx, *id); err == nil {
+			n = u.Name
+		}
+		names[*id] = n
+		return n
+	}
+
+	endDate := pb.StartDate
+	if pb.EndDate != nil {
+		endDate = *pb.EndDate
+	}
+	closing := email.ClosingSummary{
+		Title:        pb.Title,
+		StartDate:    pb.StartDate,
+		EndDate:      endDate,
+		TotalActions: summary.TotalActions,
+		TotalValue:   summary.TotalValue,
+	}
+	for _, t := range summary.Templates {
+		closing.Templates = append(closing.Templates, email.SummaryTotal{Name: t.Title, Actions: t.Actions, Value: t.Value})
+	}
+	gave := map[uuid.UUID]bool{}
+	for _, g := range summary.Givers {
+		closing.Partners = append(closing.Partners, email.SummaryTotal{Name: name(g.GiverUserID), Actions: g.Actions, Value: g.Value})
+		if g.GiverUserID != nil {
+			gave[*g.GiverUserID] = true
+		}
+	}
+	for _, id := range recipients {
+		if !gave[id] {
+			id := id
+			closing.Partners = append(closing.Partners, email.SummaryTotal{Name: name(&id)})
+		}
+	}
+	for _, a := range summary.TopActions {
+		closing.TopActions = append(closing.TopActions, email.SummaryAction{
+			Title:       a.Title,
+			GiverName:   name(a.GiverUserID),
+			AmountCents: a.AmountCents,
+			OccurredAt:  a.OccurredAt,
+		})
+	}
+
+	for _, id := range recipients {
+		u, err := s.users.GetByID(ctx, id)
+		if err != nil {
+			if errors.Is(err, users.ErrNotFound) {
+				continue
+			}
+			return err
+		}
+		if err := s.emailSender.SendClosingSummary(u.Email, u.Name, closing, st.Formatting()); err != nil {
+			log.Printf("failed to send closing summary of piggybank %s to %s: %v", pb.ID, u.Email, err)
+		}
+	}
+	return nil
+}
+
+// RunFinaliser finalises ended piggybanks every interval until ctx is done.
+// Replicas running it at the same time finalise different piggybanks.
+func (s Service) RunFinaliser(ctx context.Context, interval time.Duration) {
+	jobs.Every(ctx, interval, "piggybank finalisation", s.FinaliseDue)
+}
+
+// ListSolo returns the solo piggybanks of a user, e.g. to choose which ones
+// to share after pairing.
+func (s Service) ListSolo(ctx context.Context, userID uuid.UUID) ([]PiggyBankView, error) {
+	views, err := s.store.ListSoloByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return views, s.localise(ctx, views)
+}
+
+// Promote moves solo piggybanks of userID into their couple or household.
+// It returns ErrNotFound, promoting none, if any of them is not a solo
+// piggybank of the user.
+func (s Service) Promote(ctx context.Context, userID uuid.UUID, ids []uuid.UUID) error {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) == 0 {
+		return ErrNoPiggyBanks
+	}
+
+	membership, err := s.households.GetActiveMembership(ctx, userID)
+	if err != nil {
+		if errors.Is(err, households.ErrNotFound) {
+			return ErrNoHousehold
+		}
+		return err
+	}
+	if membership.Role == households.RoleChild {
+		return ErrNotAuthorized
+	}
+
+	return s.store.Promote(ctx, userID, membership.HouseholdID, unique, time.Now().UTC())
+}
+
+// ListMilestones returns the milestones of a piggybank the user can access.
+func (s Service) ListMilestones(ctx context.Context, id uuid.UUID, userID uuid.UUID) ([]Milestone, error) {
+	if _, err := s.store.GetByIDForUser(ctx, id, userID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotAuthorized
+		}
+		return nil, err
+	}
+	return s.store.ListMilestones(ctx, id)
+}
+
+// CreateMilestone adds a milestone to a piggybank, after the others unless
+// position is given. It is marked reached at once if the total already
+// reaches it.
+func (s Service) CreateMilestone(ctx context.Context, id uuid.UUID, userID uuid.UUID, thresholdCents int, reward *string, position *int) (Milestone, error) {
+	if _, err := s.manageable(ctx, id, userID); err != nil {
+		return Milestone{}, err
+	}
+	if thresholdCents <= 0 || (position != nil && *position < 0) {
+		return Milestone{}, ErrInvalidMilestone
+	}
+
 	now := time.Now().UTC()
-	pb.EndDate = &now
-	pb.UpdatedAt = now
+	m := Milestone{
+		ID:             uuid.New(),
+		PiggyBankID:    id,
+		ThresholdCents: thresholdCents,
+		Reward:         reward,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := s.store.CreateMilestone(ctx, &m, position); err != nil {
+		return Milestone{}, err
+	}
 
-	return s.store.Update(ctx, pb)
+	return s.refreshMilestone(ctx, m, userID, now)
+}
+
+// UpdateMilestone changes the threshold, reward or position of a milestone.
+// A new threshold is checked against the total again.
+func (s Service) UpdateMilestone(ctx context.Context, id, milestoneID uuid.UUID, userID uuid.UUID, update MilestoneUpdate) (Milestone, error) {
+	if _, err := s.manageable(ctx, id, userID); err != nil {
+		return Milestone{}, err
+	}
+
+	m, err := s.store.GetMilestone(ctx, id, milestoneID)
+	if err != nil {
+		return Milestone{}, err
+	}
+
+	if update.ThresholdCents != nil {
+		if *update.ThresholdCents <= 0 {
+			return Milestone{}, ErrInvalidMilestone
+		}
+		if *update.ThresholdCents != m.ThresholdCents {
+			m.ReachedAt = nil
+		}
+		m.ThresholdCents = *update.ThresholdCents
+	}
+	if update.Reward != nil {
+		m.Reward = update.Reward
+	}
+	if update.Position != nil {
+		if *update.Position < 0 {
+			return Milestone{}, ErrInvalidMilestone
+		}
+		m.Position = *update.Position
+	}
+
+	now := time.Now().UTC()
+	m.UpdatedAt = now
+	if err := s.store.UpdateMilestone(ctx, m); err != nil {
+		return Milestone{}, err
+	}
+
+	return s.refreshMilestone(ctx, m, userID, now)
+}
+
+// DeleteMilestone removes a milestone from a piggybank.
+func (s Service) DeleteMilestone(ctx context.Context, id, milestoneID uuid.UUID, userID uuid.UUID) error {
+	if _, err := s.manageable(ctx, id, userID); err != nil {
+		return err
+	}
+	return s.store.DeleteMilestone(ctx, id, milestoneID)
+}
+
+// refreshMilestone marks the milestones of m's piggybank the total reaches
+// and returns m as it now stands.
+func (s Service) refreshMilestone(ctx context.Context, m Milestone, userID uuid.UUID, at time.Time) (Milestone, error) {
+	if m.ReachedAt != nil {
+		return m, nil
+	}
+
+	reached, err := s.store.MarkMilestonesReached(ctx, m.PiggyBankID, userID, at)
+	if err != nil {
+		return Milestone{}, err
+	}
+	for _, r := range reached {
+		if r.ID == m.ID {
+			return r, nil
+		}
+	}
+	return m, nil
+}
+
+// ListEvents returns the audit trail of a piggybank the user can access.
+func (s Service) ListEvents(ctx context.Context, id uuid.UUID, userID uuid.UUID) ([]Event, error) {
+	if _, err := s.store.GetByIDForUser(ctx, id, userID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrNotAuthorized
+		}
+		return nil, err
+	}
+	return s.store.ListEvents(ctx, id)
+}
+
+func sameTarget(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
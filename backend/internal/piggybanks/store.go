@@ -2,15 +2,41 @@ package piggybanks
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var ErrNotFound = errors.New("record not found")
 
+// piggyBankColumns selects a piggybank aliased pb, in the order of
+// piggyBankFields.
+const piggyBankColumns = `pb.id, pb.couple_id, pb.owner_user_id, pb.title, pb.description, pb.start_date, pb.end_date,
+			pb.target_cents, pb.target_date, pb.goal_reached_at, pb.recurrence, pb.period_ends_at, pb.series_id, pb.previous_id,
+			pb.finalised_at, pb.archived_at, pb.deleted_at, pb.created_at, pb.updated_at`
+
+// viewTotals selects the totals of a piggybank aliased pb, following
+// piggyBankColumns in views.
+const viewTotals = `(SELECT COUNT(*) FROM voucher_templates vt WHERE vt.piggybank_id = pb.id) as voucher_templates_count,
+			(SELECT COUNT(*) FROM action_entries ae JOIN voucher_templates vt ON ae.voucher_template_id = vt.id WHERE vt.piggybank_id = pb.id) as total_actions,
+			COALESCE((SELECT SUM(vt.amount_cents) FROM action_entries ae JOIN voucher_templates vt ON ae.voucher_template_id = vt.id WHERE vt.piggybank_id = pb.id), 0) as total_value`
+
+func piggyBankFields(pb *PiggyBank) []interface{} {
+	return []interface{}{
+		&pb.ID, &pb.CoupleID, &pb.OwnerUserID, &pb.Title, &pb.Description, &pb.StartDate, &pb.EndDate,
+		&pb.TargetCents, &pb.TargetDate, &pb.GoalReachedAt, &pb.Recurrence, &pb.PeriodEndsAt, &pb.SeriesID, &pb.PreviousID,
+		&pb.FinalisedAt, &pb.ArchivedAt, &pb.DeletedAt, &pb.CreatedAt, &pb.UpdatedAt,
+	}
+}
+
 type Store struct {
 	pool *pgxpool.Pool
 }
@@ -20,11 +46,22 @@ func NewStore(pool *pgxpool.Pool) Store {
 }
 
 func (s Store) Create(ctx context.Context, pb PiggyBank) error {
+	return insertPiggyBank(ctx, s.pool, pb)
+}
+
+// execer is a pool or a transaction.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+func insertPiggyBank(ctx context.Context, db execer, pb PiggyBank) error {
 	query := `
-        INSERT INTO piggybanks (id, couple_id, owner_user_id, title, description, start_date, end_date, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        INSERT INTO piggybanks (id, couple_id, owner_user_id, title, description, start_date, end_date, target_cents, target_date,
+            recurrence, period_ends_at, series_id, previous_id, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
     `
-	_, err := s.pool.Exec(ctx, query, pb.ID, pb.CoupleID, pb.OwnerUserID, pb.Title, pb.Description, pb.StartDate, pb.EndDate, pb.CreatedAt, pb.UpdatedAt)
+	_, err := db.Exec(ctx, query, pb.ID, pb.CoupleID, pb.OwnerUserID, pb.Title, pb.Description, pb.StartDate, pb.EndDate, pb.TargetCents, pb.TargetDate,
+		pb.Recurrence, pb.PeriodEndsAt, pb.SeriesID, pb.PreviousID, pb.CreatedAt, pb.UpdatedAt)
 	return err
 }
 
@@ -38,19 +75,88 @@ func (s Store) Update(ctx context.Context, pb PiggyBank) error {
 	return err
 }
 
-func (s Store) ListByUserID(ctx context.Context, userID uuid.UUID) ([]PiggyBankView, error) {
+// sortKeys maps sort keys to the expression they order by and the type
+// their cursor values are cast to.
+var sortKeys = map[string][2]string{
+	SortCreatedAt: {"pb.created_at", "timestamptz"},
+	SortStartDate: {"pb.start_date", "timestamptz"},
+	SortEndDate:   {"COALESCE(pb.end_date, 'infinity'::timestamptz)", "timestamptz"},
+	SortTitle:     {"pb.title", "text"},
+}
+
+// ListByUserID returns the piggybanks userID can access that match filter,
+// with the totals of their voucher templates and action entries. Piggybanks
+// whose end date is now or earlier count as closed.
+func (s Store) ListByUserID(ctx context.Context, userID uuid.UUID, filter ListFilter, now time.Time) ([]PiggyBankView, error) {
+	args := []interface{}{userID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	where := []string{`(
+			pb.owner_user_id = $1 OR
+			EXISTS (
+				SELECT 1 FROM household_members hm
+				WHERE hm.household_id = pb.couple_id AND hm.user_id = $1
+				  AND (hm.left_at IS NULL OR hm.left_at >= pb.archived_at)
+			)
+		)`, "pb.deleted_at IS NULL"}
+	switch filter.Status {
+	case StatusActive:
+		where = append(where, "(pb.end_date IS NULL OR pb.end_date > "+arg(now)+")")
+	case StatusClosed:
+		where = append(where, "pb.end_date <= "+arg(now))
+	}
+	if filter.From != nil {
+		where = append(where, "COALESCE(pb.end_date, 'infinity'::date) >= "+arg(*filter.From)+"::date")
+	}
+	if filter.To != nil {
+		where = append(where, "pb.start_date <= "+arg(*filter.To)+"::date")
+	}
+	if filter.Search != "" {
+		pattern := arg("%" + likeEscaper.Replace(filter.Search) + "%")
+		where = append(where, "(pb.title ILIKE "+pattern+" OR pb.description ILIKE "+pattern+")")
+	}
+
+	key := sortKeys[filter.Sort]
+	direction, comparison := "ASC", ">"
+	if filter.descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.After != nil {
+		where = append(where, fmt.Sprintf("(%s, pb.id) %s (%s::text::%s, %s::uuid)",
+			key[0], comparison, arg(filter.After.Value), key[1], arg(filter.After.ID)))
+	}
+
 	query := `
 		SELECT
-			pb.id, pb.couple_id, pb.owner_user_id, pb.title, pb.description, pb.start_date, pb.end_date, pb.created_at, pb.updated_at,
-			(SELECT COUNT(*) FROM voucher_templates vt WHERE vt.piggybank_id = pb.id) as voucher_templates_count,
-			(SELECT COUNT(*) FROM action_entries ae JOIN voucher_templates vt ON ae.voucher_template_id = vt.id WHERE vt.piggybank_id = pb.id) as total_actions,
-			COALESCE((SELECT SUM(vt.amount_cents) FROM action_entries ae JOIN voucher_templates vt ON ae.voucher_template_id = vt.id WHERE vt.piggybank_id = pb.id), 0) as total_value
+			` + piggyBankColumns + `,
+			` + viewTotals + `
 		FROM piggybanks pb
-		LEFT JOIN couples c ON pb.couple_id = c.id
-		WHERE (
-			pb.owner_user_id = $1 OR
-			(c.partner1_user_id = $1 OR c.partner2_user_id = $1)
-		) AND pb.end_date IS NULL
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + key[0] + ` ` + direction + `, pb.id ` + direction + `
+		LIMIT ` + arg(filter.Limit)
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanViews(rows)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListSoloByUserID returns the solo piggybanks of a user, closed ones
+// included, with the same totals as ListByUserID.
+func (s Store) ListSoloByUserID(ctx context.Context, userID uuid.UUID) ([]PiggyBankView, error) {
+	query := `
+		SELECT
+			` + piggyBankColumns + `,
+			` + viewTotals + `
+		FROM piggybanks pb
+		WHERE pb.owner_user_id = $1 AND pb.archived_at IS NULL AND pb.deleted_at IS NULL
 		ORDER BY pb.created_at DESC
 	`
 	rows, err := s.pool.Query(ctx, query, userID)
@@ -59,35 +165,86 @@ func (s Store) ListByUserID(ctx context.Context, userID uuid.UUID) ([]PiggyBankV
 	}
 	defer rows.Close()
 
+	return scanViews(rows)
+}
+
+// ListDeletedByUserID returns the piggybanks userID can access that were
+// deleted at or after since, most recently deleted first.
+func (s Store) ListDeletedByUserID(ctx context.Context, userID uuid.UUID, since time.Time) ([]PiggyBankView, error) {
+	query := `
+		SELECT
+			` + piggyBankColumns + `,
+			` + viewTotals + `
+		FROM piggybanks pb
+		WHERE (
+			pb.owner_user_id = $1 OR
+			EXISTS (
+				SELECT 1 FROM household_members hm
+				WHERE hm.household_id = pb.couple_id AND hm.user_id = $1
+				  AND (hm.left_at IS NULL OR hm.left_at >= pb.archived_at)
+			)
+		) AND pb.deleted_at >= $2
+		ORDER BY pb.deleted_at DESC
+	`
+	rows, err := s.pool.Query(ctx, query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanViews(rows)
+}
+
+func scanViews(rows pgx.Rows) ([]PiggyBankView, error) {
 	var piggyBanks []PiggyBankView
 	for rows.Next() {
-		var pb PiggyBank
-		var count int
-		var totalActions int
-		var totalValue int
-		if err := rows.Scan(&pb.ID, &pb.CoupleID, &pb.OwnerUserID, &pb.Title, &pb.Description, &pb.StartDate, &pb.EndDate, &pb.CreatedAt, &pb.UpdatedAt, &count, &totalActions, &totalValue); err != nil {
+		var view PiggyBankView
+		if err := rows.Scan(viewFields(&view)...); err != nil {
 			return nil, err
 		}
-		piggyBanks = append(piggyBanks, PiggyBankView{
-			PiggyBank:             pb,
-			VoucherTemplatesCount: count,
-			TotalActions:          totalActions,
-			TotalValue:            totalValue,
-		})
+		piggyBanks = append(piggyBanks, view)
 	}
 	return piggyBanks, rows.Err()
 }
 
+func viewFields(view *PiggyBankView) []interface{} {
+	return append(piggyBankFields(&view.PiggyBank), &view.VoucherTemplatesCount, &view.TotalActions, &view.TotalValue)
+}
+
+// CanManage reports whether userID may change the settings of a piggybank
+// they can access. Children of a household take part in its piggybanks
+// without managing them.
+func (s Store) CanManage(ctx context.Context, pb PiggyBank, userID uuid.UUID) (bool, error) {
+	if pb.CoupleID == nil {
+		return true, nil
+	}
+
+	query := `
+        SELECT role
+        FROM household_members
+        WHERE household_id = $1 AND user_id = $2 AND left_at IS NULL
+        LIMIT 1
+    `
+	var role string
+	if err := s.pool.QueryRow(ctx, query, *pb.CoupleID, userID).Scan(&role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return role != "child", nil
+}
+
 func (s Store) GetByID(ctx context.Context, id uuid.UUID) (PiggyBank, error) {
 	query := `
-        SELECT id, couple_id, owner_user_id, title, description, start_date, end_date, created_at, updated_at
-        FROM piggybanks
-        WHERE id = $1
+        SELECT ` + piggyBankColumns + `
+        FROM piggybanks pb
+        WHERE pb.id = $1
         LIMIT 1
     `
 	row := s.pool.QueryRow(ctx, query, id)
 	var pb PiggyBank
-	if err := row.Scan(&pb.ID, &pb.CoupleID, &pb.OwnerUserID, &pb.Title, &pb.Description, &pb.StartDate, &pb.EndDate, &pb.CreatedAt, &pb.UpdatedAt); err != nil {
+	if err := row.Scan(piggyBankFields(&pb)...); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return PiggyBank{}, ErrNotFound
 		}
@@ -96,20 +253,61 @@ func (s Store) GetByID(ctx context.Context, id uuid.UUID) (PiggyBank, error) {
 	return pb, nil
 }
 
+// GetByIDForUser returns a piggybank userID can access. Deleted piggybanks
+// are not found.
 func (s Store) GetByIDForUser(ctx context.Context, id uuid.UUID, userID uuid.UUID) (PiggyBank, error) {
+	return s.getForUser(ctx, id, userID, `AND pb.deleted_at IS NULL`)
+}
+
+// GetViewByIDForUser returns a piggybank userID can access with the same
+// totals as ListByUserID.
+func (s Store) GetViewByIDForUser(ctx context.Context, id uuid.UUID, userID uuid.UUID) (PiggyBankView, error) {
+	query := `
+		SELECT
+			` + piggyBankColumns + `,
+			` + viewTotals + `
+		FROM piggybanks pb
+		WHERE pb.id = $1 AND (
+			pb.owner_user_id = $2 OR
+			EXISTS (
+				SELECT 1 FROM household_members hm
+				WHERE hm.household_id = pb.couple_id AND hm.user_id = $2
+				  AND (hm.left_at IS NULL OR hm.left_at >= pb.archived_at)
+			)
+		) AND pb.deleted_at IS NULL
+	`
+	var view PiggyBankView
+	if err := s.pool.QueryRow(ctx, query, id, userID).Scan(viewFields(&view)...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PiggyBankView{}, ErrNotFound
+		}
+		return PiggyBankView{}, err
+	}
+	return view, nil
+}
+
+// GetDeletedByIDForUser returns a deleted piggybank userID can access.
+func (s Store) GetDeletedByIDForUser(ctx context.Context, id uuid.UUID, userID uuid.UUID) (PiggyBank, error) {
+	return s.getForUser(ctx, id, userID, `AND pb.deleted_at IS NOT NULL`)
+}
+
+func (s Store) getForUser(ctx context.Context, id uuid.UUID, userID uuid.UUID, filter string) (PiggyBank, error) {
 	query := `
-        SELECT pb.id, pb.couple_id, pb.owner_user_id, pb.title, pb.description, pb.start_date, pb.end_date, pb.created_at, pb.updated_at
+        SELECT ` + piggyBankColumns + `
         FROM piggybanks pb
-        LEFT JOIN couples c ON pb.couple_id = c.id
         WHERE pb.id = $1 AND (
             pb.owner_user_id = $2 OR
-            (c.partner1_user_id = $2 OR c.partner2_user_id = $2)
-        )
+            EXISTS (
+                SELECT 1 FROM household_members hm
+                WHERE hm.household_id = pb.couple_id AND hm.user_id = $2
+                  AND (hm.left_at IS NULL OR hm.left_at >= pb.archived_at)
+            )
+        ) ` + filter + `
         LIMIT 1
     `
 	row := s.pool.QueryRow(ctx, query, id, userID)
 	var pb PiggyBank
-	if err := row.Scan(&pb.ID, &pb.CoupleID, &pb.OwnerUserID, &pb.Title, &pb.Description, &pb.StartDate, &pb.EndDate, &pb.CreatedAt, &pb.UpdatedAt); err != nil {
+	if err := row.Scan(piggyBankFields(&pb)...); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return PiggyBank{}, ErrNotFound
 		}
@@ -117,3 +315,807 @@ func (s Store) GetByIDForUser(ctx context.Context, id uuid.UUID, userID uuid.UUI
 	}
 	return pb, nil
 }
+
+// Promote moves solo piggybanks of userID into a household. Either every
+// requested piggybank is promoted or, with ErrNotFound, none is.
+func (s Store) Promote(ctx context.Context, userID, householdID uuid.UUID, ids []uuid.UUID, at time.Time) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	promoted, err := PromoteSolo(ctx, tx, userID, householdID, ids, at)
+	if err != nil {
+		return err
+	}
+	if len(promoted) != len(ids) {
+		return ErrNotFound
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PromoteSolo moves solo piggybanks of userID into a household within tx and
+// records a promoted event for each. A nil ids promotes all of them. Owner
+// and couple are swapped in a single update, as check_owner_or_couple
+// requires exactly one of them.
+func PromoteSolo(ctx context.Context, tx pgx.Tx, userID, householdID uuid.UUID, ids []uuid.UUID, at time.Time) ([]uuid.UUID, error) {
+	query := `
+        UPDATE piggybanks
+        SET couple_id = $2, owner_user_id = NULL, updated_at = $4
+        WHERE owner_user_id = $1 AND archived_at IS NULL AND deleted_at IS NULL AND ($3::uuid[] IS NULL OR id = ANY($3))
+        RETURNING id
+    `
+	rows, err := tx.Query(ctx, query, userID, householdID, ids, at)
+	if err != nil {
+		return nil, err
+	}
+	var promoted []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		promoted = append(promoted, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	details, err := json.Marshal(map[string]string{
+		"fromOwnerUserId": userID.String(),
+		"toHouseholdId":   householdID.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range promoted {
+		if err := insertEvent(ctx, tx, id, &userID, EventPromoted, string(details), at); err != nil {
+			return nil, err
+		}
+	}
+	return promoted, nil
+}
+
+// Save updates the editable fields of a piggybank that is not deleted and
+// records eventType by userID in the same transaction. Changing the target
+// clears when the goal was reached, changing the end date when the piggybank
+// was finalised.
+func (s Store) Save(ctx context.Context, pb PiggyBank, userID uuid.UUID, eventType, details string) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        UPDATE piggybanks
+        SET title = $2, description = $3, start_date = $4, end_date = $5, target_cents = $6, target_date = $7,
+            goal_reached_at = CASE WHEN target_cents IS DISTINCT FROM $6 THEN NULL ELSE goal_reached_at END,
+            finalised_at = CASE WHEN end_date IS DISTINCT FROM $5 THEN NULL ELSE finalised_at END,
+            recurrence = $8, period_ends_at = $9, series_id = $10, updated_at = $11
+        WHERE id = $1 AND deleted_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, query, pb.ID, pb.Title, pb.Description, pb.StartDate, pb.EndDate, pb.TargetCents, pb.TargetDate,
+		pb.Recurrence, pb.PeriodEndsAt, pb.SeriesID, pb.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	if err := insertEvent(ctx, tx, pb.ID, &userID, eventType, details, pb.UpdatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ConfirmDeletion records that userID confirms deleting a piggybank and
+// returns the approvers whose confirmation, given at or after since, is still
+// missing. Once none is, the piggybank is deleted. The piggybank row is locked
+// so that partners confirming at the same time cannot miss each other.
+func (s Store) ConfirmDeletion(ctx context.Context, id, userID uuid.UUID, approvers []uuid.UUID, since, at time.Time) ([]uuid.UUID, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	lockQuery := `
+        SELECT id FROM piggybanks
+        WHERE id = $1 AND deleted_at IS NULL
+        FOR UPDATE
+    `
+	var locked uuid.UUID
+	if err := tx.QueryRow(ctx, lockQuery, id).Scan(&locked); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	confirmQuery := `
+        INSERT INTO piggybank_deletion_confirmations (piggybank_id, user_id, confirmed_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (piggybank_id, user_id) DO UPDATE SET confirmed_at = $3
+    `
+	if _, err := tx.Exec(ctx, confirmQuery, id, userID, at); err != nil {
+		return nil, err
+	}
+
+	confirmedQuery := `
+        SELECT user_id FROM piggybank_deletion_confirmations
+        WHERE piggybank_id = $1 AND confirmed_at >= $2
+    `
+	rows, err := tx.Query(ctx, confirmedQuery, id, since)
+	if err != nil {
+		return nil, err
+	}
+	confirmed := make(map[uuid.UUID]bool)
+	for rows.Next() {
+		var confirmedBy uuid.UUID
+		if err := rows.Scan(&confirmedBy); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		confirmed[confirmedBy] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var awaiting []uuid.UUID
+	for _, approver := range approvers {
+		if !confirmed[approver] {
+			awaiting = append(awaiting, approver)
+		}
+	}
+
+	if len(awaiting) > 0 {
+		if err := insertEvent(ctx, tx, id, &userID, EventDeletionConfirmed, "", at); err != nil {
+			return nil, err
+		}
+		return awaiting, tx.Commit(ctx)
+	}
+
+	deleteQuery := `
+        UPDATE piggybanks
+        SET deleted_at = $2, updated_at = $2
+        WHERE id = $1
+    `
+	if _, err := tx.Exec(ctx, deleteQuery, id, at); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM piggybank_deletion_confirmations WHERE piggybank_id = $1`, id); err != nil {
+		return nil, err
+	}
+	if err := insertEvent(ctx, tx, id, &userID, EventDeleted, "", at); err != nil {
+		return nil, err
+	}
+
+	return nil, tx.Commit(ctx)
+}
+
+// CancelDeletion withdraws every confirmation of a pending deletion. It
+// reports whether one was pending.
+func (s Store) CancelDeletion(ctx context.Context, id, userID uuid.UUID, at time.Time) (bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM piggybank_deletion_confirmations WHERE piggybank_id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := insertEvent(ctx, tx, id, &userID, EventDeletionCancelled, "", at); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// Restore undeletes a piggybank deleted at or after since.
+func (s Store) Restore(ctx context.Context, id, userID uuid.UUID, since, at time.Time) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        UPDATE piggybanks
+        SET deleted_at = NULL, updated_at = $3
+        WHERE id = $1 AND deleted_at >= $2
+    `
+	tag, err := tx.Exec(ctx, query, id, since, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+
+	if err := insertEvent(ctx, tx, id, &userID, EventRestored, "", at); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PurgeDeleted permanently removes piggybanks deleted before the given time,
+// with their voucher templates, action entries and events.
+func (s Store) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM piggybanks WHERE deleted_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// MarkGoalReached records that a piggybank reached its target if its total
+// has crossed the target for the first time, together with a goal_reached
+// event by userID. It reports whether it did; the conditional update makes
+// concurrent calls record the goal once.
+func (s Store) MarkGoalReached(ctx context.Context, id, userID uuid.UUID, at time.Time) (bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        WITH total AS (
+            SELECT COALESCE(SUM(vt.amount_cents), 0) AS value
+            FROM action_entries ae
+            JOIN voucher_templates vt ON ae.voucher_template_id = vt.id
+            WHERE vt.piggybank_id = $1
+        )
+        UPDATE piggybanks
+        SET goal_reached_at = $2
+        FROM total
+        WHERE id = $1 AND goal_reached_at IS NULL AND target_cents IS NOT NULL AND total.value >= target_cents
+        RETURNING target_cents, total.value
+    `
+	var targetCents, totalValue int
+	if err := tx.QueryRow(ctx, query, id, at).Scan(&targetCents, &totalValue); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	details, err := json.Marshal(map[string]int{"targetCents": targetCents, "totalValue": totalValue})
+	if err != nil {
+		return false, err
+	}
+	if err := insertEvent(ctx, tx, id, &userID, EventGoalReached, string(details), at); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// ListMilestones returns the milestones of a piggybank in order.
+func (s Store) ListMilestones(ctx context.Context, piggyBankID uuid.UUID) ([]Milestone, error) {
+	query := `
+        SELECT id, piggybank_id, threshold_cents, reward, position, reached_at, created_at, updated_at
+        FROM piggybank_milestones
+        WHERE piggybank_id = $1
+        ORDER BY position, threshold_cents
+    `
+	rows, err := s.pool.Query(ctx, query, piggyBankID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var milestones []Milestone
+	for rows.Next() {
+		m, err := scanMilestone(rows)
+		if err != nil {
+			return nil, err
+		}
+		milestones = append(milestones, m)
+	}
+	return milestones, rows.Err()
+}
+
+func (s Store) GetMilestone(ctx context.Context, piggyBankID, id uuid.UUID) (Milestone, error) {
+	query := `
+        SELECT id, piggybank_id, threshold_cents, reward, position, reached_at, created_at, updated_at
+        FROM piggybank_milestones
+        WHERE piggybank_id = $1 AND id = $2
+    `
+	m, err := scanMilestone(s.pool.QueryRow(ctx, query, piggyBankID, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Milestone{}, ErrNotFound
+		}
+		return Milestone{}, err
+	}
+	return m, nil
+}
+
+func scanMilestone(row pgx.Row) (Milestone, error) {
+	var m Milestone
+	err := row.Scan(&m.ID, &m.PiggyBankID, &m.ThresholdCents, &m.Reward, &m.Position, &m.ReachedAt, &m.CreatedAt, &m.UpdatedAt)
+	return m, err
+}
+
+// CreateMilestone inserts a milestone at position, or after the others when
+// position is nil; the stored position is set on m. Milestones at or after an
+// explicit position move one place down. The piggybank row is locked so that
+// concurrent changes to its milestones are applied one after the other.
+func (s Store) CreateMilestone(ctx context.Context, m *Milestone, position *int) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockMilestones(ctx, tx, m.PiggyBankID); err != nil {
+		return err
+	}
+
+	if position != nil {
+		shiftQuery := `
+            UPDATE piggybank_milestones
+            SET position = position + 1
+            WHERE piggybank_id = $1 AND position >= $2
+        `
+		if _, err := tx.Exec(ctx, shiftQuery, m.PiggyBankID, *position); err != nil {
+			return err
+		}
+	}
+
+	query := `
+        INSERT INTO piggybank_milestones (id, piggybank_id, threshold_cents, reward, position, created_at, updated_at)
+        SELECT $1, $2, $3, $4,
+            COALESCE($5::integer, COALESCE(MAX(position), 0) + 1),
+            $6, $6
+        FROM piggybank_milestones
+        WHERE piggybank_id = $2
+        RETURNING position
+    `
+	if err := tx.QueryRow(ctx, query, m.ID, m.PiggyBankID, m.ThresholdCents, m.Reward, position, m.CreatedAt).Scan(&m.Position); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateMilestone saves a milestone. Changing its threshold clears when it
+// was reached. Moving it shifts the milestones in between by one place, so
+// that positions stay unique.
+func (s Store) UpdateMilestone(ctx context.Context, m Milestone) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockMilestones(ctx, tx, m.PiggyBankID); err != nil {
+		return err
+	}
+
+	var current int
+	currentQuery := `SELECT position FROM piggybank_milestones WHERE piggybank_id = $1 AND id = $2`
+	if err := tx.QueryRow(ctx, currentQuery, m.PiggyBankID, m.ID).Scan(&current); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	if m.Position != current {
+		shiftQuery := `
+            UPDATE piggybank_milestones
+            SET position = position + CASE WHEN $2::integer > $3::integer THEN 1 ELSE -1 END
+            WHERE piggybank_id = $1 AND id <> $4
+              AND position BETWEEN LEAST($2::integer, $3::integer) AND GREATEST($2::integer, $3::integer)
+        `
+		if _, err := tx.Exec(ctx, shiftQuery, m.PiggyBankID, current, m.Position, m.ID); err != nil {
+			return err
+		}
+	}
+
+	query := `
+        UPDATE piggybank_milestones
+        SET threshold_cents = $3, reward = $4, position = $5,
+            reached_at = CASE WHEN threshold_cents = $3 THEN reached_at ELSE NULL END,
+            updated_at = $6
+        WHERE piggybank_id = $1 AND id = $2
+    `
+	if _, err := tx.Exec(ctx, query, m.PiggyBankID, m.ID, m.ThresholdCents, m.Reward, m.Position, m.UpdatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// lockMilestones locks a piggybank row for a change to its milestones. It
+// does not block action entries from being recorded.
+func lockMilestones(ctx context.Context, tx pgx.Tx, piggyBankID uuid.UUID) error {
+	var locked uuid.UUID
+	err := tx.QueryRow(ctx, `SELECT id FROM piggybanks WHERE id = $1 FOR NO KEY UPDATE`, piggyBankID).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s Store) DeleteMilestone(ctx context.Context, piggyBankID, id uuid.UUID) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM piggybank_milestones WHERE piggybank_id = $1 AND id = $2`, piggyBankID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkMilestonesReached records when the running total of a piggybank's
+// action entries, in the order they occurred, first reached each milestone
+// not reached yet, with a milestone_reached event by userID for each. It
+// returns the milestones it marked.
+func (s Store) MarkMilestonesReached(ctx context.Context, piggyBankID, userID uuid.UUID, at time.Time) ([]Milestone, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        WITH running AS (
+            SELECT ae.occurred_at, SUM(vt.amount_cents) OVER (ORDER BY ae.occurred_at, ae.id) AS total
+            FROM action_entries ae
+            JOIN voucher_templates vt ON ae.voucher_template_id = vt.id
+            WHERE vt.piggybank_id = $1
+        )
+        UPDATE piggybank_milestones m
+        SET reached_at = (SELECT MIN(r.occurred_at) FROM running r WHERE r.total >= m.threshold_cents)
+        WHERE m.piggybank_id = $1 AND m.reached_at IS NULL
+          AND EXISTS (SELECT 1 FROM running r WHERE r.total >= m.threshold_cents)
+        RETURNING m.id, m.piggybank_id, m.threshold_cents, m.reward, m.position, m.reached_at, m.created_at, m.updated_at
+    `
+	rows, err := tx.Query(ctx, query, piggyBankID)
+	if err != nil {
+		return nil, err
+	}
+	var reached []Milestone
+	for rows.Next() {
+		m, err := scanMilestone(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		reached = append(reached, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range reached {
+		details, err := json.Marshal(map[string]interface{}{
+			"milestoneId":    m.ID.String(),
+			"thresholdCents": m.ThresholdCents,
+			"reachedAt":      m.ReachedAt.Format(time.RFC3339),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := insertEvent(ctx, tx, piggyBankID, &userID, EventMilestoneReached, string(details), at); err != nil {
+			return nil, err
+		}
+	}
+
+	return reached, tx.Commit(ctx)
+}
+
+// ListSeries returns the instances of a recurring piggybank's series that
+// userID can access, oldest period first, with the same totals as
+// ListByUserID.
+func (s Store) ListSeries(ctx context.Context, seriesID uuid.UUID, userID uuid.UUID) ([]PiggyBankView, error) {
+	query := `
+		SELECT
+			` + piggyBankColumns + `,
+			` + viewTotals + `
+		FROM piggybanks pb
+		WHERE pb.series_id = $1 AND (
+			pb.owner_user_id = $2 OR
+			EXISTS (
+				SELECT 1 FROM household_members hm
+				WHERE hm.household_id = pb.couple_id AND hm.user_id = $2
+				  AND (hm.left_at IS NULL OR hm.left_at >= pb.archived_at)
+			)
+		) AND pb.deleted_at IS NULL
+		ORDER BY pb.start_date ASC, pb.created_at ASC
+	`
+	rows, err := s.pool.Query(ctx, query, seriesID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanViews(rows)
+}
+
+// ListDueRecurring returns open recurring piggybanks whose period ended by
+// now and that have not rolled over yet.
+func (s Store) ListDueRecurring(ctx context.Context, now time.Time, limit int) ([]PiggyBank, error) {
+	query := `
+        SELECT ` + piggyBankColumns + `
+        FROM piggybanks pb
+        WHERE pb.recurrence IS NOT NULL AND pb.end_date IS NULL AND pb.period_ends_at <= $1
+          AND pb.archived_at IS NULL AND pb.deleted_at IS NULL
+          AND NOT EXISTS (SELECT 1 FROM piggybanks n WHERE n.previous_id = pb.id)
+        ORDER BY pb.period_ends_at
+        LIMIT $2
+    `
+	rows, err := s.pool.Query(ctx, query, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var piggyBanks []PiggyBank
+	for rows.Next() {
+		var pb PiggyBank
+		if err := rows.Scan(piggyBankFields(&pb)...); err != nil {
+			return nil, err
+		}
+		piggyBanks = append(piggyBanks, pb)
+	}
+	return piggyBanks, rows.Err()
+}
+
+// HasSuccessor reports whether a piggybank rolled over to a next period.
+func (s Store) HasSuccessor(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM piggybanks WHERE previous_id = $1)`, id).Scan(&exists)
+	return exists, err
+}
+
+// RollOver closes pb at the end of its period and creates next, its
+// successor in the series, with copies of pb's voucher templates. The closed
+// period is marked finalised at once: it gets no closing summary. It returns
+// ErrNotFound, changing nothing, if pb was closed or rolled over meanwhile,
+// e.g. by another replica.
+func (s Store) RollOver(ctx context.Context, pb PiggyBank, next PiggyBank) error {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	closeQuery := `
+        UPDATE piggybanks
+        SET end_date = $2, finalised_at = $3, updated_at = $3
+        WHERE id = $1 AND end_date IS NULL AND deleted_at IS NULL AND archived_at IS NULL
+    `
+	tag, err := tx.Exec(ctx, closeQuery, pb.ID, *pb.EndDate, next.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	if err := insertEvent(ctx, tx, pb.ID, nil, EventClosed, "", next.CreatedAt); err != nil {
+		return err
+	}
+
+	if err := insertPiggyBank(ctx, tx, next); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	templatesQuery := `
+        INSERT INTO voucher_templates (id, piggybank_id, title, description, amount_cents, created_at, updated_at)
+        SELECT gen_random_uuid(), $2, title, description, amount_cents, $3, $3
+        FROM voucher_templates
+        WHERE piggybank_id = $1
+    `
+	if _, err := tx.Exec(ctx, templatesQuery, pb.ID, next.ID, next.CreatedAt); err != nil {
+		return err
+	}
+
+	details, err := json.Marshal(map[string]string{"previousId": pb.ID.String()})
+	if err != nil {
+		return err
+	}
+	if err := insertEvent(ctx, tx, next.ID, nil, EventRolledOver, string(details), next.CreatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// FinaliseNext finalises one piggybank whose end date passed before now and
+// that is not finalised yet, and returns it with its closing summary; ok is
+// false if there was none. The piggybank row is locked until the
+// finalisation commits, and locked rows are skipped, so that replicas
+// finalising at the same time each take a different piggybank.
+func (s Store) FinaliseNext(ctx context.Context, now time.Time) (PiggyBank, ClosingSummary, bool, error) {
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return PiggyBank{}, ClosingSummary{}, false, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+        SELECT ` + piggyBankColumns + `
+        FROM piggybanks pb
+        WHERE pb.end_date < $1 AND pb.finalised_at IS NULL
+          AND pb.deleted_at IS NULL AND pb.archived_at IS NULL
+        ORDER BY pb.end_date
+        LIMIT 1
+        FOR UPDATE SKIP LOCKED
+    `
+	var pb PiggyBank
+	if err := tx.QueryRow(ctx, query, now).Scan(piggyBankFields(&pb)...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return PiggyBank{}, ClosingSummary{}, false, nil
+		}
+		return PiggyBank{}, ClosingSummary{}, false, err
+	}
+
+	summary, err := closingSummary(ctx, tx, pb.ID)
+	if err != nil {
+		return PiggyBank{}, ClosingSummary{}, false, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE piggybanks SET finalised_at = $2 WHERE id = $1`, pb.ID, now); err != nil {
+		return PiggyBank{}, ClosingSummary{}, false, err
+	}
+	details, err := json.Marshal(map[string]int{"totalActions": summary.TotalActions, "totalValue": summary.TotalValue})
+	if err != nil {
+		return PiggyBank{}, ClosingSummary{}, false, err
+	}
+	if err := insertEvent(ctx, tx, pb.ID, nil, EventFinalised, string(details), now); err != nil {
+		return PiggyBank{}, ClosingSummary{}, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return PiggyBank{}, ClosingSummary{}, false, err
+	}
+	pb.FinalisedAt = &now
+	return pb, summary, true, nil
+}
+
+// closingSummaryTopActions is how many action entries a closing summary
+// lists.
+const closingSummaryTopActions = 5
+
+func closingSummary(ctx context.Context, tx pgx.Tx, piggyBankID uuid.UUID) (ClosingSummary, error) {
+	var summary ClosingSummary
+
+	templatesQuery := `
+        SELECT vt.id, vt.title, COUNT(ae.id), COALESCE(SUM(vt.amount_cents) FILTER (WHERE ae.id IS NOT NULL), 0)
+        FROM voucher_templates vt
+        LEFT JOIN action_entries ae ON ae.voucher_template_id = vt.id
+        WHERE vt.piggybank_id = $1
+        GROUP BY vt.id, vt.title
+        ORDER BY 4 DESC, 3 DESC, vt.title
+    `
+	rows, err := tx.Query(ctx, templatesQuery, piggyBankID)
+	if err != nil {
+		return ClosingSummary{}, err
+	}
+	for rows.Next() {
+		var t TemplateTotal
+		if err := rows.Scan(&t.VoucherTemplateID, &t.Title, &t.Actions, &t.Value); err != nil {
+			rows.Close()
+			return ClosingSummary{}, err
+		}
+		summary.Templates = append(summary.Templates, t)
+		summary.TotalActions += t.Actions
+		summary.TotalValue += t.Value
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return ClosingSummary{}, err
+	}
+
+	giversQuery := `
+        SELECT ae.giver_user_id, COUNT(*), SUM(vt.amount_cents)
+        FROM action_entries ae
+        JOIN voucher_templates vt ON ae.voucher_template_id = vt.id
+        WHERE vt.piggybank_id = $1
+        GROUP BY ae.giver_user_id
+        ORDER BY 3 DESC, 2 DESC
+    `
+	rows, err = tx.Query(ctx, giversQuery, piggyBankID)
+	if err != nil {
+		return ClosingSummary{}, err
+	}
+	for rows.Next() {
+		var g GiverTotal
+		if err := rows.Scan(&g.GiverUserID, &g.Actions, &g.Value); err != nil {
+			rows.Close()
+			return ClosingSummary{}, err
+		}
+		summary.Givers = append(summary.Givers, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return ClosingSummary{}, err
+	}
+
+	topQuery := `
+        SELECT ae.id, vt.title, ae.giver_user_id, vt.amount_cents, ae.occurred_at
+        FROM action_entries ae
+        JOIN voucher_templates vt ON ae.voucher_template_id = vt.id
+        WHERE vt.piggybank_id = $1
+        ORDER BY vt.amount_cents DESC, ae.occurred_at ASC
+        LIMIT $2
+    `
+	rows, err = tx.Query(ctx, topQuery, piggyBankID, closingSummaryTopActions)
+	if err != nil {
+		return ClosingSummary{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a TopAction
+		if err := rows.Scan(&a.ActionEntryID, &a.Title, &a.GiverUserID, &a.AmountCents, &a.OccurredAt); err != nil {
+			return ClosingSummary{}, err
+		}
+		summary.TopActions = append(summary.TopActions, a)
+	}
+	return summary, rows.Err()
+}
+
+// ListEvents returns the audit trail of a piggybank, oldest first.
+func (s Store) ListEvents(ctx context.Context, piggyBankID uuid.UUID) ([]Event, error) {
+	query := `
+        SELECT id, piggybank_id, user_id, event_type, details, created_at
+        FROM piggybank_events
+        WHERE piggybank_id = $1
+        ORDER BY created_at ASC
+    `
+	rows, err := s.pool.Query(ctx, query, piggyBankID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var e Event
+		if err := rows.Scan(&e.ID, &e.PiggyBankID, &e.UserID, &e.EventType, &e.Details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// insertEvent records an event; details is a JSON object, empty for none.
+func insertEvent(ctx context.Context, tx pgx.Tx, piggyBankID uuid.UUID, userID *uuid.UUID, eventType, details string, at time.Time) error {
+	var detailsPtr *string
+	if details != "" {
+		detailsPtr = &details
+	}
+	query := `
+        INSERT INTO piggybank_events (id, piggybank_id, user_id, event_type, details, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `
+	_, err := tx.Exec(ctx, query, uuid.New(), piggyBankID, userID, eventType, detailsPtr, at)
+	return err
+}
@@ -0,0 +1,4 @@
+// Package settings holds the currency, timezone, locale and week start of a
+// household, or of a user without one, used to format amounts and to group
+// entries into periods.
+package settings
@@ -0,0 +1,105 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/piggybank/backend/internal/auth"
+	"github.com/piggybank/backend/internal/common/response"
+)
+
+// Handler exposes HTTP endpoints for settings.
+type Handler struct {
+	service Service
+}
+
+// NewHandler constructs a handler instance.
+func NewHandler(service Service) Handler {
+	return Handler{service: service}
+}
+
+type updateSettingsPayload struct {
+	Currency  *string `json:"currency"`
+	Timezone  *string `json:"timezone"`
+	Locale    *string `json:"locale"`
+	WeekStart *string `json:"weekStart"`
+}
+
+type settingsResponse struct {
+	Scope     string  `json:"scope"`
+	Currency  string  `json:"currency"`
+	Timezone  string  `json:"timezone"`
+	Locale    string  `json:"locale"`
+	WeekStart string  `json:"weekStart"`
+	UpdatedAt *string `json:"updatedAt"`
+}
+
+// Get handles GET /settings.
+func (h Handler) Get(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	view, err := h.service.ForUser(r.Context(), user.ID)
+	if err != nil {
+		response.InternalError(w, err)
+		return
+	}
+
+	response.JSON(w, http.StatusOK, mapSettings(view))
+}
+
+// Update handles PATCH /settings.
+func (h Handler) Update(w http.ResponseWriter, r *http.Request) {
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		response.Unauthorized(w, "unauthenticated")
+		return
+	}
+
+	var payload updateSettingsPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		response.BadRequest(w, "invalid payload")
+		return
+	}
+
+	view, err := h.service.Update(r.Context(), user.ID, Update{
+		Currency:  payload.Currency,
+		Timezone:  payload.Timezone,
+		Locale:    payload.Locale,
+		WeekStart: payload.WeekStart,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCurrency), errors.Is(err, ErrInvalidTimezone),
+			errors.Is(err, ErrInvalidLocale), errors.Is(err, ErrInvalidWeekStart):
+			response.BadRequest(w, err.Error())
+		case errors.Is(err, ErrNotAllowed):
+			response.Forbidden(w, err.Error())
+		default:
+			response.InternalError(w, err)
+		}
+		return
+	}
+
+	response.JSON(w, http.StatusOK, mapSettings(view))
+}
+
+func mapSettings(view View) settingsResponse {
+	resp := settingsResponse{
+		Scope:     view.Scope,
+		Currency:  view.Settings.Currency,
+		Timezone:  view.Settings.Timezone,
+		Locale:    view.Settings.Locale,
+		WeekStart: WeekdayName(view.Settings.WeekStart),
+	}
+	if view.Settings.UpdatedAt != nil {
+		updatedAt := view.Settings.UpdatedAt.Format(time.RFC3339)
+		resp.UpdatedAt = &updatedAt
+	}
+	return resp
+}
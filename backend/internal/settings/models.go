@@ -0,0 +1,98 @@
+package settings
+
+import (
+	"strings"
+	"time"
+
+	"github.com/piggybank/backend/internal/common/email"
+)
+
+// Owners of settings.
+const (
+	ScopeHousehold = "household"
+	ScopeUser      = "user"
+)
+
+// Period units used to group entries.
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// Settings are the regional preferences of a household or of a user without
+// one. UpdatedAt is nil while the defaults apply.
+type Settings struct {
+	Currency  string
+	Timezone  string
+	Locale    string
+	WeekStart time.Weekday
+	UpdatedAt *time.Time
+}
+
+// Defaults apply until settings are saved.
+var Defaults = Settings{
+	Currency:  "EUR",
+	Timezone:  "UTC",
+	Locale:    "en",
+	WeekStart: time.Monday,
+}
+
+// View is the settings applying to a user together with their owner.
+type View struct {
+	Settings Settings
+	Scope    string
+}
+
+// Update holds the fields to change; nil fields are kept.
+type Update struct {
+	Currency  *string
+	Timezone  *string
+	Locale    *string
+	WeekStart *string
+}
+
+// Location returns the timezone of the settings, UTC if it cannot be loaded.
+func (s Settings) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Formatting returns how emails render amounts and times for these settings.
+func (s Settings) Formatting() email.Formatting {
+	return email.Formatting{Currency: s.Currency, Locale: s.Locale, Location: s.Location()}
+}
+
+// PeriodStart returns the local midnight on which the day, week or month
+// containing t begins.
+func (s Settings) PeriodStart(t time.Time, unit string) time.Time {
+	local := t.In(s.Location())
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+
+	switch unit {
+	case PeriodWeek:
+		offset := (int(day.Weekday()) - int(s.WeekStart) + 7) % 7
+		return day.AddDate(0, 0, -offset)
+	case PeriodMonth:
+		return day.AddDate(0, 0, 1-day.Day())
+	default:
+		return day
+	}
+}
+
+// WeekdayName returns the lowercase English name of a weekday, as used by the API.
+func WeekdayName(d time.Weekday) string {
+	return strings.ToLower(d.String())
+}
+
+func parseWeekday(name string) (time.Weekday, bool) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(name, d.String()) {
+			return d, true
+		}
+	}
+	return 0, false
+}
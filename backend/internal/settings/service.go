@@ -0,0 +1,133 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrInvalidCurrency  = errors.New("currency must be an ISO 4217 code")
+	ErrInvalidTimezone  = errors.New("timezone must be an IANA timezone name")
+	ErrInvalidLocale    = errors.New("locale must be a BCP 47 language tag")
+	ErrInvalidWeekStart = errors.New("weekStart must be a weekday name")
+	ErrNotAllowed       = errors.New("children cannot change household settings")
+)
+
+// Service resolves and updates settings.
+type Service struct {
+	store Store
+}
+
+// NewService constructs a Service.
+func NewService(store Store) Service {
+	return Service{store: store}
+}
+
+// ForUser returns the settings applying to a user: those of their household,
+// or their own without one.
+func (s Service) ForUser(ctx context.Context, userID uuid.UUID) (View, error) {
+	householdID, _, err := s.store.GetMembership(ctx, userID)
+	switch {
+	case err == nil:
+		st, err := s.ForHousehold(ctx, householdID)
+		return View{Settings: st, Scope: ScopeHousehold}, err
+	case errors.Is(err, ErrNotFound):
+		st, err := s.orDefaults(s.store.GetForUser(ctx, userID))
+		return View{Settings: st, Scope: ScopeUser}, err
+	default:
+		return View{}, err
+	}
+}
+
+// ForHousehold returns the settings of a household.
+func (s Service) ForHousehold(ctx context.Context, householdID uuid.UUID) (Settings, error) {
+	return s.orDefaults(s.store.GetForHousehold(ctx, householdID))
+}
+
+// ForPiggyBank returns the settings of whoever a piggybank belongs to, given
+// its couple_id and owner_user_id.
+func (s Service) ForPiggyBank(ctx context.Context, householdID, ownerUserID *uuid.UUID) (Settings, error) {
+	switch {
+	case householdID != nil:
+		return s.ForHousehold(ctx, *householdID)
+	case ownerUserID != nil:
+		return s.orDefaults(s.store.GetForUser(ctx, *ownerUserID))
+	default:
+		return Defaults, nil
+	}
+}
+
+// Update changes the settings applying to a user. Household settings are
+// shared by every member; children may not change them.
+func (s Service) Update(ctx context.Context, userID uuid.UUID, update Update) (View, error) {
+	view, err := s.ForUser(ctx, userID)
+	if err != nil {
+		return View{}, err
+	}
+
+	st := view.Settings
+	if update.Currency != nil {
+		unit, err := currency.ParseISO(strings.TrimSpace(*update.Currency))
+		if err != nil {
+			return View{}, ErrInvalidCurrency
+		}
+		st.Currency = unit.String()
+	}
+	if update.Timezone != nil {
+		name := strings.TrimSpace(*update.Timezone)
+		if name == "" || name == "Local" {
+			return View{}, ErrInvalidTimezone
+		}
+		if _, err := time.LoadLocation(name); err != nil {
+			return View{}, ErrInvalidTimezone
+		}
+		st.Timezone = name
+	}
+	if update.Locale != nil {
+		tag, err := language.Parse(strings.TrimSpace(*update.Locale))
+		if err != nil {
+			return View{}, ErrInvalidLocale
+		}
+		st.Locale = tag.String()
+	}
+	if update.WeekStart != nil {
+		day, ok := parseWeekday(strings.TrimSpace(*update.WeekStart))
+		if !ok {
+			return View{}, ErrInvalidWeekStart
+		}
+		st.WeekStart = day
+	}
+
+	now := time.Now().UTC()
+	st.UpdatedAt = &now
+
+	householdID, role, err := s.store.GetMembership(ctx, userID)
+	switch {
+	case err == nil:
+		if role == "child" {
+			return View{}, ErrNotAllowed
+		}
+		err = s.store.UpsertForHousehold(ctx, householdID, st)
+	case errors.Is(err, ErrNotFound):
+		err = s.store.UpsertForUser(ctx, userID, st)
+	}
+	if err != nil {
+		return View{}, err
+	}
+
+	view.Settings = st
+	return view, nil
+}
+
+func (s Service) orDefaults(st Settings, err error) (Settings, error) {
+	if errors.Is(err, ErrNotFound) {
+		return Defaults, nil
+	}
+	return st, err
+}
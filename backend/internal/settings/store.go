@@ -0,0 +1,92 @@
+package settings
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrNotFound = errors.New("record not found")
+
+// Store encapsulates database persistence for settings.
+type Store struct {
+	pool *pgxpool.Pool
+}
+
+// NewStore creates a new settings store.
+func NewStore(pool *pgxpool.Pool) Store {
+	return Store{pool: pool}
+}
+
+// GetMembership returns the household and role of a user. It returns
+// ErrNotFound for users without a household.
+func (s Store) GetMembership(ctx context.Context, userID uuid.UUID) (uuid.UUID, string, error) {
+	query := `
+        SELECT household_id, role
+        FROM household_members
+        WHERE user_id = $1 AND left_at IS NULL
+        LIMIT 1
+    `
+	var householdID uuid.UUID
+	var role string
+	if err := s.pool.QueryRow(ctx, query, userID).Scan(&householdID, &role); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return uuid.Nil, "", ErrNotFound
+		}
+		return uuid.Nil, "", err
+	}
+	return householdID, role, nil
+}
+
+func (s Store) GetForHousehold(ctx context.Context, householdID uuid.UUID) (Settings, error) {
+	return s.get(ctx, `WHERE household_id = $1`, householdID)
+}
+
+func (s Store) GetForUser(ctx context.Context, userID uuid.UUID) (Settings, error) {
+	return s.get(ctx, `WHERE user_id = $1`, userID)
+}
+
+func (s Store) get(ctx context.Context, where string, id uuid.UUID) (Settings, error) {
+	query := `
+        SELECT currency, timezone, locale, week_start, updated_at
+        FROM settings
+        ` + where
+	var st Settings
+	var weekStart int16
+	var updatedAt time.Time
+	if err := s.pool.QueryRow(ctx, query, id).Scan(&st.Currency, &st.Timezone, &st.Locale, &weekStart, &updatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Settings{}, ErrNotFound
+		}
+		return Settings{}, err
+	}
+	st.WeekStart = time.Weekday(weekStart)
+	st.UpdatedAt = &updatedAt
+	return st, nil
+}
+
+func (s Store) UpsertForHousehold(ctx context.Context, householdID uuid.UUID, st Settings) error {
+	query := `
+        INSERT INTO settings (id, household_id, currency, timezone, locale, week_start, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+        ON CONFLICT (household_id) DO UPDATE
+        SET currency = $3, timezone = $4, locale = $5, week_start = $6, updated_at = $7
+    `
+	_, err := s.pool.Exec(ctx, query, uuid.New(), householdID, st.Currency, st.Timezone, st.Locale, int16(st.WeekStart), st.UpdatedAt)
+	return err
+}
+
+func (s Store) UpsertForUser(ctx context.Context, userID uuid.UUID, st Settings) error {
+	query := `
+        INSERT INTO settings (id, user_id, currency, timezone, locale, week_start, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+        ON CONFLICT (user_id) DO UPDATE
+        SET currency = $3, timezone = $4, locale = $5, week_start = $6, updated_at = $7
+    `
+	_, err := s.pool.Exec(ctx, query, uuid.New(), userID, st.Currency, st.Timezone, st.Locale, int16(st.WeekStart), st.UpdatedAt)
+	return err
+}
@@ -3,9 +3,11 @@ package users
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -20,11 +22,11 @@ func NewPGRepository(pool *pgxpool.Pool) Repository {
 
 func (r *pgRepository) Create(ctx context.Context, user User) error {
 	query := `
-        INSERT INTO users (id, email, password_hash, name, created_at, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6)
+        INSERT INTO users (id, email, password_hash, name, email_verified_at, created_at, updated_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
     `
 
-	_, err := r.pool.Exec(ctx, query, user.ID, user.Email, user.PasswordHash, user.Name, user.CreatedAt, user.UpdatedAt)
+	_, err := r.pool.Exec(ctx, query, user.ID, user.Email, user.PasswordHash, user.Name, user.EmailVerifiedAt, user.CreatedAt, user.UpdatedAt)
 	if err != nil {
 		return err
 	}
@@ -33,7 +35,7 @@ func (r *pgRepository) Create(ctx context.Context, user User) error {
 
 func (r *pgRepository) GetByEmail(ctx context.Context, email string) (User, error) {
 	query := `
-        SELECT id, email, password_hash, name, created_at, updated_at
+        SELECT id, email, password_hash, name, email_verified_at, created_at, updated_at
         FROM users
         WHERE email = $1
         LIMIT 1
@@ -41,7 +43,7 @@ func (r *pgRepository) GetByEmail(ctx context.Context, email string) (User, erro
 
 	row := r.pool.QueryRow(ctx, query, email)
 	var user User
-	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
+	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return User{}, ErrNotFound
 		}
@@ -52,7 +54,7 @@ func (r *pgRepository) GetByEmail(ctx context.Context, email string) (User, erro
 
 func (r *pgRepository) GetByID(ctx context.Context, id uuid.UUID) (User, error) {
 	query := `
-        SELECT id, email, password_hash, name, created_at, updated_at
+        SELECT id, email, password_hash, name, email_verified_at, created_at, updated_at
         FROM users
         WHERE id = $1
         LIMIT 1
@@ -60,7 +62,7 @@ func (r *pgRepository) GetByID(ctx context.Context, id uuid.UUID) (User, error)
 
 	row := r.pool.QueryRow(ctx, query, id)
 	var user User
-	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.CreatedAt, &user.UpdatedAt); err != nil {
+	if err := row.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.EmailVerifiedAt, &user.CreatedAt, &user.UpdatedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return User{}, ErrNotFound
 		}
@@ -68,3 +70,77 @@ func (r *pgRepository) GetByID(ctx context.Context, id uuid.UUID) (User, error)
 	}
 	return user, nil
 }
+
+func (r *pgRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string, updatedAt time.Time) error {
+	query := `
+        UPDATE users
+        SET password_hash = $2, updated_at = $3
+        WHERE id = $1
+    `
+
+	tag, err := r.pool.Exec(ctx, query, id, passwordHash, updatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string, verifiedAt time.Time) error {
+	query := `
+        UPDATE users
+        SET email_verified_at = $3, updated_at = $3
+        WHERE id = $1 AND email = $2
+    `
+
+	tag, err := r.pool.Exec(ctx, query, id, email, verifiedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgRepository) UpdateName(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time) error {
+	query := `
+        UPDATE users
+        SET name = $2, updated_at = $3
+        WHERE id = $1
+    `
+
+	tag, err := r.pool.Exec(ctx, query, id, name, updatedAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// UpdateEmail replaces the address of an account. The new address was confirmed
+// through a link sent to it, so it is stored as verified.
+func (r *pgRepository) UpdateEmail(ctx context.Context, id uuid.UUID, email string, updatedAt time.Time) error {
+	query := `
+        UPDATE users
+        SET email = $2, email_verified_at = $3, updated_at = $3
+        WHERE id = $1
+    `
+
+	tag, err := r.pool.Exec(ctx, query, id, email, updatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrEmailTaken
+		}
+		return err
+	}
+	if tag.RowsAffected() != 1 {
+		return ErrNotFound
+	}
+	return nil
+}
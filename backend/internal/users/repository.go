@@ -3,6 +3,7 @@ package users
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -12,6 +13,13 @@ type Repository interface {
 	Create(ctx context.Context, user User) error
 	GetByEmail(ctx context.Context, email string) (User, error)
 	GetByID(ctx context.Context, id uuid.UUID) (User, error)
+	UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string, updatedAt time.Time) error
+	MarkEmailVerified(ctx context.Context, id uuid.UUID, email string, verifiedAt time.Time) error
+	UpdateName(ctx context.Context, id uuid.UUID, name string, updatedAt time.Time) error
+	UpdateEmail(ctx context.Context, id uuid.UUID, email string, updatedAt time.Time) error
 }
 
-var ErrNotFound = errors.New("user not found")
+var (
+	ErrNotFound   = errors.New("user not found")
+	ErrEmailTaken = errors.New("email already registered")
+)
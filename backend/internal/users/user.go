@@ -8,10 +8,11 @@ import (
 
 // User represents an application account.
 type User struct {
-	ID           uuid.UUID
-	Email        string
-	PasswordHash string
-	Name         string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	ID              uuid.UUID
+	Email           string
+	PasswordHash    string
+	Name            string
+	EmailVerifiedAt *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
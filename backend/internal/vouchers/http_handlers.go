@@ -58,6 +58,8 @@ func (h Handler) Create(c *gin.Context) {
 		switch {
 		case errors.Is(err, ErrNotAuthorized):
 			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrPiggyBankArchived):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
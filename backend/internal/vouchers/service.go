@@ -11,7 +11,8 @@ import (
 )
 
 var (
-	ErrNotAuthorized = errors.New("not authorized to access this voucher template")
+	ErrNotAuthorized     = errors.New("not authorized to access this voucher template")
+	ErrPiggyBankArchived = errors.New("cannot add voucher templates to an archived piggybank")
 )
 
 type Service struct {
@@ -25,13 +26,24 @@ func NewService(store Store, piggybanksStore piggybanks.Store) Service {
 
 func (s Service) Create(ctx context.Context, userID uuid.UUID, piggyBankID uuid.UUID, title string, description *string, amountCents int) (VoucherTemplate, error) {
 	// Verify user has access to the piggybank
-	_, err := s.piggybanks.GetByIDForUser(ctx, piggyBankID, userID)
+	pb, err := s.piggybanks.GetByIDForUser(ctx, piggyBankID, userID)
 	if err != nil {
 		if errors.Is(err, piggybanks.ErrNotFound) {
 			return VoucherTemplate{}, ErrNotAuthorized
 		}
 		return VoucherTemplate{}, err
 	}
+	if pb.ArchivedAt != nil {
+		return VoucherTemplate{}, ErrPiggyBankArchived
+	}
+
+	canManage, err := s.piggybanks.CanManage(ctx, pb, userID)
+	if err != nil {
+		return VoucherTemplate{}, err
+	}
+	if !canManage {
+		return VoucherTemplate{}, ErrNotAuthorized
+	}
 
 	now := time.Now().UTC()
 	vt := VoucherTemplate{
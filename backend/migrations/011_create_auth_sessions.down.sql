@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_session_id;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP INDEX IF EXISTS idx_auth_sessions_user_id;
+DROP TABLE IF EXISTS auth_sessions;
@@ -0,0 +1,19 @@
+CREATE TABLE auth_sessions (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_auth_sessions_user_id ON auth_sessions (user_id);
+
+CREATE TABLE refresh_tokens (
+    id UUID PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES auth_sessions(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    rotated_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens (session_id);
@@ -0,0 +1,6 @@
+DELETE FROM action_entries WHERE giver_user_id IS NULL;
+ALTER TABLE action_entries DROP CONSTRAINT action_entries_giver_user_id_fkey;
+ALTER TABLE action_entries
+    ADD CONSTRAINT action_entries_giver_user_id_fkey
+    FOREIGN KEY (giver_user_id) REFERENCES users(id) ON DELETE RESTRICT;
+ALTER TABLE action_entries ALTER COLUMN giver_user_id SET NOT NULL;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_security_events_user_id;
+DROP TABLE IF EXISTS security_events;
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,18 @@
+CREATE TABLE login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    blocked_until TIMESTAMPTZ
+);
+
+CREATE TABLE security_events (
+    id UUID PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event_type TEXT NOT NULL,
+    email TEXT,
+    ip_address TEXT,
+    details TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_security_events_user_id ON security_events (user_id, created_at);
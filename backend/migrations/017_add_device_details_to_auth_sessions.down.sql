@@ -0,0 +1,4 @@
+ALTER TABLE auth_sessions DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE auth_sessions DROP COLUMN IF EXISTS ip_address;
+ALTER TABLE auth_sessions DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE auth_sessions DROP COLUMN IF EXISTS device_label;
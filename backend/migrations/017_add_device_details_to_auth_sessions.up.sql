@@ -0,0 +1,4 @@
+ALTER TABLE auth_sessions ADD COLUMN device_label TEXT;
+ALTER TABLE auth_sessions ADD COLUMN user_agent TEXT;
+ALTER TABLE auth_sessions ADD COLUMN ip_address TEXT;
+ALTER TABLE auth_sessions ADD COLUMN last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
@@ -0,0 +1,13 @@
+CREATE TABLE magic_link_tokens (
+    id UUID PRIMARY KEY,
+    email TEXT NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT,
+    invitation_token TEXT,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_magic_link_tokens_email ON magic_link_tokens (email, created_at);
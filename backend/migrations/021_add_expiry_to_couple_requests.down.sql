@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_couple_requests_pending_expiry;
+
+UPDATE couple_requests SET status = 'rejected' WHERE status IN ('cancelled', 'expired');
+ALTER TABLE couple_requests DROP CONSTRAINT IF EXISTS couple_requests_status_check;
+ALTER TABLE couple_requests ADD CONSTRAINT couple_requests_status_check CHECK (
+    status IN ('pending', 'accepted', 'rejected')
+);
+
+ALTER TABLE couple_requests DROP COLUMN IF EXISTS expires_at;
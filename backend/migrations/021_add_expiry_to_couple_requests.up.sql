@@ -0,0 +1,10 @@
+ALTER TABLE couple_requests ADD COLUMN expires_at TIMESTAMPTZ;
+UPDATE couple_requests SET expires_at = created_at + INTERVAL '7 days';
+ALTER TABLE couple_requests ALTER COLUMN expires_at SET NOT NULL;
+
+ALTER TABLE couple_requests DROP CONSTRAINT IF EXISTS couple_requests_status_check;
+ALTER TABLE couple_requests ADD CONSTRAINT couple_requests_status_check CHECK (
+    status IN ('pending', 'accepted', 'rejected', 'cancelled', 'expired')
+);
+
+CREATE INDEX idx_couple_requests_pending_expiry ON couple_requests (expires_at) WHERE status = 'pending';
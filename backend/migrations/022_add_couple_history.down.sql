@@ -0,0 +1,19 @@
+ALTER TABLE piggybanks DROP COLUMN archived_at;
+
+-- Ended couples cannot satisfy the original indexes; their archived
+-- piggybanks are removed with them.
+DELETE FROM couples WHERE ended_at IS NOT NULL;
+
+DROP INDEX idx_couples_partner1;
+DROP INDEX idx_couples_partner2;
+DROP INDEX idx_couples_partner_pair;
+
+CREATE UNIQUE INDEX idx_couples_partner1 ON couples (partner1_user_id);
+CREATE UNIQUE INDEX idx_couples_partner2 ON couples (partner2_user_id);
+CREATE UNIQUE INDEX idx_couples_partner_pair ON couples (
+    LEAST(partner1_user_id, partner2_user_id),
+    GREATEST(partner1_user_id, partner2_user_id)
+);
+
+ALTER TABLE couples DROP COLUMN ended_by_user_id;
+ALTER TABLE couples DROP COLUMN ended_at;
@@ -0,0 +1,16 @@
+ALTER TABLE couples ADD COLUMN ended_at TIMESTAMPTZ;
+ALTER TABLE couples ADD COLUMN ended_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Ended couples stay as history, so uniqueness only applies to active couples.
+DROP INDEX idx_couples_partner1;
+DROP INDEX idx_couples_partner2;
+DROP INDEX idx_couples_partner_pair;
+
+CREATE UNIQUE INDEX idx_couples_partner1 ON couples (partner1_user_id) WHERE ended_at IS NULL;
+CREATE UNIQUE INDEX idx_couples_partner2 ON couples (partner2_user_id) WHERE ended_at IS NULL;
+CREATE UNIQUE INDEX idx_couples_partner_pair ON couples (
+    LEAST(partner1_user_id, partner2_user_id),
+    GREATEST(partner1_user_id, partner2_user_id)
+) WHERE ended_at IS NULL;
+
+ALTER TABLE piggybanks ADD COLUMN archived_at TIMESTAMPTZ;
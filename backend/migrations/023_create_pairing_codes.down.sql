@@ -0,0 +1 @@
+DROP TABLE IF EXISTS pairing_codes;
@@ -0,0 +1,12 @@
+CREATE TABLE pairing_codes (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    used_at TIMESTAMPTZ,
+    used_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_pairing_codes_code_hash ON pairing_codes (code_hash);
+CREATE INDEX idx_pairing_codes_user_id ON pairing_codes (user_id);
@@ -0,0 +1,35 @@
+CREATE TABLE couples (
+    id UUID PRIMARY KEY,
+    partner1_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    partner2_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMPTZ,
+    ended_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    CONSTRAINT couples_partner_distinct CHECK (partner1_user_id <> partner2_user_id)
+);
+
+CREATE UNIQUE INDEX idx_couples_partner1 ON couples (partner1_user_id) WHERE ended_at IS NULL;
+CREATE UNIQUE INDEX idx_couples_partner2 ON couples (partner2_user_id) WHERE ended_at IS NULL;
+CREATE UNIQUE INDEX idx_couples_partner_pair ON couples (
+    LEAST(partner1_user_id, partner2_user_id),
+    GREATEST(partner1_user_id, partner2_user_id)
+) WHERE ended_at IS NULL;
+
+-- Only households of an owner and one adult can be represented as couples.
+INSERT INTO couples (id, partner1_user_id, partner2_user_id, created_at, ended_at, ended_by_user_id)
+SELECT h.id, o.user_id, p.user_id, h.created_at, h.ended_at, h.ended_by_user_id
+FROM households h
+INNER JOIN household_members o ON o.household_id = h.id AND o.role = 'owner'
+INNER JOIN household_members p ON p.household_id = h.id AND p.role = 'adult'
+WHERE (SELECT COUNT(*) FROM household_members m WHERE m.household_id = h.id) = 2;
+
+DELETE FROM piggybanks WHERE couple_id IS NOT NULL AND couple_id NOT IN (SELECT id FROM couples);
+
+ALTER TABLE piggybanks DROP CONSTRAINT piggybanks_couple_id_fkey;
+ALTER TABLE piggybanks
+    ADD CONSTRAINT piggybanks_couple_id_fkey
+    FOREIGN KEY (couple_id) REFERENCES couples(id) ON DELETE CASCADE;
+
+DROP TABLE IF EXISTS household_invitations;
+DROP TABLE IF EXISTS household_members;
+DROP TABLE IF EXISTS households;
@@ -0,0 +1,62 @@
+CREATE TABLE households (
+    id UUID PRIMARY KEY,
+    name TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ended_at TIMESTAMPTZ,
+    ended_by_user_id UUID REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE household_members (
+    id UUID PRIMARY KEY,
+    household_id UUID NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('owner', 'adult', 'child')),
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    left_at TIMESTAMPTZ
+);
+
+-- A user belongs to at most one household at a time and every household has
+-- a single owner.
+CREATE UNIQUE INDEX idx_household_members_active_user ON household_members (user_id) WHERE left_at IS NULL;
+CREATE UNIQUE INDEX idx_household_members_owner ON household_members (household_id) WHERE role = 'owner' AND left_at IS NULL;
+CREATE INDEX idx_household_members_household_id ON household_members (household_id);
+
+CREATE TABLE household_invitations (
+    id UUID PRIMARY KEY,
+    household_id UUID NOT NULL REFERENCES households(id) ON DELETE CASCADE,
+    inviter_user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    target_email TEXT,
+    role TEXT NOT NULL CHECK (role IN ('adult', 'child')),
+    invitation_token TEXT NOT NULL UNIQUE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'rejected', 'cancelled', 'expired')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    responded_at TIMESTAMPTZ,
+    CONSTRAINT household_invitations_target CHECK (target_user_id IS NOT NULL OR target_email IS NOT NULL)
+);
+
+CREATE INDEX idx_household_invitations_household_id ON household_invitations (household_id);
+CREATE INDEX idx_household_invitations_target_user_id ON household_invitations (target_user_id);
+CREATE INDEX idx_household_invitations_pending_expiry ON household_invitations (expires_at) WHERE status = 'pending';
+
+-- Every couple, current or dissolved, becomes a two-member household with the
+-- same id, so piggybanks keep pointing at it.
+INSERT INTO households (id, created_at, ended_at, ended_by_user_id)
+SELECT id, created_at, ended_at, ended_by_user_id
+FROM couples;
+
+INSERT INTO household_members (id, household_id, user_id, role, joined_at, left_at)
+SELECT gen_random_uuid(), id, partner1_user_id, 'owner', created_at, ended_at
+FROM couples
+UNION ALL
+SELECT gen_random_uuid(), id, partner2_user_id, 'adult', created_at, ended_at
+FROM couples;
+
+-- piggybanks.couple_id keeps its name and now references households.
+ALTER TABLE piggybanks DROP CONSTRAINT piggybanks_couple_id_fkey;
+ALTER TABLE piggybanks
+    ADD CONSTRAINT piggybanks_couple_id_fkey
+    FOREIGN KEY (couple_id) REFERENCES households(id) ON DELETE CASCADE;
+
+DROP TABLE couples;
@@ -0,0 +1,14 @@
+-- Settings belong either to a household, couples included, or to a user
+-- without a household.
+CREATE TABLE settings (
+    id UUID PRIMARY KEY,
+    household_id UUID UNIQUE REFERENCES households(id) ON DELETE CASCADE,
+    user_id UUID UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    currency TEXT NOT NULL,
+    timezone TEXT NOT NULL,
+    locale TEXT NOT NULL,
+    week_start SMALLINT NOT NULL CHECK (week_start BETWEEN 0 AND 6),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT settings_owner CHECK ((household_id IS NULL) <> (user_id IS NULL))
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_piggybank_events_piggybank_id;
+DROP TABLE IF EXISTS piggybank_events;
@@ -0,0 +1,11 @@
+-- Audit trail of changes to a piggybank's ownership and lifecycle.
+CREATE TABLE piggybank_events (
+    id UUID PRIMARY KEY,
+    piggybank_id UUID NOT NULL REFERENCES piggybanks(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event_type TEXT NOT NULL,
+    details TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_piggybank_events_piggybank_id ON piggybank_events (piggybank_id, created_at);
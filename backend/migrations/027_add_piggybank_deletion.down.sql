@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS piggybank_deletion_confirmations;
+DROP INDEX IF EXISTS idx_piggybanks_deleted_at;
+ALTER TABLE piggybanks DROP COLUMN IF EXISTS deleted_at;
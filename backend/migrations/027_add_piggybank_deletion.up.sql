@@ -0,0 +1,12 @@
+-- Soft deletion: deleted piggybanks stay restorable until purged.
+ALTER TABLE piggybanks ADD COLUMN deleted_at TIMESTAMPTZ;
+
+CREATE INDEX idx_piggybanks_deleted_at ON piggybanks (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Confirmations by household members of a pending deletion.
+CREATE TABLE piggybank_deletion_confirmations (
+    piggybank_id UUID NOT NULL REFERENCES piggybanks(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    confirmed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (piggybank_id, user_id)
+);
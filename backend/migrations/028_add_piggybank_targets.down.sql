@@ -0,0 +1,4 @@
+ALTER TABLE piggybanks
+    DROP COLUMN IF EXISTS goal_reached_at,
+    DROP COLUMN IF EXISTS target_date,
+    DROP COLUMN IF EXISTS target_cents;
@@ -0,0 +1,5 @@
+-- Optional savings goal; goal_reached_at is set when the total first reaches it.
+ALTER TABLE piggybanks
+    ADD COLUMN target_cents INTEGER CHECK (target_cents > 0),
+    ADD COLUMN target_date DATE,
+    ADD COLUMN goal_reached_at TIMESTAMPTZ;
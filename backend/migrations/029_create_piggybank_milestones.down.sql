@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_piggybank_milestones_piggybank_id;
+DROP TABLE IF EXISTS piggybank_milestones;
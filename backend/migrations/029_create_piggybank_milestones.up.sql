@@ -0,0 +1,13 @@
+-- Ordered intermediate goals of a piggybank, each with an optional reward.
+CREATE TABLE piggybank_milestones (
+    id UUID PRIMARY KEY,
+    piggybank_id UUID NOT NULL REFERENCES piggybanks(id) ON DELETE CASCADE,
+    threshold_cents INTEGER NOT NULL CHECK (threshold_cents > 0),
+    reward TEXT,
+    position INTEGER NOT NULL,
+    reached_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_piggybank_milestones_piggybank_id ON piggybank_milestones (piggybank_id, position);
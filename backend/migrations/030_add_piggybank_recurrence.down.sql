@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_piggybanks_period_ends_at;
+DROP INDEX IF EXISTS idx_piggybanks_series_id;
+DROP INDEX IF EXISTS idx_piggybanks_previous_id;
+ALTER TABLE piggybanks
+    DROP COLUMN IF EXISTS previous_id,
+    DROP COLUMN IF EXISTS series_id,
+    DROP COLUMN IF EXISTS period_ends_at,
+    DROP COLUMN IF EXISTS recurrence;
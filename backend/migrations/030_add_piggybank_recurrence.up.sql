@@ -0,0 +1,12 @@
+-- Recurring piggybanks: each period is an instance of a series, linked to
+-- the instance it rolled over from.
+ALTER TABLE piggybanks
+    ADD COLUMN recurrence TEXT,
+    ADD COLUMN period_ends_at TIMESTAMPTZ,
+    ADD COLUMN series_id UUID,
+    ADD COLUMN previous_id UUID REFERENCES piggybanks(id) ON DELETE SET NULL;
+
+-- An instance rolls over at most once.
+CREATE UNIQUE INDEX idx_piggybanks_previous_id ON piggybanks (previous_id) WHERE previous_id IS NOT NULL;
+CREATE INDEX idx_piggybanks_series_id ON piggybanks (series_id) WHERE series_id IS NOT NULL;
+CREATE INDEX idx_piggybanks_period_ends_at ON piggybanks (period_ends_at) WHERE recurrence IS NOT NULL AND end_date IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_piggybanks_unfinalised_end_date;
+ALTER TABLE piggybanks DROP COLUMN IF EXISTS finalised_at;
@@ -0,0 +1,9 @@
+-- A piggybank is finalised once its end date has passed and its closing
+-- summary has been sent. Piggybanks that ended before this migration are
+-- considered finalised so that no summary is sent for them.
+ALTER TABLE piggybanks ADD COLUMN finalised_at TIMESTAMPTZ;
+
+UPDATE piggybanks SET finalised_at = NOW() WHERE end_date IS NOT NULL AND end_date < NOW();
+
+CREATE INDEX idx_piggybanks_unfinalised_end_date ON piggybanks (end_date)
+    WHERE finalised_at IS NULL AND end_date IS NOT NULL AND deleted_at IS NULL AND archived_at IS NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE piggybank_milestones DROP CONSTRAINT IF EXISTS piggybank_milestones_position_unique;
+CREATE INDEX IF NOT EXISTS idx_piggybank_milestones_piggybank_id ON piggybank_milestones (piggybank_id, position);
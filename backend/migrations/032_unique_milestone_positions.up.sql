@@ -0,0 +1,21 @@
+-- Milestone positions are unique within a piggybank. Piggybanks whose
+-- milestones share a position are renumbered from 1 in their current order.
+UPDATE piggybank_milestones m
+SET position = ranked.new_position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY piggybank_id ORDER BY position, threshold_cents, created_at, id) AS new_position
+    FROM piggybank_milestones
+    WHERE piggybank_id IN (
+        SELECT piggybank_id FROM piggybank_milestones
+        GROUP BY piggybank_id, position
+        HAVING COUNT(*) > 1
+    )
+) ranked
+WHERE m.id = ranked.id;
+
+-- Deferred so that moving a milestone can shift the others within a single
+-- transaction.
+DROP INDEX IF EXISTS idx_piggybank_milestones_piggybank_id;
+ALTER TABLE piggybank_milestones
+    ADD CONSTRAINT piggybank_milestones_position_unique UNIQUE (piggybank_id, position)
+    DEFERRABLE INITIALLY DEFERRED;